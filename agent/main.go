@@ -0,0 +1,156 @@
+// Command agent probes the hosts assigned to its vantage point by the go-check-certs service
+// and pushes the results back, for hosts only reachable from a specific IDC or VPC.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+)
+
+const (
+	defaultConcurrency = 8
+	// maxErrorBody : bytes of an error response kept in the error message
+	maxErrorBody = 512
+)
+
+var (
+	server      = flag.String("server", os.Getenv("AGENTSERVER"), "Base URL of the go-check-certs service, default $AGENTSERVER.")
+	token       = flag.String("token", os.Getenv("AGENTTOKEN"), "Bearer token of this agent, default $AGENTTOKEN.")
+	interval    = flag.Duration("interval", time.Hour, "Time between probe rounds.")
+	concurrency = flag.Int("concurrency", defaultConcurrency, "Maximum number of hosts to probe at once.")
+	once        = flag.Bool("once", false, "Run a single probe round and exit.")
+	ocsp        = flag.Bool("ocsp", true, "Query the OCSP responder of certs besides the stapled OCSP response.")
+	crl         = flag.Bool("crl", true, "Download the CRL of certs to check revocation.")
+
+	client = &http.Client{Timeout: time.Minute}
+)
+
+func main() {
+	flag.Parse()
+	if *server == "" || *token == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *concurrency < 1 {
+		*concurrency = defaultConcurrency
+	}
+	probe.RevocationOCSP, probe.RevocationCRL = *ocsp, *crl
+
+	// 收到信号时中断当前一轮探测并退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	for {
+		if err := runRound(ctx); err != nil {
+			log.Printf("probe round failed: %v", err)
+			if *once {
+				os.Exit(1)
+			}
+		}
+		if *once {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("shutting down")
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// runRound : pull targets, probe them and push the results, nothing is pushed if ctx is canceled
+func runRound(ctx context.Context) error {
+	targets := []probe.Target{}
+	if err := call(ctx, "GET", "/api/v1/agent/targets", nil, &targets); err != nil {
+		return fmt.Errorf("get targets: %v", err)
+	}
+	log.Printf("probing %d targets", len(targets))
+	if len(targets) == 0 {
+		return nil
+	}
+
+	reports := probeTargets(ctx, targets)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result := struct {
+		Accepted int      `json:"accepted"`
+		Rejected []string `json:"rejected"`
+	}{}
+	if err := call(ctx, "POST", "/api/v1/agent/results", reports, &result); err != nil {
+		return fmt.Errorf("push results: %v", err)
+	}
+	log.Printf("pushed %d results, %d rejected", result.Accepted, len(result.Rejected))
+	return nil
+}
+
+// probeTargets : probe targets with the tls module, at most concurrency at once
+func probeTargets(ctx context.Context, targets []probe.Target) []probe.Report {
+	reports := make([]probe.Report, len(targets))
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t probe.Target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			port := t.Port
+			if port == "" {
+				port = probe.DefaultPort
+			}
+			r := probe.Run(ctx, t.Host, port, probe.Modules[probe.DefaultModule])
+			if r.Err != nil {
+				log.Printf("%s:%s: %v", t.Host, port, r.Err)
+			}
+			reports[i] = probe.NewReport(r, time.Now())
+		}(i, t)
+	}
+	wg.Wait()
+	return reports
+}
+
+// call : send body as json to path of the service and decode the response into out
+func call(ctx context.Context, method, path string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(*server, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return errors.New(resp.Status + ": " + strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
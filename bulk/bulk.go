@@ -0,0 +1,284 @@
+// Package bulk parses host imports and formats host exports, see httpd.ImportCertInfo and
+// httpd.ExportCertInfo. It does not use the database, so the formats can be tested without mongo.
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	FormatHosts = "hosts"
+
+	// UserSeparator : separates users in a CSV column, same as the notice uid list
+	UserSeparator = "|"
+)
+
+// Row : a host of an import and what was done with it
+type Row struct {
+	Row    int      `json:"row"`
+	Host   string   `json:"host"`
+	Port   string   `json:"port"`
+	Users  []string `json:"users"`
+	Action string   `json:"action,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Entry : a host of an export, also accepted by import
+type Entry struct {
+	Host  string   `json:"host"`
+	Port  string   `json:"port"`
+	Users []string `json:"users"`
+}
+
+// importEntry : JSON import entry, port may be a number and user a single string
+type importEntry struct {
+	Host  string          `json:"host"`
+	Port  json.RawMessage `json:"port"`
+	User  string          `json:"user"`
+	Users []string        `json:"users"`
+}
+
+// Validate : check host, port and users of a parsed row
+func (r Row) Validate() error {
+	if r.Host == "" {
+		return errors.New("missing host")
+	}
+	if !ValidHost(r.Host) {
+		return fmt.Errorf("invalid host %q", r.Host)
+	}
+	port, err := strconv.Atoi(r.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %q", r.Port)
+	}
+	if len(r.Users) == 0 {
+		return errors.New("missing user, set it in the row or with the uid parameter")
+	}
+	return nil
+}
+
+// ValidHost : IP address or DNS name
+func ValidHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// DetectFormat : format of an upload without a format parameter
+func DetectFormat(contentType string, data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatJSON
+	case strings.Contains(contentType, "csv"):
+		return FormatCSV
+	}
+	// 首行为 host,... 表头时按 CSV 处理
+	firstLine := strings.ToLower(strings.SplitN(string(trimmed), "\n", 2)[0])
+	if strings.HasPrefix(firstLine, "host,") {
+		return FormatCSV
+	}
+	return FormatHosts
+}
+
+// Parse : rows of data, rows that cannot be parsed carry an error
+func Parse(format string, data []byte) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data)
+	case FormatJSON:
+		return parseJSON(data)
+	case FormatHosts:
+		return parseHosts(data)
+	}
+	return nil, fmt.Errorf("unknown format %q, use csv, json or hosts", format)
+}
+
+// parseCSV : header row with host, optional port and user columns
+func parseCSV(data []byte) ([]Row, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	hostCol, ok := columns["host"]
+	if !ok {
+		return nil, errors.New("csv header has no host column")
+	}
+	userCol, ok := columns["users"]
+	if !ok {
+		userCol, ok = columns["user"]
+	}
+	if !ok {
+		userCol = -1
+	}
+	portCol, ok := columns["port"]
+	if !ok {
+		portCol = -1
+	}
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rows := []Row{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		// 行号按记录计算，表头为第 1 行
+		line := len(rows) + 2
+		if err != nil {
+			rows = append(rows, Row{Row: line, Error: err.Error()})
+			continue
+		}
+		row := NewRow(line, field(record, hostCol), field(record, portCol))
+		row.Users = SplitUsers(field(record, userCol))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseJSON : list of entries or an object with a hosts list, as exported
+func parseJSON(data []byte) ([]Row, error) {
+	var entries []importEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		wrapped := struct {
+			Hosts []importEntry `json:"hosts"`
+		}{}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("invalid json: %v", err)
+		}
+		entries = wrapped.Hosts
+	}
+
+	rows := make([]Row, 0, len(entries))
+	for i, e := range entries {
+		port := strings.Trim(string(e.Port), `"`)
+		if port == "null" {
+			port = ""
+		}
+		row := NewRow(i+1, e.Host, port)
+		row.Users = append(SplitUsers(e.User), e.Users...)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseHosts : hosts file of the check-certs CLI, one host, host:port or URL per line
+func parseHosts(data []byte) ([]Row, error) {
+	rows := []Row{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		host := strings.TrimSpace(scanner.Text())
+		if len(host) == 0 || host[0] == '#' {
+			continue
+		}
+		rows = append(rows, NewRow(line, host, ""))
+	}
+	return rows, scanner.Err()
+}
+
+// NewRow : split host:port and URLs, port column overrides the port in host
+func NewRow(line int, host, port string) Row {
+	row := Row{Row: line, Host: host, Port: port}
+	if host == "" {
+		return row
+	}
+	t, err := certcheck.ParseTarget(host)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	if t.Protocol != "tls" {
+		row.Error = fmt.Sprintf("protocol %s is not supported for monitored hosts", t.Protocol)
+		return row
+	}
+	row.Host = strings.ToLower(t.Host)
+	if row.Port == "" {
+		row.Port = t.Port
+	}
+	return row
+}
+
+// SplitUsers : users of a CSV column
+func SplitUsers(s string) []string {
+	users := []string{}
+	for _, u := range strings.Split(s, UserSeparator) {
+		if u = strings.TrimSpace(u); u != "" {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// Export : entries in format, with the content type of the download
+func Export(format string, entries []Entry) ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(buf)
+		_ = cw.Write([]string{"host", "port", "users"})
+		for _, e := range entries {
+			_ = cw.Write([]string{e.Host, e.Port, strings.Join(e.Users, UserSeparator)})
+		}
+		cw.Flush()
+		return buf.Bytes(), "text/csv; charset=utf-8", cw.Error()
+	case FormatJSON:
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(entries)
+		return buf.Bytes(), "application/json", err
+	case FormatHosts:
+		for _, e := range entries {
+			fmt.Fprintln(buf, net.JoinHostPort(e.Host, e.Port))
+		}
+		return buf.Bytes(), "text/plain; charset=utf-8", nil
+	}
+	return nil, "", fmt.Errorf("unknown format %q, use csv, json or hosts", format)
+}
+
+// FileExt : file extension of an export in format
+func FileExt(format string) string {
+	if format == FormatHosts {
+		return "txt"
+	}
+	return format
+}
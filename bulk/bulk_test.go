@@ -0,0 +1,212 @@
+package bulk
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	entries := []Entry{
+		{Host: "a.example.com", Port: "443", Users: []string{"likuo"}},
+		{Host: "b.example.com", Port: "8443", Users: []string{"likuo", "zhangsan"}},
+		{Host: "10.0.0.1", Port: "636", Users: []string{"ops"}},
+	}
+	for _, tt := range []struct {
+		format string
+		// users : hosts files do not carry users
+		users bool
+	}{
+		{format: FormatCSV, users: true},
+		{format: FormatJSON, users: true},
+		{format: FormatHosts},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			data, contentType, err := Export(tt.format, entries)
+			if err != nil {
+				t.Fatalf("Export() err = %v", err)
+			}
+			if got := DetectFormat(contentType, data); got != tt.format {
+				t.Errorf("DetectFormat(%q) = %s, want %s", contentType, got, tt.format)
+			}
+			// uploads without a content type are detected by the content
+			if got := DetectFormat("", data); got != tt.format {
+				t.Errorf("DetectFormat() = %s, want %s", got, tt.format)
+			}
+			rows, err := Parse(tt.format, data)
+			if err != nil {
+				t.Fatalf("Parse() err = %v", err)
+			}
+			if len(rows) != len(entries) {
+				t.Fatalf("Parse() = %d rows, want %d:\n%s", len(rows), len(entries), data)
+			}
+			for i, row := range rows {
+				want := entries[i]
+				if !tt.users {
+					want.Users = nil
+				}
+				got := Entry{Host: row.Host, Port: row.Port, Users: row.Users}
+				if row.Error != "" || !reflect.DeepEqual(got, want) {
+					t.Errorf("row %d = %+v, want %+v", i, row, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	entries := []Entry{{Host: "a.example.com", Port: "443", Users: []string{"likuo", "zhangsan"}}}
+	for _, tt := range []struct {
+		format      string
+		want        string
+		contentType string
+	}{
+		{format: FormatCSV, want: "host,port,users\na.example.com,443,likuo|zhangsan\n", contentType: "text/csv; charset=utf-8"},
+		{format: FormatHosts, want: "a.example.com:443\n", contentType: "text/plain; charset=utf-8"},
+		{
+			format:      FormatJSON,
+			want:        "[\n  {\n    \"host\": \"a.example.com\",\n    \"port\": \"443\",\n    \"users\": [\n      \"likuo\",\n      \"zhangsan\"\n    ]\n  }\n]\n",
+			contentType: "application/json",
+		},
+	} {
+		data, contentType, err := Export(tt.format, entries)
+		if err != nil || string(data) != tt.want || contentType != tt.contentType {
+			t.Errorf("Export(%s) = %q, %q, %v, want %q, %q", tt.format, data, contentType, err, tt.want, tt.contentType)
+		}
+	}
+	if _, _, err := Export("xml", entries); err == nil {
+		t.Error("Export(xml) err = nil, want unknown format")
+	}
+	if ext := FileExt(FormatHosts); ext != "txt" {
+		t.Errorf("FileExt(hosts) = %s, want txt", ext)
+	}
+}
+
+func TestParse(t *testing.T) {
+	row := func(line int, host, port string, users ...string) Row {
+		if users == nil {
+			users = []string{}
+		}
+		return Row{Row: line, Host: host, Port: port, Users: users}
+	}
+	for _, tt := range []struct {
+		name   string
+		format string
+		data   string
+		want   []Row
+		err    string
+	}{
+		{
+			name:   "csv single user column and default port",
+			format: FormatCSV,
+			data:   "User, Host\nlikuo, WWW.Example.com\n",
+			want:   []Row{row(2, "www.example.com", "443", "likuo")},
+		},
+		{
+			name:   "csv port column overrides host port",
+			format: FormatCSV,
+			data:   "host,port,users\na.example.com:8443,9443,likuo | zhangsan\nb.example.com:8443,,\n",
+			want:   []Row{row(2, "a.example.com", "9443", "likuo", "zhangsan"), row(3, "b.example.com", "8443")},
+		},
+		{
+			name:   "csv url and unsupported protocol",
+			format: FormatCSV,
+			data:   "host\nldaps://ldap.example.com\nsmtp://mail.example.com\n",
+			want: []Row{
+				row(2, "ldap.example.com", "636"),
+				{Row: 3, Host: "smtp://mail.example.com", Users: []string{}, Error: "protocol smtp is not supported for monitored hosts"},
+			},
+		},
+		{name: "csv without host column", format: FormatCSV, data: "name,users\na,likuo\n", err: "csv header has no host column"},
+		{
+			name:   "json numeric port and single user",
+			format: FormatJSON,
+			data:   `[{"host": "a.example.com", "port": 8443, "user": "likuo|ops", "users": ["zhangsan"]}, {"host": "b.example.com", "port": null}]`,
+			want:   []Row{row(1, "a.example.com", "8443", "likuo", "ops", "zhangsan"), row(2, "b.example.com", "443")},
+		},
+		{
+			name:   "json hosts object",
+			format: FormatJSON,
+			data:   `{"hosts": [{"host": "a.example.com", "port": "443", "users": ["likuo"]}]}`,
+			want:   []Row{row(1, "a.example.com", "443", "likuo")},
+		},
+		{name: "invalid json", format: FormatJSON, data: `[{"host": }]`, err: "invalid json: invalid character '}' looking for beginning of value"},
+		{
+			name:   "hosts file",
+			format: FormatHosts,
+			data:   "# prod\nwww.example.com\n\n  https://a.example.com:8443/path  \n",
+			want:   []Row{{Row: 2, Host: "www.example.com", Port: "443"}, {Row: 4, Host: "a.example.com", Port: "8443"}},
+		},
+		{name: "unknown format", format: "xml", data: "<hosts/>", err: `unknown format "xml", use csv, json or hosts`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.format, []byte(tt.data))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Parse() err = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() err = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBadCSVRecord(t *testing.T) {
+	rows, err := Parse(FormatCSV, []byte("host,users\nwww.exa\"mple.com,likuo\nb.example.com,likuo\n"))
+	if err != nil {
+		t.Fatalf("Parse() err = %v", err)
+	}
+	if len(rows) != 2 || rows[0].Row != 2 || !strings.Contains(rows[0].Error, "bare \" in non-quoted-field") {
+		t.Fatalf("Parse() = %+v, want an error on row 2", rows)
+	}
+	if rows[1].Row != 3 || rows[1].Host != "b.example.com" || rows[1].Error != "" {
+		t.Errorf("row after the bad record = %+v, want b.example.com on row 3", rows[1])
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for _, tt := range []struct {
+		contentType, data, want string
+	}{
+		{contentType: "application/json", data: "", want: FormatJSON},
+		{contentType: "text/csv", data: "www.example.com\n", want: FormatCSV},
+		{data: "  {\"hosts\": []}", want: FormatJSON},
+		{data: "Host,Users\nwww.example.com,likuo\n", want: FormatCSV},
+		{data: "www.example.com\na.example.com:8443\n", want: FormatHosts},
+		{contentType: "text/plain", data: "", want: FormatHosts},
+	} {
+		if got := DetectFormat(tt.contentType, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = %s, want %s", tt.contentType, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		row Row
+		err string
+	}{
+		{row: Row{Host: "www.example.com", Port: "443", Users: []string{"likuo"}}},
+		{row: Row{Host: "10.0.0.1", Port: "65535", Users: []string{"likuo"}}},
+		{row: Row{Host: "_dmarc.example.com", Port: "1", Users: []string{"likuo"}}},
+		{row: Row{Port: "443", Users: []string{"likuo"}}, err: "missing host"},
+		{row: Row{Host: "www..example.com", Port: "443", Users: []string{"likuo"}}, err: `invalid host "www..example.com"`},
+		{row: Row{Host: "WWW.example.com", Port: "443", Users: []string{"likuo"}}, err: `invalid host "WWW.example.com"`},
+		{row: Row{Host: strings.Repeat("a", 64) + ".com", Port: "443", Users: []string{"likuo"}}, err: fmt.Sprintf("invalid host %q", strings.Repeat("a", 64)+".com")},
+		{row: Row{Host: "www.example.com", Port: "0", Users: []string{"likuo"}}, err: `invalid port "0"`},
+		{row: Row{Host: "www.example.com", Port: "https", Users: []string{"likuo"}}, err: `invalid port "https"`},
+		{row: Row{Host: "www.example.com", Port: "443"}, err: "missing user, set it in the row or with the uid parameter"},
+	} {
+		err := tt.row.Validate()
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.row, err, tt.err)
+		}
+	}
+}
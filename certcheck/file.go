@@ -0,0 +1,230 @@
+package certcheck
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// MaxFileSize : files larger than this are not parsed when scanning directories
+const MaxFileSize = 1 << 20
+
+var (
+	// ErrNotCertFile : data is not in any supported certificate format
+	ErrNotCertFile = errors.New("no certificate or private key found")
+
+	// certExts : extensions parsed when scanning directories, other files are only
+	// parsed if they look like PEM
+	certExts = map[string]bool{
+		".pem": true, ".crt": true, ".cer": true, ".der": true, ".key": true,
+		".p12": true, ".pfx": true, ".jks": true, ".keystore": true,
+	}
+)
+
+// Bundle : certificates and private keys parsed from a single file
+type Bundle struct {
+	Path  string
+	Certs []*x509.Certificate
+	Keys  []crypto.PrivateKey
+}
+
+// KeyFor : return the private key in bundle matching cert public key
+func (b *Bundle) KeyFor(cert *x509.Certificate) (crypto.PrivateKey, bool) {
+	for _, key := range b.Keys {
+		if MatchKey(cert, key) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// UnmatchedKeys : return the private keys in bundle matching none of the certs
+func (b *Bundle) UnmatchedKeys() []crypto.PrivateKey {
+	keys := []crypto.PrivateKey{}
+	for _, key := range b.Keys {
+		matched := false
+		for _, cert := range b.Certs {
+			if MatchKey(cert, key) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// MatchKey : check if private key belongs to cert
+func MatchKey(cert *x509.Certificate, key crypto.PrivateKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return false
+	}
+	return pub.Equal(cert.PublicKey)
+}
+
+// Parse : parse PEM, DER, PKCS#12 or Java keystore data, password is used for PKCS#12 and keystores
+func Parse(name string, data []byte, password string) (*Bundle, error) {
+	b := &Bundle{Path: name}
+	switch {
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		if err := b.parsePEM(data); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(data, jksMagic):
+		certs, keys, err := parseJKS(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		b.Certs, b.Keys = certs, keys
+	default:
+		if certs, err := x509.ParseCertificates(data); err == nil {
+			b.Certs = certs
+			break
+		}
+		if key, err := parsePrivateKey(data); err == nil {
+			b.Keys = append(b.Keys, key)
+			break
+		}
+		blocks, err := pkcs12.ToPEM(data, password)
+		if err != nil {
+			// 不支持的加密算法（如 OpenSSL 3 默认的 AES）需要如实报告
+			if _, ok := err.(pkcs12.NotImplementedError); ok || err == pkcs12.ErrIncorrectPassword {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			return nil, fmt.Errorf("%s: %w", name, ErrNotCertFile)
+		}
+		for _, block := range blocks {
+			if err := b.addPEMBlock(block); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+
+	if len(b.Certs) == 0 && len(b.Keys) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotCertFile)
+	}
+	return b, nil
+}
+
+func (b *Bundle) parsePEM(data []byte) error {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if err := b.addPEMBlock(block); err != nil {
+			return fmt.Errorf("%s: %v", b.Path, err)
+		}
+	}
+}
+
+func (b *Bundle) addPEMBlock(block *pem.Block) error {
+	switch {
+	case block.Type == "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		b.Certs = append(b.Certs, cert)
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		// 加密的私钥无法与证书匹配，忽略
+	case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		b.Keys = append(b.Keys, key)
+	}
+	return nil
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// ParseFile : read and parse a single file
+func ParseFile(path, password string) (*Bundle, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data, password)
+}
+
+// Scan : parse path, walking it if it is a directory. Files in directories that
+// are not certificates are skipped silently, other errors are returned per file.
+func Scan(path, password string) ([]*Bundle, []error) {
+	bundles := []*Bundle{}
+	errs := []error{}
+	info, err := os.Stat(path)
+	if err != nil {
+		return bundles, append(errs, err)
+	}
+	if !info.IsDir() {
+		b, err := ParseFile(path, password)
+		if err != nil {
+			return bundles, append(errs, err)
+		}
+		return append(bundles, b), errs
+	}
+
+	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		// /etc/ssl/certs 下多为指向证书的符号链接，跟随链接读取文件
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if fi, err = os.Stat(p); err != nil {
+				return nil
+			}
+		}
+		if fi.IsDir() || !fi.Mode().IsRegular() || fi.Size() > MaxFileSize {
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if !certExts[strings.ToLower(filepath.Ext(p))] && !bytes.Contains(data, []byte("-----BEGIN ")) {
+			return nil
+		}
+		b, err := Parse(p, data, password)
+		if err != nil {
+			if !errors.Is(err, ErrNotCertFile) {
+				errs = append(errs, err)
+			}
+			return nil
+		}
+		bundles = append(bundles, b)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return bundles, errs
+}
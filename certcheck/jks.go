@@ -0,0 +1,220 @@
+package certcheck
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Java keystore (JKS) format, see sun.security.provider.JavaKeyStore.
+
+var (
+	jksMagic = []byte{0xfe, 0xed, 0xfe, 0xed}
+
+	// oidJKSKeyProtector : sun.security.provider.KeyProtector
+	oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+	errJKSIntegrity = errors.New("keystore was tampered with, or password was incorrect")
+)
+
+const (
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+)
+
+type jksReader struct {
+	r       io.Reader
+	version uint32
+}
+
+func (j *jksReader) uint16() (uint16, error) {
+	var v uint16
+	err := binary.Read(j.r, binary.BigEndian, &v)
+	return v, err
+}
+
+func (j *jksReader) uint32() (uint32, error) {
+	var v uint32
+	err := binary.Read(j.r, binary.BigEndian, &v)
+	return v, err
+}
+
+func (j *jksReader) bytes(n uint32) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(j.r, b)
+	return b, err
+}
+
+func (j *jksReader) utf() (string, error) {
+	n, err := j.uint16()
+	if err != nil {
+		return "", err
+	}
+	b, err := j.bytes(uint32(n))
+	return string(b), err
+}
+
+func (j *jksReader) cert() (*x509.Certificate, error) {
+	if j.version == 2 {
+		if _, err := j.utf(); err != nil {
+			return nil, err
+		}
+	}
+	n, err := j.uint32()
+	if err != nil {
+		return nil, err
+	}
+	der, err := j.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// parseJKS : parse certs and private keys from a Java keystore. The key
+// password is assumed to be the same as the store password.
+func parseJKS(data []byte, password string) ([]*x509.Certificate, []crypto.PrivateKey, error) {
+	if len(data) < len(jksMagic)+sha1.Size {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	passwd := jksPassword(password)
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if password != "" {
+		h := sha1.New()
+		h.Write(passwd)
+		h.Write([]byte("Mighty Aphrodite"))
+		h.Write(body)
+		if !bytes.Equal(h.Sum(nil), digest) {
+			return nil, nil, errJKSIntegrity
+		}
+	}
+
+	j := &jksReader{r: bytes.NewReader(body[len(jksMagic):])}
+	version, err := j.uint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	if version != 1 && version != 2 {
+		return nil, nil, fmt.Errorf("unsupported keystore version %d", version)
+	}
+	j.version = version
+	count, err := j.uint32()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certs := []*x509.Certificate{}
+	keys := []crypto.PrivateKey{}
+	for i := uint32(0); i < count; i++ {
+		tag, err := j.uint32()
+		if err != nil {
+			return nil, nil, err
+		}
+		// alias and creation time
+		if _, err := j.utf(); err != nil {
+			return nil, nil, err
+		}
+		if _, err := j.bytes(8); err != nil {
+			return nil, nil, err
+		}
+
+		switch tag {
+		case jksPrivateKeyTag:
+			n, err := j.uint32()
+			if err != nil {
+				return nil, nil, err
+			}
+			encrypted, err := j.bytes(n)
+			if err != nil {
+				return nil, nil, err
+			}
+			chainLen, err := j.uint32()
+			if err != nil {
+				return nil, nil, err
+			}
+			for c := uint32(0); c < chainLen; c++ {
+				cert, err := j.cert()
+				if err != nil {
+					return nil, nil, err
+				}
+				certs = append(certs, cert)
+			}
+			if password == "" {
+				continue
+			}
+			key, err := jksDecryptKey(encrypted, passwd)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys = append(keys, key)
+		case jksTrustedCertTag:
+			cert, err := j.cert()
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+		default:
+			return nil, nil, fmt.Errorf("unsupported keystore entry tag %d", tag)
+		}
+	}
+	return certs, keys, nil
+}
+
+// jksDecryptKey : decrypt private key protected by the JKS key protector
+func jksDecryptKey(encrypted, passwd []byte) (crypto.PrivateKey, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}
+	if _, err := asn1.Unmarshal(encrypted, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return nil, fmt.Errorf("unsupported key protection algorithm %v", info.Algorithm.Algorithm)
+	}
+	if len(info.Data) < 2*sha1.Size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	salt := info.Data[:sha1.Size]
+	protected := info.Data[sha1.Size : len(info.Data)-sha1.Size]
+	check := info.Data[len(info.Data)-sha1.Size:]
+
+	plain := make([]byte, len(protected))
+	digest := salt
+	for i := 0; i < len(protected); i += sha1.Size {
+		h := sha1.New()
+		h.Write(passwd)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for k := 0; k < sha1.Size && i+k < len(protected); k++ {
+			plain[i+k] = protected[i+k] ^ digest[k]
+		}
+	}
+
+	h := sha1.New()
+	h.Write(passwd)
+	h.Write(plain)
+	if !bytes.Equal(h.Sum(nil), check) {
+		return nil, errJKSIntegrity
+	}
+	return x509.ParsePKCS8PrivateKey(plain)
+}
+
+// jksPassword : password as UTF-16 big endian bytes
+func jksPassword(password string) []byte {
+	codes := utf16.Encode([]rune(password))
+	b := make([]byte, 2*len(codes))
+	for i, c := range codes {
+		binary.BigEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
@@ -0,0 +1,50 @@
+package certcheck
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// SigAlgSunset : human readable name of signature algorithm and the time it will be sunset
+type SigAlgSunset struct {
+	Name      string
+	SunsetsAt time.Time
+}
+
+// SunsetSigAlgs is an algorithm to string mapping for signature algorithms
+// which have been or are being deprecated.  See the following links to learn
+// more about SHA1's inclusion on this list.
+//
+// - https://technet.microsoft.com/en-us/library/security/2880823.aspx
+// - http://googleonlinesecurity.blogspot.com/2014/09/gradually-sunsetting-sha-1.html
+var SunsetSigAlgs = map[x509.SignatureAlgorithm]SigAlgSunset{
+	x509.MD2WithRSA: {
+		Name:      "MD2 with RSA",
+		SunsetsAt: time.Now(),
+	},
+	x509.MD5WithRSA: {
+		Name:      "MD5 with RSA",
+		SunsetsAt: time.Now(),
+	},
+	x509.SHA1WithRSA: {
+		Name:      "SHA1 with RSA",
+		SunsetsAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+	x509.DSAWithSHA1: {
+		Name:      "DSA with SHA1",
+		SunsetsAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+	x509.ECDSAWithSHA1: {
+		Name:      "ECDSA with SHA1",
+		SunsetsAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+// SunsetSigAlg : return the sunset signature algorithm of cert if cert expires after its sunset date
+func SunsetSigAlg(cert *x509.Certificate) (SigAlgSunset, bool) {
+	alg, exists := SunsetSigAlgs[cert.SignatureAlgorithm]
+	if !exists {
+		return alg, false
+	}
+	return alg, cert.NotAfter.Equal(alg.SunsetsAt) || cert.NotAfter.After(alg.SunsetsAt)
+}
@@ -0,0 +1,78 @@
+package certcheck
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DefaultPort : port of targets given without port or scheme
+const DefaultPort = "443"
+
+// SchemePorts : default port of URL schemes and the protocol used to start TLS on it
+var SchemePorts = map[string]struct {
+	Port     string
+	Protocol string
+}{
+	"https":      {"443", "tls"},
+	"tls":        {"443", "tls"},
+	"smtps":      {"465", "tls"},
+	"imaps":      {"993", "tls"},
+	"pop3s":      {"995", "tls"},
+	"ldaps":      {"636", "tls"},
+	"ftps":       {"990", "tls"},
+	"smtp":       {"25", "smtp"},
+	"submission": {"587", "smtp"},
+	"imap":       {"143", "imap"},
+	"pop3":       {"110", "pop3"},
+	"ftp":        {"21", "ftp"},
+	"postgres":   {"5432", "postgres"},
+	"postgresql": {"5432", "postgres"},
+}
+
+// Target : endpoint parsed from a hosts file line
+type Target struct {
+	Host     string
+	Port     string
+	Protocol string
+}
+
+// ParseTarget : accept host, host:port, [v6]:port and URLs such as
+// https://host:8443/path or smtp://host
+func ParseTarget(s string) (Target, error) {
+	s = strings.TrimSpace(s)
+	t := Target{Port: DefaultPort, Protocol: "tls"}
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return t, err
+		}
+		scheme, ok := SchemePorts[strings.ToLower(u.Scheme)]
+		if !ok {
+			return t, fmt.Errorf("unsupported scheme %q in %q", u.Scheme, s)
+		}
+		t.Host, t.Port, t.Protocol = u.Hostname(), u.Port(), scheme.Protocol
+		if t.Port == "" {
+			t.Port = scheme.Port
+		}
+	} else {
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			s = s[:i]
+		}
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			if !strings.Contains(err.Error(), "missing port") {
+				return t, fmt.Errorf("invalid host %q: %v", s, err)
+			}
+			host = strings.Trim(s, "[]")
+		} else {
+			t.Port = port
+		}
+		t.Host = host
+	}
+	if t.Host == "" {
+		return t, fmt.Errorf("missing host in %q", s)
+	}
+	return t, nil
+}
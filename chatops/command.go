@@ -0,0 +1,145 @@
+// Package chatops parses the chat commands of the SRE assistant, see httpd.Chat.
+package chatops
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Keyword       = "证书"
+	DeleteKeyword = "证书-"
+
+	DefaultSnooze = 7 * 24 * time.Hour
+	MaxSnooze     = 90 * 24 * time.Hour
+	// ReplyLimit : max bytes of a WeChat Work markdown message
+	ReplyLimit = 4096
+)
+
+type Action string
+
+const (
+	Help   Action = "help"
+	Query  Action = "query"
+	Add    Action = "add"
+	Delete Action = "delete"
+	Snooze Action = "snooze"
+	Ack    Action = "ack"
+)
+
+// subcommands : first argument of "证书" naming a subcommand, with chinese aliases
+var subcommands = map[string]Action{
+	"help":   Help,
+	"帮助":     Help,
+	"snooze": Snooze,
+	"静默":     Snooze,
+	"ack":    Ack,
+	"确认":     Ack,
+}
+
+var ErrNotCommand = errors.New("not a cert command")
+
+// Command : parsed chat message
+type Command struct {
+	Action Action
+	// Args : hosts, or users for query
+	Args   []string
+	Snooze time.Duration
+}
+
+// Parse : parse commands described in main.go, hosts may be on the first line or one per line
+func Parse(text string) (Command, error) {
+	cmd := Command{}
+	text = strings.NewReplacer("\r", "\n", "　", " ").Replace(text)
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return cmd, ErrNotCommand
+	}
+
+	head := strings.Fields(lines[0])
+	args := head[1:]
+	for _, line := range lines[1:] {
+		args = append(args, strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' || r == '，' })...)
+	}
+
+	switch head[0] {
+	case DeleteKeyword:
+		cmd.Action = Delete
+	case Keyword:
+		if len(head) > 1 {
+			if action, ok := subcommands[strings.ToLower(head[1])]; ok {
+				cmd.Action = action
+				args = args[1:]
+				break
+			}
+		}
+		if len(lines) > 1 {
+			cmd.Action = Add
+		} else {
+			cmd.Action = Query
+		}
+	default:
+		return cmd, ErrNotCommand
+	}
+	cmd.Args = args
+
+	switch cmd.Action {
+	case Add, Delete, Ack:
+		if len(cmd.Args) == 0 {
+			return cmd, errors.New("缺少域名")
+		}
+	case Snooze:
+		cmd.Snooze = DefaultSnooze
+		if n := len(cmd.Args); n > 0 {
+			if d, ok := ParseSnooze(cmd.Args[n-1]); ok {
+				cmd.Snooze = d
+				cmd.Args = cmd.Args[:n-1]
+			}
+		}
+		if len(cmd.Args) == 0 {
+			return cmd, errors.New("缺少域名")
+		}
+		if cmd.Snooze <= 0 || cmd.Snooze > MaxSnooze {
+			return cmd, fmt.Errorf("暂停时长须在 1h 到 %dd 之间", int(MaxSnooze.Hours()/24))
+		}
+	}
+	return cmd, nil
+}
+
+// ParseSnooze : 7d, 12h, or days as a plain number
+func ParseSnooze(s string) (time.Duration, bool) {
+	unit := 24 * time.Hour
+	switch {
+	case strings.HasSuffix(s, "d"), strings.HasSuffix(s, "天"):
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "d"), "天")
+	case strings.HasSuffix(s, "h"):
+		s = strings.TrimSuffix(s, "h")
+		unit = time.Hour
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// TruncateReply : cut reply at a line boundary to fit a WeChat Work message
+func TruncateReply(reply string) string {
+	if len(reply) <= ReplyLimit {
+		return reply
+	}
+	more := "\n……"
+	cut := strings.LastIndex(reply[:ReplyLimit-len(more)], "\n")
+	if cut < 0 {
+		cut = 0
+	}
+	return reply[:cut] + more
+}
@@ -0,0 +1,118 @@
+package chatops
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		text string
+		want Command
+		err  string
+	}{
+		{name: "empty", text: " \n　", err: ErrNotCommand.Error()},
+		{name: "other message", text: "hello www.ifeng.com", err: ErrNotCommand.Error()},
+		{name: "list own hosts", text: "证书", want: Command{Action: Query, Args: []string{}}},
+		{name: "query", text: "证书 www.ifeng.com likuo", want: Command{Action: Query, Args: []string{"www.ifeng.com", "likuo"}}},
+		{name: "full width space", text: "证书　www.ifeng.com", want: Command{Action: Query, Args: []string{"www.ifeng.com"}}},
+		{name: "help", text: "证书 help", want: Command{Action: Help, Args: []string{}}},
+		{name: "chinese alias", text: "证书 帮助", want: Command{Action: Help, Args: []string{}}},
+		{name: "subcommand case", text: "证书 HELP", want: Command{Action: Help, Args: []string{}}},
+		{
+			name: "add one per line",
+			text: "证书\r\nwww.ifeng.com\n\n  a.ifeng.com:8443  \n",
+			want: Command{Action: Add, Args: []string{"www.ifeng.com", "a.ifeng.com:8443"}},
+		},
+		{
+			name: "add separated by commas",
+			text: "证书 www.ifeng.com\na.ifeng.com，b.ifeng.com, c.ifeng.com",
+			want: Command{Action: Add, Args: []string{"www.ifeng.com", "a.ifeng.com", "b.ifeng.com", "c.ifeng.com"}},
+		},
+		{name: "delete", text: "证书-\nwww.ifeng.com", want: Command{Action: Delete, Args: []string{"www.ifeng.com"}}},
+		{name: "delete on first line", text: "证书- www.ifeng.com", want: Command{Action: Delete, Args: []string{"www.ifeng.com"}}},
+		{name: "delete without hosts", text: "证书-", err: "缺少域名"},
+		{name: "ack", text: "证书 ack www.ifeng.com", want: Command{Action: Ack, Args: []string{"www.ifeng.com"}}},
+		{name: "ack without hosts", text: "证书 确认", err: "缺少域名"},
+		{
+			name: "snooze default",
+			text: "证书 snooze www.ifeng.com",
+			want: Command{Action: Snooze, Args: []string{"www.ifeng.com"}, Snooze: DefaultSnooze},
+		},
+		{
+			name: "snooze hours",
+			text: "证书 静默 www.ifeng.com a.ifeng.com 12h",
+			want: Command{Action: Snooze, Args: []string{"www.ifeng.com", "a.ifeng.com"}, Snooze: 12 * time.Hour},
+		},
+		{name: "snooze without hosts", text: "证书 snooze 3d", err: "缺少域名"},
+		{name: "snooze too long", text: "证书 snooze www.ifeng.com 91d", err: "暂停时长须在 1h 到 90d 之间"},
+		{name: "snooze zero", text: "证书 snooze www.ifeng.com 0h", err: "暂停时长须在 1h 到 90d 之间"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Parse(%q) err = %v, want %s", tt.text, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) err = %v", tt.text, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSnooze(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{s: "7d", want: 7 * 24 * time.Hour, ok: true},
+		{s: "3天", want: 3 * 24 * time.Hour, ok: true},
+		{s: "12h", want: 12 * time.Hour, ok: true},
+		{s: "5", want: 5 * 24 * time.Hour, ok: true},
+		{s: "-1d", want: -24 * time.Hour, ok: true},
+		{s: "1.5d"},
+		{s: "www.ifeng.com"},
+		{s: "d"},
+		{s: ""},
+	} {
+		got, ok := ParseSnooze(tt.s)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseSnooze(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTruncateReply(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	long := strings.Repeat(line, 50)
+	for _, tt := range []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{name: "short", reply: "ok", want: "ok"},
+		{name: "at limit", reply: strings.Repeat("x", ReplyLimit), want: strings.Repeat("x", ReplyLimit)},
+		{name: "cut at line", reply: long, want: strings.Repeat(line, 40)[:40*len(line)-1] + "\n……"},
+		{name: "single long line", reply: strings.Repeat("x", ReplyLimit+1), want: "\n……"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncateReply(tt.reply)
+			if got != tt.want {
+				t.Errorf("TruncateReply() = %d bytes %q, want %d bytes %q", len(got), got, len(tt.want), tt.want)
+			}
+			if len(got) > ReplyLimit {
+				t.Errorf("TruncateReply() = %d bytes, over the limit of %d", len(got), ReplyLimit)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"go.uber.org/zap"
 	"os"
 	"strings"
 	"time"
 
+	"git.ifengidc.com/likuo/go-check-certs/config/configfile"
+
 	"gopkg.in/mgo.v2"
 )
 
@@ -29,6 +32,30 @@ var (
 	MongoPassword = ""
 	// MongoSession : for mongo session
 	MongoSession *mgo.Session
+	// MongoOpTimeout : limit of a single mongo operation, shorter than the shutdown timeout
+	MongoOpTimeout = 10 * time.Second
+
+	// KubeConfig : kubeconfig path for kubernetes discovery, optional
+	KubeConfig = ""
+	// KubeContext : kubeconfig context, empty means current-context
+	KubeContext = ""
+	// KubeInCluster : use the pod service account for kubernetes discovery
+	KubeInCluster = false
+
+	// MetricLabels : host label keys exported on cert_host_info
+	MetricLabels []string
+
+	// Listen : listen address of the http service
+	Listen = ""
+	// ProbeConcurrency : hosts probed at once by the cron
+	ProbeConcurrency = 0
+	// ProbeOCSP, ProbeCRL : query the OCSP responder and the CRL of certs
+	ProbeOCSP = true
+	ProbeCRL  = true
+	// ProbeModules : probe modules defined in the config file
+	ProbeModules map[string]configfile.ModuleConfig
+	// MessageAddress : base url of the message gateway
+	MessageAddress = ""
 )
 
 func init() {
@@ -39,31 +66,29 @@ func init() {
 		panic(err)
 	}
 
-	MessageAppID = os.Getenv("MESSAGEAPPID")
-	if MessageAppID == "" {
-		panic("MESSAGEAPPID is null")
-	}
-	MessageAppKey = os.Getenv("MESSAGEAPPKEY")
-	if MessageAppKey == "" {
-		panic("MESSAGEAPPKEY is null")
+	// 配置文件可选，环境变量覆盖文件中的配置
+	Path = os.Getenv("CONFIGFILE")
+	current, err = Load(Path)
+	if err != nil {
+		fatal(err)
 	}
+	Listen = current.Listen
+	MessageAppID = current.Message.AppID
+	MessageAppKey = current.Message.AppKey
+	MessageAddress = current.Message.Address
+	MongoAddr = current.Mongo.Addr
+	MongoDatabase = current.Mongo.Database
+	MongoUsername = current.Mongo.Username
+	MongoPassword = current.Mongo.Password
+	KubeConfig = current.Kubernetes.Config
+	KubeContext = current.Kubernetes.Context
+	KubeInCluster = current.Kubernetes.InCluster
+	ProbeConcurrency = current.Probe.Concurrency
+	ProbeOCSP = current.Probe.OCSP
+	ProbeCRL = current.Probe.CRL
+	ProbeModules = current.Probe.Modules
+	MetricLabels = current.Metrics.Labels
 
-	MongoAddr = os.Getenv("MONGOADDR")
-	if MongoAddr == "" {
-		panic("MONGOADDR is null")
-	}
-	MongoDatabase = os.Getenv("MONGODATABASE")
-	if MongoDatabase == "" {
-		panic("MONGODATABASE is null")
-	}
-	MongoUsername = os.Getenv("MONGOUSERNAME")
-	if MongoUsername == "" {
-		panic("MONGOUSERNAME is null")
-	}
-	MongoPassword = os.Getenv("MONGOPASSWORD")
-	if MongoPassword == "" {
-		panic("MONGOPASSWORD is null")
-	}
 	dailInfo := &mgo.DialInfo{
 		Addrs:     strings.Split(MongoAddr, ","),
 		Direct:    false,
@@ -76,7 +101,7 @@ func init() {
 	}
 	MongoSession, err = mgo.DialWithInfo(dailInfo)
 	if err != nil {
-		panic(err)
+		fatal(fmt.Errorf("connect to mongo %s: %v", MongoAddr, err))
 	}
 
 	// mgo.Strong
@@ -86,6 +111,15 @@ func init() {
 	// mgo.Eventual
 	// session 的读操作会向任意的其他服务器发起，多次读操作并不一定使用相同的连接，也就是读操作不一定有序。session 的写操作总是向主服务器发起，但是可能使用不同的连接，也就是写操作也不一定有序。
 	MongoSession.SetMode(mgo.Eventual, true)
+	// mgo 不支持 context，用超时限制每次库操作，保证关闭时不会被卡住的操作拖过 shutdown 期限
+	MongoSession.SetSyncTimeout(MongoOpTimeout)
+	MongoSession.SetSocketTimeout(MongoOpTimeout)
+
+	Logger.Info("hello world", zap.String("config", Path))
+}
 
-	Logger.Info("hello world")
+// fatal : print err to stderr and exit, before the services start
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
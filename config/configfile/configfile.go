@@ -0,0 +1,377 @@
+// Package configfile reads the settings of the HTTP service from a YAML file and env vars.
+// It does not connect to anything, so the config can be validated without the services.
+package configfile
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// criticalities : valid keys of NoticeConfig.Days, same as model.Criticality
+var criticalities = []string{"low", "medium", "high", "critical"}
+
+// protocols : valid ModuleConfig.Protocol, same as probe.Module
+var protocols = []string{"tls", "smtp", "imap", "pop3", "ftp", "postgres"}
+
+var invalidMetricLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// MetricLabelName : prometheus label of host label key, label_<key> with invalid characters replaced by _
+func MetricLabelName(key string) string {
+	return "label_" + invalidMetricLabelChars.ReplaceAllString(key, "_")
+}
+
+// File : format of the config file at CONFIGFILE, the env var of each setting overrides it
+//
+//	listen: ":8888"
+//	message:
+//	  app_id: certs
+//	  app_key: secret
+//	  address: https://message.ifengidc.com
+//	mongo:
+//	  addr: mongo-1:27017,mongo-2:27017
+//	  database: certs
+//	  username: certs
+//	  password: secret
+//	probe:
+//	  concurrency: 8
+//	  ocsp: true
+//	  crl: true
+//	  modules:
+//	    internal_tls:
+//	      protocol: tls
+//	      timeout: 5s
+//	      root_cas: /etc/certs/internal-ca.pem
+//	      server_name: gateway.internal
+//	notice:
+//	  time_hours: 10
+//	  days: {low: 14, medium: 30, high: 45, critical: 60}
+//	  ca_days: 150
+//	  staple_stale_hours: 24
+//	  policy_file: /etc/certs/policies.yaml
+//	metrics:
+//	  labels: [env, service]
+//	agents:
+//	  idc-bj: token1
+type File struct {
+	// Listen : LISTEN
+	Listen     string           `yaml:"listen"`
+	Message    MessageConfig    `yaml:"message"`
+	Mongo      MongoConfig      `yaml:"mongo"`
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+	Probe      ProbeConfig      `yaml:"probe"`
+	Notice     NoticeConfig     `yaml:"notice"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	// Agents : token of each probe agent by vantage name, AGENTTOKENS=name:token,...
+	Agents map[string]string `yaml:"agents"`
+}
+
+// MessageConfig : message gateway, MESSAGEAPPID, MESSAGEAPPKEY, MESSAGEADDRESS
+type MessageConfig struct {
+	AppID   string `yaml:"app_id"`
+	AppKey  string `yaml:"app_key"`
+	Address string `yaml:"address"`
+}
+
+// MongoConfig : MONGOADDR, MONGODATABASE, MONGOUSERNAME, MONGOPASSWORD
+type MongoConfig struct {
+	// Addr : host:port separated by commas
+	Addr     string `yaml:"addr"`
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// KubernetesConfig : KUBECONFIG, KUBECONTEXT, KUBEINCLUSTER
+type KubernetesConfig struct {
+	Config    string `yaml:"kubeconfig"`
+	Context   string `yaml:"context"`
+	InCluster bool   `yaml:"in_cluster"`
+}
+
+// ProbeConfig : PROBECONCURRENCY, PROBEOCSP, PROBECRL
+type ProbeConfig struct {
+	Concurrency int `yaml:"concurrency"`
+	// OCSP, CRL : query the OCSP responder and the CRL of certs besides the stapled OCSP response
+	OCSP bool `yaml:"ocsp"`
+	CRL  bool `yaml:"crl"`
+	// Modules : probe modules by name, added to the built-in modules or replacing them
+	Modules map[string]ModuleConfig `yaml:"modules"`
+}
+
+// ModuleConfig : how to connect to a probe target, see probe.Module
+type ModuleConfig struct {
+	// Protocol : tls, or STARTTLS variant smtp|imap|pop3|ftp|postgres
+	Protocol string `yaml:"protocol"`
+	// Timeout : such as 10s, zero means the timeout of the tls module
+	Timeout time.Duration `yaml:"timeout"`
+	// RootCAs : PEM file of trust roots, empty means system roots
+	RootCAs string `yaml:"root_cas"`
+	// ServerName : SNI, empty means target host
+	ServerName string `yaml:"server_name"`
+}
+
+// NoticeConfig : NOTICETIMEHOURS, STAPLESTALEHOURS, NOTICEPOLICY
+type NoticeConfig struct {
+	// TimeHours : hour of the day reminders are sent
+	TimeHours int `yaml:"time_hours"`
+	// Days : days before expiry to notice by criticality, when no policy sets them.
+	// Criticalities the file leaves out keep their default.
+	Days   map[string]int `yaml:"days"`
+	CADays int            `yaml:"ca_days"`
+	// StapleStaleHours : notice when a stapled OCSP response is closer to its nextUpdate
+	StapleStaleHours float64 `yaml:"staple_stale_hours"`
+	PolicyFile       string  `yaml:"policy_file"`
+}
+
+// MetricsConfig : METRICLABELS
+type MetricsConfig struct {
+	// Labels : host label keys exported on cert_host_info
+	Labels []string `yaml:"labels"`
+}
+
+// ValidationError : every invalid setting of a config
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// Default : settings when neither the file nor env vars set them
+func Default() File {
+	return File{
+		Listen:  ":8888",
+		Message: MessageConfig{Address: "https://message.ifengidc.com"},
+		Probe:   ProbeConfig{Concurrency: 8, OCSP: true, CRL: true},
+		Notice: NoticeConfig{
+			TimeHours:        10,
+			Days:             map[string]int{"low": 14, "medium": 30, "high": 45, "critical": 60},
+			CADays:           5 * 30,
+			StapleStaleHours: 24,
+		},
+		Agents: map[string]string{},
+	}
+}
+
+// Load : read path if not empty, apply env overrides and validate
+func Load(path string) (File, error) {
+	f := Default()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return f, err
+		}
+		// UnmarshalStrict 不允许覆盖 map 中已有的 key，days 在解析后再补全默认值
+		defaultDays := f.Notice.Days
+		f.Notice.Days = nil
+		if err := yaml.UnmarshalStrict(data, &f); err != nil {
+			return f, fmt.Errorf("%s: %v", path, err)
+		}
+		if f.Notice.Days == nil {
+			f.Notice.Days = map[string]int{}
+		}
+		for key, days := range defaultDays {
+			if _, ok := f.Notice.Days[key]; !ok {
+				f.Notice.Days[key] = days
+			}
+		}
+	}
+	errs := ValidationError{}
+	f.applyEnv(&errs)
+	f.validate(&errs)
+	if len(errs) > 0 {
+		return f, errs
+	}
+	return f, nil
+}
+
+// applyEnv : override settings set by env vars
+func (f *File) applyEnv(errs *ValidationError) {
+	str := func(name string, v *string) {
+		if s := os.Getenv(name); s != "" {
+			*v = s
+		}
+	}
+	num := func(name string, v *int) {
+		if s := os.Getenv(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: %q is not a number", name, s))
+				return
+			}
+			*v = n
+		}
+	}
+
+	str("LISTEN", &f.Listen)
+	str("MESSAGEAPPID", &f.Message.AppID)
+	str("MESSAGEAPPKEY", &f.Message.AppKey)
+	str("MESSAGEADDRESS", &f.Message.Address)
+	str("MONGOADDR", &f.Mongo.Addr)
+	str("MONGODATABASE", &f.Mongo.Database)
+	str("MONGOUSERNAME", &f.Mongo.Username)
+	str("MONGOPASSWORD", &f.Mongo.Password)
+	str("KUBECONFIG", &f.Kubernetes.Config)
+	str("KUBECONTEXT", &f.Kubernetes.Context)
+	flag := func(name string, v *bool) {
+		if s := os.Getenv(name); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: %q is not a boolean", name, s))
+				return
+			}
+			*v = b
+		}
+	}
+	flag("KUBEINCLUSTER", &f.Kubernetes.InCluster)
+	num("PROBECONCURRENCY", &f.Probe.Concurrency)
+	flag("PROBEOCSP", &f.Probe.OCSP)
+	flag("PROBECRL", &f.Probe.CRL)
+	num("NOTICETIMEHOURS", &f.Notice.TimeHours)
+	if s := os.Getenv("STAPLESTALEHOURS"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("STAPLESTALEHOURS: %q is not a number", s))
+		} else {
+			f.Notice.StapleStaleHours = v
+		}
+	}
+	str("NOTICEPOLICY", &f.Notice.PolicyFile)
+
+	if s := os.Getenv("METRICLABELS"); s != "" {
+		f.Metrics.Labels = nil
+		for _, key := range strings.Split(s, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				f.Metrics.Labels = append(f.Metrics.Labels, key)
+			}
+		}
+	}
+
+	if s := os.Getenv("AGENTTOKENS"); s != "" {
+		f.Agents = map[string]string{}
+		for _, pair := range strings.Split(s, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				*errs = append(*errs, fmt.Sprintf("AGENTTOKENS: %q is not name:token", pair))
+				continue
+			}
+			f.Agents[kv[0]] = kv[1]
+		}
+	}
+}
+
+// validate : append a message for every invalid setting
+func (f *File) validate(errs *ValidationError) {
+	add := func(format string, args ...interface{}) {
+		*errs = append(*errs, fmt.Sprintf(format, args...))
+	}
+	for _, r := range []struct{ name, value string }{
+		{"listen (LISTEN)", f.Listen},
+		{"message.app_id (MESSAGEAPPID)", f.Message.AppID},
+		{"message.app_key (MESSAGEAPPKEY)", f.Message.AppKey},
+		{"message.address (MESSAGEADDRESS)", f.Message.Address},
+		{"mongo.addr (MONGOADDR)", f.Mongo.Addr},
+		{"mongo.database (MONGODATABASE)", f.Mongo.Database},
+		{"mongo.username (MONGOUSERNAME)", f.Mongo.Username},
+		{"mongo.password (MONGOPASSWORD)", f.Mongo.Password},
+	} {
+		if r.value == "" {
+			add("%s is required", r.name)
+		}
+	}
+
+	if f.Message.Address != "" && !strings.HasPrefix(f.Message.Address, "http://") && !strings.HasPrefix(f.Message.Address, "https://") {
+		add("message.address (MESSAGEADDRESS): %q is not an http(s) url", f.Message.Address)
+	}
+	if f.Probe.Concurrency < 1 {
+		add("probe.concurrency (PROBECONCURRENCY): must be at least 1, got %d", f.Probe.Concurrency)
+	}
+	for name, m := range f.Probe.Modules {
+		switch {
+		case name == "":
+			add("probe.modules: module name is empty")
+		case !containsString(protocols, m.Protocol):
+			add("probe.modules.%s.protocol: %q is not one of %s", name, m.Protocol, strings.Join(protocols, ", "))
+		case m.Timeout < 0:
+			add("probe.modules.%s.timeout: must not be negative, got %v", name, m.Timeout)
+		}
+		if m.RootCAs != "" {
+			if data, err := ioutil.ReadFile(m.RootCAs); err != nil {
+				add("probe.modules.%s.root_cas: %v", name, err)
+			} else if !x509.NewCertPool().AppendCertsFromPEM(data) {
+				add("probe.modules.%s.root_cas: no certificates found in %s", name, m.RootCAs)
+			}
+		}
+	}
+	if f.Notice.TimeHours < 0 || f.Notice.TimeHours > 23 {
+		add("notice.time_hours (NOTICETIMEHOURS): must be between 0 and 23, got %d", f.Notice.TimeHours)
+	}
+	for key, days := range f.Notice.Days {
+		if !containsString(criticalities, key) {
+			add("notice.days: unknown criticality %q, must be one of %s", key, strings.Join(criticalities, ", "))
+		} else if days < 0 {
+			add("notice.days.%s: must not be negative, got %d", key, days)
+		}
+	}
+	if f.Notice.CADays < 0 {
+		add("notice.ca_days: must not be negative, got %d", f.Notice.CADays)
+	}
+	if f.Notice.StapleStaleHours < 0 {
+		add("notice.staple_stale_hours (STAPLESTALEHOURS): must not be negative, got %v", f.Notice.StapleStaleHours)
+	}
+	// 重复的 label 会让 metrics 注册时 panic
+	labelKeys := map[string]string{}
+	for _, key := range f.Metrics.Labels {
+		name := MetricLabelName(key)
+		switch other, ok := labelKeys[name]; {
+		case key == "":
+			add("metrics.labels (METRICLABELS): empty label key")
+		case ok && other == key:
+			add("metrics.labels (METRICLABELS): duplicate label key %q", key)
+		case ok:
+			add("metrics.labels (METRICLABELS): %q and %q are both exported as %s", other, key, name)
+		default:
+			labelKeys[name] = key
+		}
+	}
+	// token 相同的 agent 可以冒充彼此
+	tokenAgents := map[string][]string{}
+	for name, token := range f.Agents {
+		switch {
+		case name == "":
+			add("agents: agent name is empty")
+		case name == "central":
+			add("agents: central is the vantage of the service itself and cannot be an agent")
+		case token == "":
+			add("agents.%s: token is empty", name)
+		default:
+			tokenAgents[token] = append(tokenAgents[token], name)
+		}
+	}
+	for _, names := range tokenAgents {
+		if len(names) > 1 {
+			sort.Strings(names)
+			add("agents: %s share a token, each agent needs its own", strings.Join(names, ", "))
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
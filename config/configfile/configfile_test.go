@@ -0,0 +1,274 @@
+package configfile
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validFile : defaults with the required settings filled in
+func validFile() File {
+	f := Default()
+	f.Message.AppID, f.Message.AppKey = "certs", "key"
+	f.Mongo = MongoConfig{Addr: "127.0.0.1:27017", Database: "certs", Username: "certs", Password: "secret"}
+	return f
+}
+
+// testRootPEM : self-signed CA cert in PEM
+func testRootPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Internal Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// setenv : set env var name for the duration of the test
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := write("valid.yaml", `
+listen: ":9000"
+message: {app_id: certs, app_key: key}
+mongo: {addr: "127.0.0.1:27017", database: certs, username: certs, password: secret}
+notice:
+  days: {critical: 90}
+metrics:
+  labels: [env]
+agents:
+  idc-bj: token1
+`)
+
+	for _, tt := range []struct {
+		name  string
+		path  string
+		env   map[string]string
+		check func(f File) bool
+		err   string
+	}{
+		{
+			name: "file",
+			path: valid,
+			check: func(f File) bool {
+				return f.Listen == ":9000" && f.Probe.Concurrency == 8 && f.Probe.OCSP &&
+					reflect.DeepEqual(f.Notice.Days, map[string]int{"low": 14, "medium": 30, "high": 45, "critical": 90}) &&
+					reflect.DeepEqual(f.Agents, map[string]string{"idc-bj": "token1"})
+			},
+		},
+		{
+			name: "env overrides file",
+			path: valid,
+			env: map[string]string{
+				"LISTEN": ":9100", "PROBECONCURRENCY": "16", "PROBEOCSP": "0", "PROBECRL": "TRUE", "KUBEINCLUSTER": "1",
+				"STAPLESTALEHOURS": "12.5", "METRICLABELS": " env, service ,", "AGENTTOKENS": "idc-sh:token2",
+			},
+			check: func(f File) bool {
+				return f.Listen == ":9100" && f.Probe.Concurrency == 16 && !f.Probe.OCSP && f.Probe.CRL &&
+					f.Kubernetes.InCluster && f.Notice.StapleStaleHours == 12.5 &&
+					reflect.DeepEqual(f.Metrics.Labels, []string{"env", "service"}) &&
+					reflect.DeepEqual(f.Agents, map[string]string{"idc-sh": "token2"})
+			},
+		},
+		{
+			name: "env only",
+			env:  map[string]string{"MESSAGEAPPID": "certs", "MESSAGEAPPKEY": "key", "MONGOADDR": "mongo:27017", "MONGODATABASE": "certs", "MONGOUSERNAME": "certs", "MONGOPASSWORD": "secret"},
+			check: func(f File) bool {
+				return f.Listen == ":8888" && f.Mongo.Addr == "mongo:27017" && f.Message.Address == "https://message.ifengidc.com"
+			},
+		},
+		{name: "missing file", path: filepath.Join(dir, "missing.yaml"), err: "no such file"},
+		{name: "unknown field", path: write("unknown.yaml", "listen: \":9000\"\nlisten_addr: \":9000\"\n"), err: "field listen_addr not found"},
+		{name: "required", path: write("empty.yaml", "listen: \":9000\"\n"), err: "mongo.addr (MONGOADDR) is required"},
+		{name: "bad number", path: valid, env: map[string]string{"PROBECONCURRENCY": "eight"}, err: `PROBECONCURRENCY: "eight" is not a number`},
+		{name: "bad float", path: valid, env: map[string]string{"STAPLESTALEHOURS": "1d"}, err: `STAPLESTALEHOURS: "1d" is not a number`},
+		{name: "bad boolean", path: valid, env: map[string]string{"PROBEOCSP": "yes"}, err: `PROBEOCSP: "yes" is not a boolean`},
+		{name: "bad agent tokens", path: valid, env: map[string]string{"AGENTTOKENS": "idc-sh"}, err: `AGENTTOKENS: "idc-sh" is not name:token`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				setenv(t, name, value)
+			}
+			f, err := Load(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load() err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() err = %v", err)
+			}
+			if !tt.check(f) {
+				t.Errorf("Load() = %+v", f)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(f *File)
+		err    string
+	}{
+		{name: "valid", modify: func(f *File) {}},
+		{name: "bad message address", modify: func(f *File) { f.Message.Address = "message.ifengidc.com" }, err: "is not an http(s) url"},
+		{name: "concurrency", modify: func(f *File) { f.Probe.Concurrency = 0 }, err: "probe.concurrency (PROBECONCURRENCY): must be at least 1"},
+		{name: "notice hour", modify: func(f *File) { f.Notice.TimeHours = 24 }, err: "must be between 0 and 23, got 24"},
+		{name: "unknown criticality", modify: func(f *File) { f.Notice.Days["urgent"] = 7 }, err: `unknown criticality "urgent"`},
+		{name: "negative days", modify: func(f *File) { f.Notice.Days["low"] = -1 }, err: "notice.days.low: must not be negative"},
+		{name: "negative ca days", modify: func(f *File) { f.Notice.CADays = -1 }, err: "notice.ca_days: must not be negative"},
+		{name: "negative staple hours", modify: func(f *File) { f.Notice.StapleStaleHours = -1 }, err: "notice.staple_stale_hours"},
+		{name: "central agent", modify: func(f *File) { f.Agents["central"] = "token" }, err: "central is the vantage of the service itself"},
+		{name: "empty agent token", modify: func(f *File) { f.Agents["idc-bj"] = "" }, err: "agents.idc-bj: token is empty"},
+		{name: "distinct agent tokens", modify: func(f *File) { f.Agents["idc-bj"], f.Agents["idc-sh"] = "token1", "token2" }},
+		{
+			name: "shared agent token",
+			modify: func(f *File) {
+				f.Agents["idc-sh"], f.Agents["idc-bj"], f.Agents["idc-gz"] = "token1", "token1", "token2"
+			},
+			err: "agents: idc-bj, idc-sh share a token",
+		},
+		{
+			name:   "every error",
+			modify: func(f *File) { f.Mongo.Password = ""; f.Probe.Concurrency = 0; f.Notice.CADays = -1 },
+			err:    "mongo.password (MONGOPASSWORD) is required\n  - probe.concurrency (PROBECONCURRENCY): must be at least 1, got 0\n  - notice.ca_days",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := validFile()
+			tt.modify(&f)
+			errs := ValidationError{}
+			f.validate(&errs)
+			switch {
+			case tt.err == "" && len(errs) > 0:
+				t.Errorf("unexpected errors %v", errs)
+			case tt.err != "" && !strings.Contains(errs.Error(), tt.err):
+				t.Errorf("errors %v, want %q", errs, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateMetricLabels(t *testing.T) {
+	for _, tt := range []struct {
+		labels []string
+		err    string
+	}{
+		{labels: nil},
+		{labels: []string{"env", "app.kubernetes.io/name"}},
+		{labels: []string{"env", "env"}, err: `duplicate label key "env"`},
+		{labels: []string{"a-b", "a_b"}, err: `"a-b" and "a_b" are both exported as label_a_b`},
+		{labels: []string{""}, err: "empty label key"},
+	} {
+		f := validFile()
+		f.Metrics.Labels = tt.labels
+		errs := ValidationError{}
+		f.validate(&errs)
+		switch {
+		case tt.err == "" && len(errs) > 0:
+			t.Errorf("labels %q: unexpected errors %v", tt.labels, errs)
+		case tt.err != "" && !strings.Contains(errs.Error(), tt.err):
+			t.Errorf("labels %q: errors %v, want %q", tt.labels, errs, tt.err)
+		}
+	}
+}
+
+func TestLoadModules(t *testing.T) {
+	dir := t.TempDir()
+	rootCAs := filepath.Join(dir, "internal-ca.pem")
+	if err := ioutil.WriteFile(rootCAs, testRootPEM(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	data := `
+message: {app_id: certs, app_key: key}
+mongo: {addr: "127.0.0.1:27017", database: certs, username: certs, password: secret}
+probe:
+  modules:
+    internal_tls:
+      protocol: tls
+      timeout: 5s
+      root_cas: ` + rootCAs + `
+      server_name: gateway.internal
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ModuleConfig{Protocol: "tls", Timeout: 5 * time.Second, RootCAs: rootCAs, ServerName: "gateway.internal"}
+	if got := f.Probe.Modules["internal_tls"]; got != want {
+		t.Errorf("internal_tls = %+v, want %+v", got, want)
+	}
+
+	for _, tt := range []struct {
+		module ModuleConfig
+		err    string
+	}{
+		{module: ModuleConfig{Protocol: "smtp"}},
+		{module: ModuleConfig{Protocol: "http"}, err: `probe.modules.m.protocol: "http" is not one of`},
+		{module: ModuleConfig{Protocol: "tls", Timeout: -time.Second}, err: "probe.modules.m.timeout"},
+		{module: ModuleConfig{Protocol: "tls", RootCAs: filepath.Join(dir, "missing.pem")}, err: "probe.modules.m.root_cas"},
+		{module: ModuleConfig{Protocol: "tls", RootCAs: path}, err: "no certificates found"},
+	} {
+		f := validFile()
+		f.Probe.Modules = map[string]ModuleConfig{"m": tt.module}
+		errs := ValidationError{}
+		f.validate(&errs)
+		switch {
+		case tt.err == "" && len(errs) > 0:
+			t.Errorf("module %+v: unexpected errors %v", tt.module, errs)
+		case tt.err != "" && !strings.Contains(errs.Error(), tt.err):
+			t.Errorf("module %+v: errors %v, want %q", tt.module, errs, tt.err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"git.ifengidc.com/likuo/go-check-certs/config/configfile"
+)
+
+// File, NoticeConfig : see package configfile
+type (
+	File         = configfile.File
+	NoticeConfig = configfile.NoticeConfig
+)
+
+var (
+	// Load : see configfile.Load
+	Load = configfile.Load
+	// MetricLabelName : see configfile.MetricLabelName
+	MetricLabelName = configfile.MetricLabelName
+)
+
+// Live : settings applied on reload without a restart, read with Settings
+type Live struct {
+	Notice NoticeConfig
+	Agents map[string]string
+}
+
+var (
+	// Path : config file, empty if only env vars are used
+	Path = ""
+
+	current  File
+	liveLock sync.RWMutex
+)
+
+// Settings : current settings that can change on reload
+func Settings() Live {
+	liveLock.RLock()
+	defer liveLock.RUnlock()
+	return Live{Notice: current.Notice, Agents: current.Agents}
+}
+
+// Reload : read Path again and apply the settings that can change live. Returns the settings
+// that changed but only apply after a restart. The current settings are kept if the file is invalid.
+func Reload() ([]string, error) {
+	f, err := Load(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	liveLock.Lock()
+	defer liveLock.Unlock()
+	restart := []string{}
+	for name, changed := range map[string]bool{
+		"listen":     f.Listen != current.Listen,
+		"message":    f.Message != current.Message,
+		"mongo":      f.Mongo != current.Mongo,
+		"kubernetes": f.Kubernetes != current.Kubernetes,
+		"probe":      !reflect.DeepEqual(f.Probe, current.Probe),
+		"metrics":    !reflect.DeepEqual(f.Metrics, current.Metrics),
+	} {
+		if changed {
+			restart = append(restart, name)
+		}
+	}
+	sort.Strings(restart)
+	// 需要重启的配置保持不变，只替换可实时生效的部分
+	current.Notice = f.Notice
+	current.Agents = f.Agents
+	return restart, nil
+}
@@ -0,0 +1,38 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ctEntry : one certificate of a crt.sh JSON export (https://crt.sh/?q=%25.example.com&output=json)
+type ctEntry struct {
+	CommonName string `json:"common_name"`
+	// NameValue : SAN names separated by new line
+	NameValue string `json:"name_value"`
+}
+
+// ParseCTExport : host names of certificates in a crt.sh JSON export that belong to
+// one of the apex domains. Wildcard names and e-mail addresses are skipped.
+func ParseCTExport(data []byte, apexes []string) ([]string, error) {
+	if len(apexes) == 0 {
+		return nil, fmt.Errorf("no apex domain given")
+	}
+	var entries []ctEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid crt.sh export: %v", err)
+	}
+	names := newNameSet()
+	for _, e := range entries {
+		candidates := append(strings.Split(e.NameValue, "\n"), e.CommonName)
+		for _, name := range candidates {
+			name = canonicalName(name)
+			if strings.Contains(name, "@") || !InDomains(name, apexes) {
+				continue
+			}
+			names.add(name)
+		}
+	}
+	return names.list(), nil
+}
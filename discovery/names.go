@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"sort"
+	"strings"
+)
+
+// canonicalName : lower case without trailing dot
+func canonicalName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// isHostName : name can be probed, wildcards, service labels and addresses are not
+func isHostName(name string) bool {
+	if name == "" || len(name) > 253 || !strings.Contains(name, ".") {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// InDomains : name is one of the apex domains or a subdomain of them
+func InDomains(name string, apexes []string) bool {
+	for _, apex := range apexes {
+		apex = canonicalName(apex)
+		if name == apex || strings.HasSuffix(name, "."+apex) {
+			return true
+		}
+	}
+	return false
+}
+
+type nameSet map[string]struct{}
+
+func newNameSet() nameSet {
+	return nameSet{}
+}
+
+func (s nameSet) add(name string) {
+	name = canonicalName(name)
+	if isHostName(name) {
+		s[name] = struct{}{}
+	}
+}
+
+func (s nameSet) list() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// hostTypes : record types whose owner name is a host that may serve TLS
+var hostTypes = map[string]bool{"A": true, "AAAA": true, "CNAME": true}
+
+var zoneClasses = map[string]bool{"IN": true, "CH": true, "HS": true, "CS": true}
+
+// ParseZone : host names of A, AAAA and CNAME records in a BIND zone file or AXFR
+// dump (dig output). Relative names are completed with origin, which can be
+// overridden by $ORIGIN. Wildcard and service (underscore) names are skipped.
+func ParseZone(r io.Reader, origin string) ([]string, error) {
+	origin = canonicalName(origin)
+	names := newNameSet()
+	owner := ""
+	lineNum := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for {
+		record, startLine, err := nextRecord(scanner, &lineNum)
+		if err != nil {
+			return nil, err
+		}
+		if record == "" {
+			break
+		}
+		fields := strings.Fields(record)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN without name", startLine)
+			}
+			origin = absoluteName(fields[1], origin)
+			continue
+		case "$TTL", "$INCLUDE", "$GENERATE":
+			continue
+		}
+
+		// 行首为空白时沿用上一条记录的 owner
+		if record[0] != ' ' && record[0] != '\t' {
+			owner = absoluteName(fields[0], origin)
+			fields = fields[1:]
+		}
+		for len(fields) > 0 && (isTTL(fields[0]) || zoneClasses[strings.ToUpper(fields[0])]) {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: record without type", startLine)
+		}
+		if owner == "" {
+			return nil, fmt.Errorf("line %d: record without owner name", startLine)
+		}
+		if hostTypes[strings.ToUpper(fields[0])] {
+			names.add(owner)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names.list(), nil
+}
+
+// nextRecord : join lines of a record spanning parentheses and strip comments
+func nextRecord(scanner *bufio.Scanner, lineNum *int) (string, int, error) {
+	record := ""
+	depth := 0
+	startLine := 0
+	for scanner.Scan() {
+		*lineNum++
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" && depth == 0 {
+			continue
+		}
+		if startLine == 0 {
+			startLine = *lineNum
+		}
+		depth += strings.Count(line, "(") - strings.Count(line, ")")
+		if record == "" {
+			record = line
+		} else {
+			record += " " + line
+		}
+		if depth <= 0 {
+			return strings.NewReplacer("(", " ", ")", " ").Replace(record), startLine, nil
+		}
+	}
+	if depth > 0 {
+		return "", 0, fmt.Errorf("line %d: unbalanced parentheses", startLine)
+	}
+	return "", 0, nil
+}
+
+// stripComment : remove ; comment outside of quoted strings
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// isTTL : 3600, 1h, 1h30m
+func isTTL(s string) bool {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if (c < '0' || c > '9') && !strings.ContainsRune("smhdw", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// absoluteName : complete relative name with origin, @ is origin itself
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return canonicalName(name)
+	case origin == "":
+		return canonicalName(name)
+	}
+	return canonicalName(name) + "." + origin
+}
@@ -0,0 +1,102 @@
+package election
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store : leases shared by the replicas, see model.LeaseStore
+type Store interface {
+	// Acquire : renew lease name if holder holds it, or take it over if it is free or expired.
+	// Returns false if another holder holds it.
+	Acquire(name, holder string, ttl time.Duration) (bool, error)
+	// Release : give up lease name if holder holds it
+	Release(name, holder string) error
+	// Runs : last run of each job done under lease name
+	Runs(name string) (map[string]time.Time, error)
+	// MarkRun : record that job ran at t under lease name
+	MarkRun(name, job string, t time.Time) error
+}
+
+// Elector : keep trying to hold lease Name as ID, only the holder runs the jobs
+type Elector struct {
+	Store Store
+	Name  string
+	ID    string
+	// TTL : a lease not renewed for TTL is taken over by another replica
+	TTL time.Duration
+	// OnChange : called when leadership is gained or lost, not concurrently
+	OnChange func(leading bool)
+
+	mu      sync.Mutex
+	leading int32
+}
+
+// IsLeader : whether the lease was held at the last renewal
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+// set : record leadership and call OnChange if it changed
+func (e *Elector) set(leading bool) {
+	var v int32
+	if leading {
+		v = 1
+	}
+	if atomic.SwapInt32(&e.leading, v) != v && e.OnChange != nil {
+		e.OnChange(leading)
+	}
+}
+
+// Renew : acquire or renew the lease once, leadership is dropped if the lease cannot be renewed
+func (e *Elector) Renew() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ok, err := e.Store.Acquire(e.Name, e.ID, e.TTL)
+	e.set(ok && err == nil)
+	return err
+}
+
+// Run : Renew every interval until stop is closed, errors go to onError
+func (e *Elector) Run(stop <-chan struct{}, interval time.Duration, onError func(error)) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+		if err := e.Renew(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Release : give up the lease if held, so another replica takes over without waiting for it to expire.
+// Returns false if it was not held.
+func (e *Elector) Release() (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.IsLeader() {
+		return false, nil
+	}
+	e.set(false)
+	return true, e.Store.Release(e.Name, e.ID)
+}
+
+// Due : whether this replica leads and job has not run under the lease for interval at now
+func (e *Elector) Due(job string, interval time.Duration, now time.Time) (bool, error) {
+	if !e.IsLeader() {
+		return false, nil
+	}
+	runs, err := e.Store.Runs(e.Name)
+	if err != nil {
+		return false, err
+	}
+	return now.Sub(runs[job]) >= interval, nil
+}
+
+// MarkRun : record the start of job so a new leader does not repeat it
+func (e *Elector) MarkRun(job string, t time.Time) error {
+	return e.Store.MarkRun(e.Name, job, t)
+}
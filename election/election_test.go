@@ -0,0 +1,219 @@
+package election
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore : Store with the rules of model.AcquireLease on a fake clock
+type memoryStore struct {
+	mu     sync.Mutex
+	now    time.Time
+	err    error
+	holder map[string]string
+	expire map[string]time.Time
+	runs   map[string]map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		now:    time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		holder: map[string]string{},
+		expire: map[string]time.Time{},
+		runs:   map[string]map[string]time.Time{},
+	}
+}
+
+func (s *memoryStore) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func (s *memoryStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	if s.holder[name] != holder && s.expire[name].After(s.now) {
+		return false, nil
+	}
+	s.holder[name], s.expire[name] = holder, s.now.Add(ttl)
+	return true, nil
+}
+
+func (s *memoryStore) Release(name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder[name] == holder {
+		s.expire[name] = s.now
+	}
+	return nil
+}
+
+func (s *memoryStore) Runs(name string) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[name], s.err
+}
+
+func (s *memoryStore) MarkRun(name, job string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runs[name] == nil {
+		s.runs[name] = map[string]time.Time{}
+	}
+	s.runs[name][job] = t
+	return nil
+}
+
+// newElector : elector id on store recording its leadership changes
+func newElector(store Store, id string) (*Elector, *[]bool) {
+	changes := []bool{}
+	return &Elector{
+		Store:    store,
+		Name:     "cron",
+		ID:       id,
+		TTL:      30 * time.Second,
+		OnChange: func(leading bool) { changes = append(changes, leading) },
+	}, &changes
+}
+
+func TestElection(t *testing.T) {
+	store := newMemoryStore()
+	a, aChanges := newElector(store, "a")
+	b, bChanges := newElector(store, "b")
+
+	step := func(name string, wantA, wantB bool) {
+		t.Helper()
+		for _, e := range []*Elector{a, b} {
+			if err := e.Renew(); err != nil {
+				t.Fatalf("%s: Renew() err = %v", name, err)
+			}
+		}
+		if a.IsLeader() != wantA || b.IsLeader() != wantB {
+			t.Fatalf("%s: leaders a = %v, b = %v, want %v, %v", name, a.IsLeader(), b.IsLeader(), wantA, wantB)
+		}
+	}
+
+	step("acquire", true, false)
+	store.advance(10 * time.Second)
+	step("renew", true, false)
+	// a renewed 10s ago, its lease runs until 40s
+	store.advance(25 * time.Second)
+	if err := b.Renew(); err != nil || b.IsLeader() {
+		t.Fatalf("b took a renewed lease: leading = %v, err = %v", b.IsLeader(), err)
+	}
+
+	// a stops renewing, b takes over once the lease expires
+	store.advance(5 * time.Second)
+	if err := b.Renew(); err != nil || !b.IsLeader() {
+		t.Fatalf("b did not take over the expired lease: leading = %v, err = %v", b.IsLeader(), err)
+	}
+	step("a loses on its next renewal", false, true)
+
+	// b hands over on shutdown, a takes it without waiting for the expiry
+	if released, err := b.Release(); !released || err != nil {
+		t.Fatalf("Release() = %v, %v, want true", released, err)
+	}
+	if released, err := b.Release(); released || err != nil {
+		t.Fatalf("second Release() = %v, %v, want false", released, err)
+	}
+	step("takeover after release", true, false)
+
+	if want := []bool{true, false, true}; !reflect.DeepEqual(*aChanges, want) {
+		t.Errorf("a changes = %v, want %v", *aChanges, want)
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(*bChanges, want) {
+		t.Errorf("b changes = %v, want %v", *bChanges, want)
+	}
+}
+
+func TestRenewError(t *testing.T) {
+	store := newMemoryStore()
+	e, changes := newElector(store, "a")
+	if err := e.Renew(); err != nil || !e.IsLeader() {
+		t.Fatalf("Renew() = %v, leading = %v", err, e.IsLeader())
+	}
+	store.err = errors.New("no reachable servers")
+	if err := e.Renew(); err != store.err {
+		t.Errorf("Renew() err = %v, want %v", err, store.err)
+	}
+	if e.IsLeader() {
+		t.Error("leadership kept although the lease could not be renewed")
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(*changes, want) {
+		t.Errorf("changes = %v, want %v", *changes, want)
+	}
+}
+
+func TestDue(t *testing.T) {
+	store := newMemoryStore()
+	e, _ := newElector(store, "a")
+	now := store.now
+	if ok, err := e.Due("notice", time.Hour, now); ok || err != nil {
+		t.Fatalf("Due() before leading = %v, %v, want false", ok, err)
+	}
+	e.Renew()
+	if ok, _ := e.Due("notice", time.Hour, now); !ok {
+		t.Error("Due() of a job that never ran = false")
+	}
+	if err := e.MarkRun("notice", now); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{now: now.Add(59 * time.Minute)},
+		{now: now.Add(time.Hour), want: true},
+	} {
+		if ok, _ := e.Due("notice", time.Hour, tt.now); ok != tt.want {
+			t.Errorf("Due() at %s = %v, want %v", tt.now, ok, tt.want)
+		}
+	}
+
+	// runs are kept across holders, a new leader does not repeat the job
+	e.Release()
+	next, _ := newElector(store, "b")
+	next.Renew()
+	if ok, _ := next.Due("notice", time.Hour, now.Add(time.Minute)); ok {
+		t.Error("new leader repeats a job run a minute ago")
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := newMemoryStore()
+	store.err = errors.New("no reachable servers")
+	e, _ := newElector(store, "a")
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(stop, time.Millisecond, func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})
+	}()
+	select {
+	case err := <-errs:
+		if err != store.err {
+			t.Errorf("onError(%v), want %v", err, store.err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Run() did not renew")
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return after stop")
+	}
+}
@@ -1,9 +1,12 @@
 module git.ifengidc.com/likuo/go-check-certs
 
-go 1.15
+go 1.16
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/prometheus/client_golang v1.12.2
 	go.uber.org/zap v1.21.0
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+	gopkg.in/yaml.v2 v2.4.0
 )
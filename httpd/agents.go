@@ -0,0 +1,265 @@
+package httpd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxAgentReportSize : body limit of pushed results
+	maxAgentReportSize = 32 << 20
+)
+
+// agentHandle : handler of a probe agent, authenticated by its bearer token
+type agentHandle func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, vantage string)
+
+// AgentReportResult : reports stored, and hosts rejected because they are not assigned to the agent
+type AgentReportResult struct {
+	Accepted int      `json:"accepted"`
+	Rejected []string `json:"rejected"`
+}
+
+// HostVantagesRequest : set vantage points of a host, empty means central only
+type HostVantagesRequest struct {
+	Vantages []string `json:"vantages"`
+}
+
+// HostVantages : last results of a host from each vantage point
+type HostVantages struct {
+	Host        string                     `json:"host"`
+	Vantages    []string                   `json:"vantages"`
+	Discrepancy string                     `json:"discrepancy,omitempty"`
+	Results     []model.VantageResultModel `json:"results"`
+}
+
+// agentRoutes : probe agent routes of /api/v1
+func (s *Service) agentRoutes() []apiRoute {
+	idParam := apiParam{Name: "id", In: "path", Description: "host id, or the host name", Required: true}
+	unauthorized := apiResponse{Status: http.StatusUnauthorized, Description: "missing or unknown agent token", Body: APIError{}}
+	notFound := apiResponse{Status: http.StatusNotFound, Description: "host not found", Body: APIError{}}
+	badRequest := apiResponse{Status: http.StatusBadRequest, Description: "invalid arguments", Body: APIError{}}
+	dbError := apiResponse{Status: http.StatusInternalServerError, Description: "database error", Body: APIError{}}
+
+	return []apiRoute{
+		{
+			Method: "GET", Path: "/agent/targets", Handle: s.agentAuth(s.apiAgentTargets),
+			Summary:   "Hosts assigned to the probe agent of the bearer token",
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "targets", Body: []probe.Target{}}, unauthorized, dbError},
+		},
+		{
+			Method: "POST", Path: "/agent/results", Handle: s.agentAuth(s.apiAgentResults),
+			Summary: "Push probe results of the agent of the bearer token", Body: []probe.Report{},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "results stored", Body: AgentReportResult{}}, badRequest, unauthorized, dbError},
+		},
+		{
+			Method: "GET", Path: "/hosts/:id/vantages", Handle: s.apiGetHostVantages,
+			Summary: "Get the last results of a host from each vantage point", Params: []apiParam{idParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "results by vantage point", Body: HostVantages{}}, notFound, dbError},
+		},
+		{
+			Method: "PUT", Path: "/hosts/:id/vantages", Handle: s.apiSetHostVantages,
+			Summary: "Set the vantage points probing a host, the first is primary", Params: []apiParam{idParam, uidQueryParam}, Body: HostVantagesRequest{},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the host", Body: model.CertModel{}}, badRequest, notFound, dbError},
+		},
+	}
+}
+
+// agentAuth : find the vantage point of the bearer token, or write 401
+func (s *Service) agentAuth(next agentHandle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" {
+			for name, t := range config.Settings().Agents {
+				if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+					next(w, r, ps, name)
+					return
+				}
+			}
+		}
+		writeAPIError(w, http.StatusUnauthorized, "missing or unknown agent token")
+	}
+}
+
+// validateVantages : vantages are central or configured agents, without duplicates
+func validateVantages(vantages []string) error {
+	seen := map[string]bool{}
+	for _, v := range vantages {
+		if _, ok := config.Settings().Agents[v]; !ok && v != model.CentralVantage {
+			return fmt.Errorf("unknown vantage %q", v)
+		}
+		if seen[v] {
+			return fmt.Errorf("duplicate vantage %q", v)
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+// recordVantageResult : store r as the last result of its host from vantage
+func recordVantageResult(vantage string, r HostResult) {
+	v := model.VantageResultModel{
+		Host:     r.Host,
+		Vantage:  vantage,
+		Port:     r.Port,
+		Time:     time.Now(),
+		Certs:    r.Certs,
+		Staple:   r.Staple,
+		Chain:    r.Chain,
+		Duration: r.duration.Seconds(),
+	}
+	if r.err != nil {
+		v.Error = r.err.Error()
+	}
+	if err := model.UpsertVantageResult(v); err != nil {
+		config.Logger.Error("func model.UpsertVantageResult err", zap.String("uid", vantage), zap.String("host", r.Host), zap.Error(err))
+		return
+	}
+	updateDiscrepancy(vantage, r.Host)
+}
+
+// updateDiscrepancy : compare the last results of host between its vantage points
+func updateDiscrepancy(uid, host string) {
+	c, exists, err := model.GetCertInfoByHost(host)
+	if err != nil || !exists {
+		return
+	}
+	results, err := model.GetVantageResults(host)
+	if err != nil {
+		config.Logger.Error("func model.GetVantageResults err", zap.String("uid", uid), zap.String("host", host), zap.Error(err))
+		return
+	}
+	discrepancy := model.VantageDiscrepancy(c.ProbeVantages(), results, time.Now())
+	if discrepancy == c.Discrepancy {
+		return
+	}
+	if discrepancy != "" {
+		config.Logger.Warn("vantage points disagree", zap.String("uid", uid), zap.String("host", host), zap.String("discrepancy", discrepancy))
+	}
+	if err := model.SetCertInfoDiscrepancy(host, discrepancy); err != nil {
+		config.Logger.Error("func model.SetCertInfoDiscrepancy err", zap.String("uid", uid), zap.String("host", host), zap.Error(err))
+	}
+}
+
+func (s *Service) apiAgentTargets(w http.ResponseWriter, r *http.Request, ps httprouter.Params, vantage string) {
+	certModelList, err := model.GetCertInfoListByVantage(vantage)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoListByVantage err", zap.String("uid", vantage), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	targets := []probe.Target{}
+	for _, c := range certModelList {
+		if c.Probeable() {
+			targets = append(targets, probe.Target{Host: c.Host, Port: normalizePort(c.Port)})
+		}
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
+
+func (s *Service) apiAgentResults(w http.ResponseWriter, r *http.Request, ps httprouter.Params, vantage string) {
+	reports := []probe.Report{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentReportSize)).Decode(&reports); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	config.Logger.Info("new agent results request", zap.String("uid", vantage), zap.Int("results", len(reports)))
+
+	result := AgentReportResult{Rejected: []string{}}
+	for _, report := range reports {
+		host := strings.ToLower(report.Host)
+		c, exists, err := model.GetCertInfoByHost(host)
+		if err != nil {
+			config.Logger.Error("func model.GetCertInfoByHost err", zap.String("uid", vantage), zap.String("host", host), zap.Error(err))
+			writeAPIError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if !exists || !c.ProbedFrom(vantage) {
+			result.Rejected = append(result.Rejected, report.Host)
+			continue
+		}
+
+		hr := HostResult{
+			Host:      host,
+			Port:      report.Port,
+			Certs:     report.Certs,
+			Staple:    report.Staple,
+			Chain:     report.Chain,
+			duration:  time.Duration(report.Duration * float64(time.Second)),
+			probeTime: time.Now(),
+			previous:  c,
+		}
+		if hr.Certs == nil {
+			hr.Certs = []model.CertInfo{}
+		}
+		if report.Error != "" {
+			hr.err = errors.New(report.Error)
+		}
+		recordVantageResult(vantage, hr)
+		// 主探测点的结果写入 host 和 metrics
+		if c.ProbeVantages()[0] == vantage {
+			setProbeMetrics(c, hr)
+			storeProbeResult(vantage, hr)
+		}
+		result.Accepted++
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Service) apiGetHostVantages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	results, err := model.GetVantageResults(c.Host)
+	if err != nil {
+		config.Logger.Error("func model.GetVantageResults err", zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, HostVantages{Host: c.Host, Vantages: c.ProbeVantages(), Discrepancy: c.Discrepancy, Results: results})
+}
+
+func (s *Service) apiSetHostVantages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := HostVantagesRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	if err := validateVantages(req.Vantages); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	// 只由 central 探测时不保存，与默认值一致
+	if len(req.Vantages) == 1 && req.Vantages[0] == model.CentralVantage {
+		req.Vantages = nil
+	}
+
+	actor := requestActor(r)
+	config.Logger.Info("new set host vantages request", zap.String("uid", actor), zap.String("host", c.Host), zap.Strings("vantages", req.Vantages))
+	if _, err := model.SetCertInfoVantages(c.Host, req.Vantages); err != nil {
+		config.Logger.Error("func model.SetCertInfoVantages err", zap.String("uid", actor), zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	recordAudit(actor, model.AuditUpdate, c.Host, &c)
+	updateDiscrepancy(actor, c.Host)
+	if c, ok = findHostOrError(w, c.Host); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
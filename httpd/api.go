@@ -36,8 +36,7 @@ var (
 )
 
 func (s *Service) Index(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	_, _ = w.Write([]byte("Welcome to Certificate check Tools!"))
-	return
+	s.Dashboard(w, r, ps)
 }
 
 func genResponseStr(data interface{}) []byte {
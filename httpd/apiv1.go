@@ -0,0 +1,408 @@
+package httpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/bulk"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+	"git.ifengidc.com/likuo/go-check-certs/openapi"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	apiV1Prefix = "/api/v1"
+	// defaultHistoryLimit : events returned by /hosts/:id/history without limit
+	defaultHistoryLimit = 100
+)
+
+// APIError : error body of /api/v1, the HTTP status tells the kind of error
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// HostRequest : create a host or subscribe a user to it
+type HostRequest struct {
+	Host  string   `json:"host"`
+	Port  string   `json:"port,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// HostCerts : certs and TLS findings of a host as of the last probe
+type HostCerts struct {
+	Host       string             `json:"host"`
+	Port       string             `json:"port"`
+	ExpireAt   time.Time          `json:"expire_at,omitempty"`
+	ProbeTime  time.Time          `json:"probe_time,omitempty"`
+	ProbeError string             `json:"probe_error,omitempty"`
+	Certs      []model.CertInfo   `json:"certs"`
+	Staple     model.StapleInfo   `json:"staple"`
+	Chain      []model.ChainIssue `json:"chain"`
+}
+
+// apiV1Routes : routes of /api/v1, registered by initHandler and described by the OpenAPI spec
+func (s *Service) apiV1Routes() []apiRoute {
+	idParam := apiParam{Name: "id", In: "path", Description: "host id, or the host name", Required: true}
+	uidParam := apiParam{Name: "uid", In: "path", Description: "user id", Required: true}
+	notFound := apiResponse{Status: http.StatusNotFound, Description: "host not found", Body: APIError{}}
+	badRequest := apiResponse{Status: http.StatusBadRequest, Description: "invalid arguments", Body: APIError{}}
+	dbError := apiResponse{Status: http.StatusInternalServerError, Description: "database error", Body: APIError{}}
+
+	routes := []apiRoute{
+		{
+			Method: "GET", Path: "/hosts", Handle: s.apiListHosts,
+			Summary: "List monitored hosts", Params: certQueryParams,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "a page of hosts", Body: CertInfoPage{}}, badRequest, dbError},
+		},
+		{
+			Method: "POST", Path: "/hosts", Handle: s.apiCreateHost,
+			Summary: "Monitor a host for users, or add users to a monitored host", Params: []apiParam{uidQueryParam}, Body: HostRequest{},
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "host created", Body: model.CertModel{}},
+				{Status: http.StatusOK, Description: "users added to existing host", Body: model.CertModel{}},
+				badRequest, dbError,
+			},
+		},
+		{
+			Method: "GET", Path: "/hosts/:id", Handle: s.apiGetHost,
+			Summary: "Get a monitored host", Params: []apiParam{idParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the host", Body: model.CertModel{}}, notFound, dbError},
+		},
+		{
+			Method: "DELETE", Path: "/hosts/:id", Handle: s.apiDeleteHost,
+			Summary:   "Stop monitoring a host for all users, it is archived and can be restored",
+			Params:    []apiParam{idParam, {Name: "reason", In: "query", Description: "why the host is deleted"}, uidQueryParam},
+			Responses: []apiResponse{{Status: http.StatusNoContent, Description: "host deleted"}, notFound, dbError},
+		},
+		{
+			Method: "POST", Path: "/hosts/:id/restore", Handle: s.apiRestoreHost,
+			Summary: "Restore an archived host with the users it had", Params: []apiParam{idParam, uidQueryParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the restored host", Body: model.CertModel{}}, notFound, dbError},
+		},
+		{
+			Method: "GET", Path: "/hosts/:id/certs", Handle: s.apiGetHostCerts,
+			Summary: "Get the certs of a host as of the last probe", Params: []apiParam{idParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "certs of the host", Body: HostCerts{}}, notFound, dbError},
+		},
+		{
+			Method: "GET", Path: "/hosts/:id/history", Handle: s.apiGetHostHistory,
+			Summary:   "Get cert renewals and probe failures of a host, newest first",
+			Params:    []apiParam{idParam, {Name: "limit", In: "query", Description: "number of events, default 100, at most 1000"}},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "history of the host", Body: []model.HistoryModel{}}, badRequest, notFound, dbError},
+		},
+		{
+			Method: "GET", Path: "/users/:uid/hosts", Handle: s.apiListUserHosts,
+			Summary: "List hosts a user is subscribed to", Params: append([]apiParam{uidParam}, certQueryParams[1:]...),
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "a page of hosts", Body: CertInfoPage{}}, badRequest, dbError},
+		},
+		{
+			Method: "POST", Path: "/users/:uid/hosts", Handle: s.apiSubscribeHost,
+			Summary: "Subscribe a user to a host, creating it if needed", Params: []apiParam{uidParam}, Body: HostRequest{},
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "host created", Body: model.CertModel{}},
+				{Status: http.StatusOK, Description: "user subscribed to existing host", Body: model.CertModel{}},
+				badRequest, dbError,
+			},
+		},
+		{
+			Method: "DELETE", Path: "/users/:uid/hosts/:id", Handle: s.apiUnsubscribeHost,
+			Summary: "Unsubscribe a user, the host is deleted with its last user unless a team owns it", Params: []apiParam{uidParam, idParam},
+			Responses: []apiResponse{{Status: http.StatusNoContent, Description: "user unsubscribed"}, notFound, dbError},
+		},
+		{
+			Method: "GET", Path: "/checks/:host", Handle: s.apiCheckHost,
+			Summary: "Probe a host live without storing the result",
+			Params: []apiParam{
+				{Name: "host", In: "path", Description: "host name or address", Required: true},
+				{Name: "port", In: "query", Description: "port, default 443"},
+				{Name: "module", In: "query", Description: "probe module, default tls"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "probe result", Body: HostResult{}},
+				badRequest,
+				{Status: http.StatusBadGateway, Description: "probe failed", Body: APIError{}},
+			},
+		},
+		{
+			Method: "GET", Path: "/audit", Handle: s.apiListAudit,
+			Summary: "List changes of host records, newest first",
+			Params: []apiParam{
+				{Name: "host", In: "query", Description: "changes of host"},
+				{Name: "actor", In: "query", Description: "changes made by actor"},
+				{Name: "action", In: "query", Description: "create, update, delete, restore, subscribe or unsubscribe"},
+				{Name: "since", In: "query", Description: "RFC 3339 time, inclusive"},
+				{Name: "until", In: "query", Description: "RFC 3339 time, exclusive"},
+				{Name: "page", In: "query", Description: "page number, default 1"},
+				{Name: "limit", In: "query", Description: "page size, default 50, at most 1000"},
+			},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "a page of the audit log", Body: AuditPage{}}, badRequest, dbError},
+		},
+		{
+			Method: "GET", Path: "/leader", Handle: s.apiGetLeader,
+			Summary:   "Get the replica holding the cron lease, which probes hosts and sends reminders",
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the lease", Body: LeaderStatus{}}, dbError},
+		},
+		{
+			Method: "GET", Path: "/openapi.json", Handle: s.apiOpenAPI,
+			Summary:   "This OpenAPI document",
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "OpenAPI 3 document"}},
+		},
+	}
+	routes = append(routes, s.teamRoutes()...)
+	routes = append(routes, s.labelRoutes()...)
+	routes = append(routes, s.silenceRoutes()...)
+	return append(routes, s.agentRoutes()...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if data != nil {
+		_ = json.NewEncoder(w).Encode(data)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, APIError{Error: fmt.Sprintf(format, args...)})
+}
+
+// findHost : find host by id or host name
+func findHost(id string) (model.CertModel, bool, error) {
+	if bson.IsObjectIdHex(id) {
+		return model.GetCertInfoByID(bson.ObjectIdHex(id))
+	}
+	return model.GetCertInfoByHost(strings.ToLower(id))
+}
+
+// findArchivedHost : find archived host by id or host name
+func findArchivedHost(id string) (model.CertModel, bool, error) {
+	if bson.IsObjectIdHex(id) {
+		return model.GetArchivedCertInfo(bson.ObjectIdHex(id), "")
+	}
+	return model.GetArchivedCertInfo("", strings.ToLower(id))
+}
+
+// findHostOrError : find host, writes 404 or 500 if it cannot be returned
+func findHostOrError(w http.ResponseWriter, id string) (model.CertModel, bool) {
+	c, exists, err := findHost(id)
+	if err != nil {
+		config.Logger.Error("func findHost err", zap.String("id", id), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return c, false
+	}
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "host %s not found", id)
+		return c, false
+	}
+	return c, true
+}
+
+func (s *Service) apiListHosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s.apiListCertInfo(w, r, "", "")
+}
+
+func (s *Service) apiListUserHosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s.apiListCertInfo(w, r, ps.ByName("uid"), "")
+}
+
+// apiListCertInfo : page of hosts matching the query parameters, uid and team override them if set
+func (s *Service) apiListCertInfo(w http.ResponseWriter, r *http.Request, uid, team string) {
+	q, paged, err := parseCertQuery(r.Form)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	// v1 总是分页
+	if !paged {
+		q.Page, q.Limit = 1, defaultPageLimit
+	}
+	if uid != "" {
+		q.User = uid
+	}
+	if team != "" {
+		q.Team = team
+	}
+	certInfoList, total, err := model.GetCertInfoList(q)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoList err", zap.String("uid", uid), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, CertInfoPage{Total: total, Page: q.Page, Limit: q.Limit, Items: certInfoList})
+}
+
+func (s *Service) apiCreateHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := HostRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	s.apiUpsertHost(w, req, requestActor(r))
+}
+
+func (s *Service) apiSubscribeHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := HostRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	req.Users = []string{ps.ByName("uid")}
+	s.apiUpsertHost(w, req, ps.ByName("uid"))
+}
+
+// apiUpsertHost : create host or add users with the same rules as bulk import
+func (s *Service) apiUpsertHost(w http.ResponseWriter, req HostRequest, actor string) {
+	row := bulk.NewRow(0, req.Host, req.Port)
+	row.Users = req.Users
+	if row.Error == "" {
+		if err := row.Validate(); err != nil {
+			row.Error = err.Error()
+		}
+	}
+	if row.Error != "" {
+		writeAPIError(w, http.StatusBadRequest, "%s", row.Error)
+		return
+	}
+
+	if err := importRow(&row, map[string]*model.CertModel{}, false, actor); err != nil {
+		config.Logger.Error("func importRow err", zap.String("host", row.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	c, ok := findHostOrError(w, row.Host)
+	if !ok {
+		return
+	}
+	status := http.StatusOK
+	if row.Action == importCreate {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, c)
+}
+
+func (s *Service) apiGetHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Service) apiGetHostCerts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, HostCerts{
+		Host:       c.Host,
+		Port:       normalizePort(c.Port),
+		ExpireAt:   c.ExpireAt,
+		ProbeTime:  c.ProbeTime,
+		ProbeError: c.ProbeError,
+		Certs:      c.Cert,
+		Staple:     c.Staple,
+		Chain:      c.Chain,
+	})
+}
+
+func (s *Service) apiGetHostHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	limit := defaultHistoryLimit
+	if v := r.Form.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > model.MaxQueryLimit {
+			writeAPIError(w, http.StatusBadRequest, "invalid limit %q", v)
+			return
+		}
+		limit = n
+	}
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	history, _, err := model.GetHistoryByHost(c.Host, limit)
+	if err != nil {
+		config.Logger.Error("func model.GetHistoryByHost err", zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+func (s *Service) apiDeleteHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	actor := requestActor(r)
+	reason := r.Form.Get("reason")
+	if reason == "" {
+		reason = "deleted by " + actor
+	}
+	config.Logger.Info("new delete host request", zap.String("uid", actor), zap.String("host", c.Host), zap.String("reason", reason))
+	if _, err := deleteCertInfo(actor, c, reason); err != nil {
+		config.Logger.Error("func model.DeleteCertInfo err", zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *Service) apiUnsubscribeHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := ps.ByName("uid")
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	if !containsString(c.User, uid) {
+		writeAPIError(w, http.StatusNotFound, "user %s is not subscribed to %s", uid, c.Host)
+		return
+	}
+	config.Logger.Info("new unsubscribe host request", zap.String("uid", uid), zap.String("host", c.Host))
+
+	if _, err := unsubscribeCertInfo(uid, c, uid); err != nil {
+		config.Logger.Error("func apiUnsubscribeHost err", zap.String("uid", uid), zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *Service) apiCheckHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	host := ps.ByName("host")
+	port := r.Form.Get("port")
+	if port == "" {
+		port = defaultProbePort
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		writeAPIError(w, http.StatusBadRequest, "invalid port %q", port)
+		return
+	}
+	moduleName := r.Form.Get("module")
+	if moduleName == "" {
+		moduleName = defaultProbeModule
+	}
+	module, ok := probeModules[moduleName]
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "unknown module %q", moduleName)
+		return
+	}
+	result := probeCertInfo(r.Context(), host, port, module)
+	if result.err != nil {
+		config.Logger.Error("func probeCertInfo err", zap.String("host", host), zap.String("port", port), zap.Error(result.err))
+		writeAPIError(w, http.StatusBadGateway, "%v", result.err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Service) apiOpenAPI(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	writeJSON(w, http.StatusOK, openapi.Spec(apiV1Prefix, s.apiV1Routes()))
+}
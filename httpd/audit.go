@@ -0,0 +1,223 @@
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	// apiActor : actor of /api/v1 changes without a uid parameter
+	apiActor        = "api"
+	kubernetesActor = "kubernetes"
+)
+
+// AuditPage : a page of the audit log
+type AuditPage struct {
+	Total int                `json:"total"`
+	Page  int                `json:"page"`
+	Limit int                `json:"limit"`
+	Items []model.AuditModel `json:"items"`
+}
+
+// requestActor : uid parameter of r, who is recorded in the audit log
+func requestActor(r *http.Request) string {
+	if uid := r.Form.Get("uid"); uid != "" {
+		return uid
+	}
+	return apiActor
+}
+
+// recordAudit : append the change of host to the audit log, before is nil if host did not exist.
+// The state after the change is read back, failures are logged and do not fail the change.
+func recordAudit(actor string, action model.AuditAction, host string, before *model.CertModel) {
+	insertAudit(actor, action, host, before, false)
+}
+
+// recordAuditChange : recordAudit, unless the tracked fields of host did not change
+func recordAuditChange(actor string, action model.AuditAction, host string, before *model.CertModel) {
+	insertAudit(actor, action, host, before, true)
+}
+
+func insertAudit(actor string, action model.AuditAction, host string, before *model.CertModel, skipUnchanged bool) {
+	after, exists, err := model.GetAnyCertInfoByHost(host)
+	if err != nil {
+		config.Logger.Error("func model.GetAnyCertInfoByHost err", zap.String("uid", actor), zap.String("host", host), zap.Error(err))
+	}
+	var stored *model.CertModel
+	if exists {
+		stored = &after
+	}
+	a := model.NewAudit(actor, action, host, before, stored)
+	if skipUnchanged && a.Unchanged() {
+		return
+	}
+	if _, err := model.InsertAudit(a); err != nil {
+		config.Logger.Error("func model.InsertAudit err", zap.String("uid", actor), zap.String("host", host), zap.String("action", string(action)), zap.Error(err))
+	}
+}
+
+// createCertInfo : model.CreateCertInfo for c.User[0], recorded as create or subscribe
+func createCertInfo(actor string, c model.CertModel) (bool, error) {
+	before, exists, err := model.GetCertInfoByHost(c.Host)
+	if err != nil {
+		return false, err
+	}
+	ok, err := model.CreateCertInfo(c)
+	if err != nil || !ok {
+		return ok, err
+	}
+	action, changed := model.AuditCreateAction(before, exists, c.User[0])
+	switch {
+	case changed && !exists:
+		recordAudit(actor, action, c.Host, nil)
+	case changed:
+		recordAudit(actor, action, c.Host, &before)
+	}
+	return true, nil
+}
+
+// updateCertInfo : model.UpdateCertInfo recorded as update, before is the stored state
+func updateCertInfo(actor string, before, c model.CertModel) (bool, error) {
+	ok, err := model.UpdateCertInfo(c)
+	if err == nil && ok {
+		recordAudit(actor, model.AuditUpdate, c.Host, &before)
+	}
+	return ok, err
+}
+
+// syncCertInfo : model.SyncCertInfo recorded as create, or as update if tracked fields changed
+func syncCertInfo(actor string, c model.CertModel) (bool, error) {
+	before, exists, err := model.GetCertInfoByHost(c.Host)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := model.SyncCertInfo(c)
+	if err != nil {
+		return inserted, err
+	}
+	if inserted {
+		recordAudit(actor, model.AuditCreate, c.Host, nil)
+	} else if exists {
+		recordAuditChange(actor, model.AuditUpdate, c.Host, &before)
+	}
+	return inserted, nil
+}
+
+// muteCertInfo : model.MuteCertInfo recorded as update, before is the stored state
+func muteCertInfo(actor string, before model.CertModel, user string, m model.Mute) (bool, error) {
+	ok, err := model.MuteCertInfo(before.Host, user, m)
+	if err == nil && ok {
+		recordAudit(actor, model.AuditUpdate, before.Host, &before)
+	}
+	return ok, err
+}
+
+// unsubscribeCertInfo : model.UnsubscribeCertInfo recorded as unsubscribe, or delete if the host was archived
+func unsubscribeCertInfo(actor string, c model.CertModel, user string) (bool, error) {
+	ok, err := model.UnsubscribeCertInfo(c, user)
+	if err != nil || !ok {
+		return ok, err
+	}
+	action := model.AuditUnsubscribe
+	if _, exists, _ := model.GetCertInfoByHost(c.Host); !exists {
+		action = model.AuditDelete
+	}
+	recordAudit(actor, action, c.Host, &c)
+	return true, nil
+}
+
+// deleteCertInfo : archive host recorded as delete
+func deleteCertInfo(actor string, c model.CertModel, reason string) (bool, error) {
+	ok, err := model.DeleteCertInfo(c, actor, reason)
+	if err == nil && ok {
+		recordAudit(actor, model.AuditDelete, c.Host, &c)
+	}
+	return ok, err
+}
+
+// parseAuditQuery : host, actor, action, since and until (RFC 3339), page and limit
+func parseAuditQuery(form url.Values) (model.AuditQuery, error) {
+	q := model.AuditQuery{
+		Host:   form.Get("host"),
+		Actor:  form.Get("actor"),
+		Action: model.AuditAction(form.Get("action")),
+		Page:   1,
+		Limit:  defaultPageLimit,
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := form.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s %q, want RFC 3339 time", p.name, v)
+			}
+			*p.dst = t
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+		max  int
+	}{{"page", &q.Page, 0}, {"limit", &q.Limit, model.MaxQueryLimit}} {
+		if v := form.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || (p.max > 0 && n > p.max) {
+				return q, fmt.Errorf("invalid %s %q", p.name, v)
+			}
+			*p.dst = n
+		}
+	}
+	return q, nil
+}
+
+func (s *Service) apiListAudit(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := parseAuditQuery(r.Form)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	auditList, total, err := model.GetAuditList(q)
+	if err != nil {
+		config.Logger.Error("func model.GetAuditList err", zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, AuditPage{Total: total, Page: q.Page, Limit: q.Limit, Items: auditList})
+}
+
+func (s *Service) apiRestoreHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+	c, exists, err := findArchivedHost(id)
+	if err != nil {
+		config.Logger.Error("func findArchivedHost err", zap.String("id", id), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "archived host %s not found", id)
+		return
+	}
+
+	actor := requestActor(r)
+	config.Logger.Info("new restore host request", zap.String("uid", actor), zap.String("host", c.Host))
+	if _, err := model.RestoreCertInfo(c); err != nil {
+		config.Logger.Error("func model.RestoreCertInfo err", zap.String("uid", actor), zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	recordAudit(actor, model.AuditRestore, c.Host, &c)
+	if c, ok := findHostOrError(w, c.Host); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
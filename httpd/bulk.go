@@ -0,0 +1,204 @@
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"git.ifengidc.com/likuo/go-check-certs/bulk"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	maxImportUpload = 8 << 20
+
+	importCreate    = "create"
+	importUpdate    = "update"
+	importUnchanged = "unchanged"
+)
+
+// ImportResult : summary of an import, in dry run mode nothing is written
+type ImportResult struct {
+	DryRun    bool       `json:"dry_run"`
+	Total     int        `json:"total"`
+	Created   int        `json:"created"`
+	Updated   int        `json:"updated"`
+	Unchanged int        `json:"unchanged"`
+	Failed    int        `json:"failed"`
+	Rows      []bulk.Row `json:"rows"`
+}
+
+// ImportCertInfo : create or update hosts from CSV, JSON or a CLI hosts file
+func (s *Service) ImportCertInfo(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := r.Form.Get("uid")
+	format := r.Form.Get("format")
+	dryRun, _ := strconv.ParseBool(r.Form.Get("dry_run"))
+
+	data, err := readUpload(w, r, maxImportUpload)
+	if err != nil {
+		config.Logger.Error("func readUpload err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4000, Msg: err.Error()}))
+		return
+	}
+	if format == "" {
+		format = bulk.DetectFormat(r.Header.Get("Content-Type"), data)
+	}
+	config.Logger.Info("new import cert info request", zap.String("uid", uid), zap.String("format", format), zap.Bool("dry_run", dryRun), zap.Int("size", len(data)))
+
+	rows, err := bulk.Parse(format, data)
+	if err != nil {
+		config.Logger.Error("func bulk.Parse err", zap.String("uid", uid), zap.String("format", format), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4011, Msg: err.Error()}))
+		return
+	}
+
+	result := ImportResult{DryRun: dryRun, Total: len(rows), Rows: rows}
+	// 本次导入中已处理的 host，保证 dry run 与重复行的结果一致
+	known := map[string]*model.CertModel{}
+	for i := range result.Rows {
+		row := &result.Rows[i]
+		if row.Error == "" {
+			if len(row.Users) == 0 && uid != "" {
+				row.Users = []string{uid}
+			}
+			if err := row.Validate(); err != nil {
+				row.Error = err.Error()
+			} else if err := importRow(row, known, dryRun, requestActor(r)); err != nil {
+				config.Logger.Error("func importRow err", zap.String("uid", uid), zap.String("host", row.Host), zap.Error(err))
+				row.Error = err.Error()
+			}
+		}
+		switch {
+		case row.Error != "":
+			result.Failed++
+		case row.Action == importCreate:
+			result.Created++
+		case row.Action == importUpdate:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+	w.Write(genResponseStr(Response{Code: 200, Data: result, Msg: "import cert info success"}))
+}
+
+// importRow : upsert row with model.CreateCertInfo, which adds users to existing hosts.
+// Changes are recorded in the audit log as done by actor.
+func importRow(row *bulk.Row, known map[string]*model.CertModel, dryRun bool, actor string) error {
+	cc, ok := known[row.Host]
+	if !ok {
+		c, exists, err := model.GetCertInfoByHost(row.Host)
+		if err != nil {
+			return err
+		}
+		if exists {
+			cc = &c
+		}
+	}
+
+	if cc == nil {
+		row.Action = importCreate
+		cc = &model.CertModel{Host: row.Host, Port: row.Port}
+	} else {
+		row.Action = importUnchanged
+		if normalizePort(cc.Port) != row.Port {
+			row.Action = importUpdate
+			before := *cc
+			cc.Port = row.Port
+			if !dryRun {
+				if _, err := updateCertInfo(actor, before, *cc); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, user := range row.Users {
+		if containsString(cc.User, user) {
+			continue
+		}
+		if row.Action == importUnchanged {
+			row.Action = importUpdate
+		}
+		cc.User = append(cc.User, user)
+		if dryRun {
+			continue
+		}
+		ok, err := createCertInfo(actor, model.CertModel{Host: cc.Host, Port: cc.Port, User: []string{user}})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("host was changed concurrently, retry the import")
+		}
+	}
+	known[row.Host] = cc
+	return nil
+}
+
+func normalizePort(port string) string {
+	if port == "" {
+		return defaultProbePort
+	}
+	return port
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportCertInfo : download monitored hosts as CSV, JSON or CLI hosts file, optionally of one user
+func (s *Service) ExportCertInfo(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := r.Form.Get("uid")
+	format := r.Form.Get("format")
+	if format == "" {
+		format = bulk.FormatCSV
+	}
+	config.Logger.Info("new export cert info request", zap.String("uid", uid), zap.String("format", format))
+
+	var (
+		certModelList []model.CertModel
+		err           error
+	)
+	if uid != "" {
+		certModelList, _, err = model.GetCertInfoListByUser(uid)
+	} else {
+		certModelList, _, err = model.GetCertInfoListAll()
+	}
+	if err != nil {
+		config.Logger.Error("func ExportCertInfo get cert info list err", zap.String("uid", uid), zap.Error(err))
+		w.Write(error5000Response)
+		return
+	}
+
+	entries := []bulk.Entry{}
+	for _, c := range certModelList {
+		// kubernetes secret 条目不是可导入的 host
+		if !c.Probeable() {
+			continue
+		}
+		entries = append(entries, bulk.Entry{Host: c.Host, Port: normalizePort(c.Port), Users: c.User})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Host < entries[j].Host })
+
+	data, contentType, err := bulk.Export(format, entries)
+	if err != nil {
+		config.Logger.Error("func bulk.Export err", zap.String("uid", uid), zap.String("format", format), zap.Error(err))
+		w.Write(error4000Response)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="certs.%s"`, bulk.FileExt(format)))
+	w.Write(data)
+}
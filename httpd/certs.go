@@ -1,10 +1,11 @@
 package httpd
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"git.ifengidc.com/likuo/go-check-certs/config"
 	"git.ifengidc.com/likuo/go-check-certs/model"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
 	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
 	"net/http"
@@ -12,9 +13,17 @@ import (
 )
 
 type HostResult struct {
-	Host  string           `json:"host"`
-	Certs []model.CertInfo `json:"certs"`
-	err   error
+	Host     string             `json:"host"`
+	Port     string             `json:"port"`
+	Certs    []model.CertInfo   `json:"certs"`
+	Staple   model.StapleInfo   `json:"staple"`
+	Chain    []model.ChainIssue `json:"chain"`
+	err      error
+	duration time.Duration
+	// probeTime : when the probe finished, stored as probe_time
+	probeTime time.Time
+	// previous : stored state of host before this probe, set by the cron
+	previous model.CertModel
 }
 
 // GetCertExpireTime : get domain host cert expire time for checking
@@ -23,7 +32,7 @@ func (s *Service) GetCertExpireTime(w http.ResponseWriter, r *http.Request, ps h
 	host := r.Form.Get("host")
 	config.Logger.Info("new get domain cert expire time request", zap.String("uid", uid), zap.String("host", host))
 
-	result := GetDomainCertInfo(host)
+	result := GetDomainCertInfo(r.Context(), host)
 	if result.err != nil {
 		config.Logger.Error("func GetDomainCertInfo err", zap.String("uid", uid), zap.String("host", host), zap.Error(result.err))
 		w.Write(error4001Response)
@@ -53,7 +62,7 @@ func (s *Service) CreateCertInfo(w http.ResponseWriter, r *http.Request, ps http
 	c.User = append(c.User, req.User)
 
 	config.Logger.Info("new create host cert info request", zap.String("uid", req.User), zap.Any("cert struct", &c))
-	ok, err := model.CreateCertInfo(c)
+	ok, err := createCertInfo(req.User, c)
 	if err != nil {
 		config.Logger.Error("func model.InsertCertInfo err", zap.String("uid", req.User), zap.Error(err))
 		w.Write(error5000Response)
@@ -106,78 +115,70 @@ func (s *Service) DeleteCertInfo(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	// user list 只有 user 自己时
-	if len(cc.User) == 1 {
-		ok, err := model.DeleteCertInfo(cc)
-		if err != nil {
-			config.Logger.Error("func model.DeleteCertInfo err", zap.String("uid", req.User), zap.Error(err))
-			w.Write(error5000Response)
-			return
-		}
-
-		if !ok {
-			config.Logger.Error("func model.DeleteCertInfo err, cert host not found", zap.String("uid", req.User))
-			w.Write(error5002Response)
-			return
-		}
-	} else {
-		ok, err := model.DeleteUserFromCertInfo(cc, req.User)
-		if err != nil {
-			config.Logger.Error("func model.DeleteUserFromCertInfo err", zap.String("uid", req.User), zap.Error(err))
-			w.Write(error5000Response)
-			return
-		}
-
-		if !ok {
-			config.Logger.Error("func model.model.DeleteUserFromCertInfo err, cert host not found", zap.String("uid", req.User))
-			w.Write(error5002Response)
-			return
-		}
+	// user list 只有 user 自己且没有所属团队时删除 host
+	ok, err := unsubscribeCertInfo(req.User, cc, req.User)
+	if err != nil {
+		config.Logger.Error("func model.UnsubscribeCertInfo err", zap.String("uid", req.User), zap.Error(err))
+		w.Write(error5000Response)
+		return
+	}
+
+	if !ok {
+		config.Logger.Error("func model.UnsubscribeCertInfo err, cert host not found", zap.String("uid", req.User))
+		w.Write(error5002Response)
+		return
 	}
 
 	w.Write(genResponseStr(Response{Code: 200, Data: req, Msg: "delete cert info success"}))
 }
 
-// GetCertInfolist : get all cert info list
+// GetCertInfolist : get cert info list, filtered, sorted and paged by query parameters
 func (s *Service) GetCertInfolist(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	uid := r.Form.Get("uid")
-	config.Logger.Info("new get cert info list request", zap.String("uid", uid))
+	config.Logger.Info("new get cert info list request", zap.String("uid", uid), zap.String("query", r.URL.RawQuery))
 
-	certInfoList, ok, err := model.GetCertInfoListAll()
+	q, paged, err := parseCertQuery(r.Form)
 	if err != nil {
-		config.Logger.Error("func model.GetCertInfolist err", zap.String("uid", uid), zap.Error(err))
-		w.Write(error5000Response)
-		return
-	}
-
-	if !ok {
-		config.Logger.Error("func model.GetCertInfolist err, cert host list not found", zap.String("uid", uid))
-		w.Write(error5002Response)
+		config.Logger.Error("func parseCertQuery err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4000, Msg: err.Error()}))
 		return
 	}
-
-	w.Write(genResponseStr(Response{Code: 200, Data: certInfoList, Msg: "get cert info list success"}))
+	writeCertInfoList(w, uid, q, paged, "get cert info list success")
 }
 
-// GetCertInfoByUser : get cert info list for user
+// GetCertInfoByUser : get cert info list for user, with the same query parameters as GetCertInfolist
 func (s *Service) GetCertInfoByUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	uid := r.Form.Get("uid")
-	config.Logger.Info("new get cert info by user request", zap.String("uid", uid))
+	config.Logger.Info("new get cert info by user request", zap.String("uid", uid), zap.String("query", r.URL.RawQuery))
 
-	certInfoList, ok, err := model.GetCertInfoListByUser(uid)
+	q, paged, err := parseCertQuery(r.Form)
 	if err != nil {
-		config.Logger.Error("func model.GetCertInfoListByUser err", zap.String("uid", uid), zap.Error(err))
-		w.Write(error5000Response)
+		config.Logger.Error("func parseCertQuery err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4000, Msg: err.Error()}))
 		return
 	}
+	q.User = uid
+	writeCertInfoList(w, uid, q, paged, "get user cert info list success")
+}
 
-	if !ok {
-		config.Logger.Error("func model.GetCertInfoListByUser err, user's cert host list not found", zap.String("uid", uid))
-		w.Write(error5002Response)
+func writeCertInfoList(w http.ResponseWriter, uid string, q model.CertQuery, paged bool, msg string) {
+	certInfoList, total, err := model.GetCertInfoList(q)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoList err", zap.String("uid", uid), zap.Error(err))
+		w.Write(error5000Response)
 		return
 	}
 
-	w.Write(genResponseStr(Response{Code: 200, Data: certInfoList, Msg: "get user cert info list success"}))
+	if !paged {
+		w.Write(genResponseStr(Response{Code: 200, Data: certInfoList, Msg: msg}))
+		return
+	}
+	w.Write(genResponseStr(Response{Code: 200, Data: CertInfoPage{
+		Total: total,
+		Page:  q.Page,
+		Limit: q.Limit,
+		Items: certInfoList,
+	}, Msg: msg}))
 }
 
 // GetCertInfoByHost : get cert info by host
@@ -203,39 +204,21 @@ func (s *Service) GetCertInfoByHost(w http.ResponseWriter, r *http.Request, ps h
 }
 
 // GetDomainCertInfo : get domain origin cert info by http request
-func GetDomainCertInfo(host string) (result HostResult) {
-	port := "443"
-	result = HostResult{
-		Host:  host,
-		Certs: []model.CertInfo{},
-	}
-	conn, err := tls.Dial("tcp", host+":"+port, nil)
-	if err != nil {
-		result.err = err
-		return
+func GetDomainCertInfo(ctx context.Context, host string) HostResult {
+	return probeCertInfo(ctx, host, defaultProbePort, probeModules[defaultProbeModule])
+}
+
+// probeCertInfo : get cert info of host:port with probe module, aborted when ctx is canceled
+func probeCertInfo(ctx context.Context, host, port string, module ProbeModule) HostResult {
+	r := probe.Run(ctx, host, port, module)
+	return HostResult{
+		Host:      r.Host,
+		Port:      r.Port,
+		Certs:     r.Certs,
+		Staple:    r.Staple,
+		Chain:     r.Chain,
+		err:       r.Err,
+		duration:  r.Duration,
+		probeTime: time.Now(),
 	}
-	defer conn.Close()
-
-	timeNow := time.Now()
-	checkedCerts := make(map[string]struct{})
-	for _, chain := range conn.ConnectionState().VerifiedChains {
-		for _, cert := range chain {
-			if _, checked := checkedCerts[string(cert.Signature)]; checked {
-				continue
-			}
-			checkedCerts[string(cert.Signature)] = struct{}{}
-
-			// 过期时间
-			expiresHours := int64(cert.NotAfter.Sub(timeNow).Hours())
-
-			result.Certs = append(result.Certs, model.CertInfo{
-				CommonName:  cert.Subject.CommonName,
-				ExpireHours: expiresHours,
-				IsCA:        cert.IsCA,
-				NotBefore:   cert.NotBefore,
-				NotAfter:    cert.NotAfter,
-			})
-		}
-	}
-	return
 }
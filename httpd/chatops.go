@@ -0,0 +1,318 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/bulk"
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+	"git.ifengidc.com/likuo/go-check-certs/chatops"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const chatHelpText = `**证书助手**
+> 证书 www.ifeng.com　查看域名证书有效期
+> 证书 likuo　查看用户订阅的域名，不带参数时查看自己的
+> 证书 + 换行 + 每行一个域名　订阅域名
+> 证书- + 换行 + 每行一个域名　取消订阅
+> 证书 snooze www.ifeng.com 7d　暂停提醒，默认 7 天，最长 90 天
+> 证书 ack www.ifeng.com　确认提醒，证书更新前不再提醒
+> 证书 help　显示本帮助
+
+域名可以带端口，如 www.ifeng.com:8443`
+
+// ChatRequest : chat message sent to the SRE assistant
+type ChatRequest struct {
+	User string `json:"uid"`
+	Text string `json:"text"`
+}
+
+// ChatReply : reply as a WeChat Work markdown message
+type ChatReply struct {
+	MsgType  string       `json:"msgtype"`
+	Markdown ChatMarkdown `json:"markdown"`
+}
+
+type ChatMarkdown struct {
+	Content string `json:"content"`
+}
+
+// Chat : run a chat command of the SRE assistant and reply with the result
+func (s *Service) Chat(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := ChatRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		config.Logger.Error("func Chat decode json err", zap.String("uid", req.User), zap.Error(err))
+		w.Write(error4000Response)
+		return
+	}
+	req.User = strings.TrimSpace(req.User)
+	if req.User == "" {
+		w.Write(error4000Response)
+		return
+	}
+	config.Logger.Info("new chat command request", zap.String("uid", req.User), zap.String("text", req.Text))
+
+	var reply string
+	cmd, err := chatops.Parse(req.Text)
+	switch {
+	case err == chatops.ErrNotCommand:
+		reply = chatHelpText
+	case err != nil:
+		reply = err.Error() + "\n\n" + chatHelpText
+	default:
+		reply = runChatCommand(r.Context(), req.User, cmd)
+	}
+
+	w.Write(genResponseStr(Response{
+		Code: 200,
+		Data: ChatReply{MsgType: "markdown", Markdown: ChatMarkdown{Content: chatops.TruncateReply(reply)}},
+		Msg:  "chat command success",
+	}))
+}
+
+// runChatCommand : execute cmd for user, returns the markdown reply
+func runChatCommand(ctx context.Context, user string, cmd chatops.Command) string {
+	switch cmd.Action {
+	case chatops.Help:
+		return chatHelpText
+	case chatops.Query:
+		if len(cmd.Args) == 0 {
+			return chatListUser(user, user)
+		}
+		replies := []string{}
+		for _, arg := range cmd.Args {
+			if isChatHost(arg) {
+				replies = append(replies, chatQueryHost(ctx, arg))
+			} else {
+				replies = append(replies, chatListUser(user, arg))
+			}
+		}
+		return strings.Join(replies, "\n\n")
+	}
+
+	lines := []string{}
+	for _, arg := range cmd.Args {
+		var line string
+		switch cmd.Action {
+		case chatops.Add:
+			line = chatAddHost(user, arg)
+		case chatops.Delete:
+			line = chatDeleteHost(user, arg)
+		case chatops.Snooze:
+			line = chatMuteHost(user, arg, cmd.Snooze)
+		case chatops.Ack:
+			line = chatMuteHost(user, arg, 0)
+		}
+		lines = append(lines, "> "+arg+"　"+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isChatHost : host names have a dot, user ids don't
+func isChatHost(arg string) bool {
+	return strings.ContainsAny(arg, ".:/")
+}
+
+// chatTarget : host and port of arg, which may be host:port or a URL
+func chatTarget(arg string) (certcheck.Target, error) {
+	t, err := certcheck.ParseTarget(arg)
+	if err != nil {
+		return t, err
+	}
+	t.Host = strings.ToLower(t.Host)
+	if !bulk.ValidHost(t.Host) {
+		return t, fmt.Errorf("invalid host %q", t.Host)
+	}
+	return t, nil
+}
+
+func chatQueryHost(ctx context.Context, arg string) string {
+	t, err := chatTarget(arg)
+	if err != nil {
+		return "**" + arg + "**\n" + chatColor("warning", err.Error())
+	}
+	title := "**" + t.Host + ":" + t.Port + "**"
+	if t.Protocol != defaultProbeModule {
+		return title + "\n" + chatColor("warning", "仅支持 TLS 端口")
+	}
+	result := probeCertInfo(ctx, t.Host, t.Port, probeModules[defaultProbeModule])
+	if result.err != nil {
+		config.Logger.Error("func probeCertInfo err", zap.String("uid", "chat"), zap.String("host", t.Host), zap.Error(result.err))
+		return title + "\n" + chatColor("warning", "检测失败: "+result.err.Error())
+	}
+
+	lines := []string{title}
+	timeNow := time.Now()
+	for _, c := range result.Certs {
+		lines = append(lines, fmt.Sprintf("> %s%s　%s　%s",
+			c.CommonName, chatCAMark(c.IsCA), c.NotAfter.Format("2006-01-02"), chatDaysLeft(c.NotAfter, timeNow, expireNoticeHours(c.IsCA))))
+	}
+	for _, issue := range result.Chain {
+		lines = append(lines, chatColor("warning", "证书链问题: "+issue.Message))
+	}
+	if c, exists, err := model.GetCertInfoByHost(t.Host); err == nil && exists {
+		lines = append(lines, chatColor("comment", "已监控，订阅人: "+strings.Join(c.User, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// chatListUser : hosts of owner for user, soonest expiry first
+func chatListUser(user, owner string) string {
+	certModelList, _, err := model.GetCertInfoListByUser(owner)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoListByUser err", zap.String("uid", user), zap.String("owner", owner), zap.Error(err))
+		return chatColor("warning", "数据库错误")
+	}
+	title := fmt.Sprintf("**%s 订阅的域名 (%d)**", owner, len(certModelList))
+	if len(certModelList) == 0 {
+		return title + "\n" + chatColor("comment", "暂无")
+	}
+	sort.Slice(certModelList, func(i, j int) bool {
+		a, b := certModelList[i].ExpireAt, certModelList[j].ExpireAt
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return certModelList[i].Host < certModelList[j].Host
+	})
+
+	lines := []string{title}
+	timeNow := time.Now()
+	for _, c := range certModelList {
+		line := "> " + c.Host
+		if p := normalizePort(c.Port); p != defaultProbePort {
+			line += ":" + p
+		}
+		switch {
+		case c.ProbeError != "":
+			line += "　" + chatColor("comment", "检测失败: "+c.ProbeError)
+		case c.ExpireAt.IsZero():
+			line += "　" + chatColor("comment", "等待检测")
+		default:
+			line += "　" + c.ExpireAt.Format("2006-01-02") + "　" + chatDaysLeft(c.ExpireAt, timeNow, noticePolicyFor(c).noticeHours(c, false))
+		}
+		if c.Muted(owner, timeNow) {
+			line += "　" + chatColor("comment", chatMuteText(c.Mutes[owner]))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func chatAddHost(user, arg string) string {
+	row := bulk.NewRow(0, arg, "")
+	row.Users = []string{user}
+	if row.Error == "" {
+		if err := row.Validate(); err != nil {
+			row.Error = err.Error()
+		}
+	}
+	if row.Error != "" {
+		return chatColor("warning", row.Error)
+	}
+	if err := importRow(&row, map[string]*model.CertModel{}, false, user); err != nil {
+		config.Logger.Error("func importRow err", zap.String("uid", user), zap.String("host", row.Host), zap.Error(err))
+		return chatColor("warning", "订阅失败: "+err.Error())
+	}
+	switch row.Action {
+	case importCreate:
+		return chatColor("info", "已添加监控")
+	case importUpdate:
+		return chatColor("info", "已订阅")
+	}
+	return chatColor("comment", "已订阅过")
+}
+
+func chatDeleteHost(user, arg string) string {
+	t, err := chatTarget(arg)
+	if err != nil {
+		return chatColor("warning", err.Error())
+	}
+	cc, exists, err := model.GetCertInfoByUser(user, t.Host)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoByUser err", zap.String("uid", user), zap.String("host", t.Host), zap.Error(err))
+		return chatColor("warning", "数据库错误")
+	}
+	if !exists {
+		return chatColor("comment", "未订阅")
+	}
+
+	if _, err := unsubscribeCertInfo(user, cc, user); err != nil {
+		config.Logger.Error("func chatDeleteHost err", zap.String("uid", user), zap.String("host", t.Host), zap.Error(err))
+		return chatColor("warning", "数据库错误")
+	}
+	return chatColor("info", "已取消订阅")
+}
+
+// chatMuteHost : snooze reminders of host for user, or ack its current cert if snooze is 0
+func chatMuteHost(user, arg string, snooze time.Duration) string {
+	t, err := chatTarget(arg)
+	if err != nil {
+		return chatColor("warning", err.Error())
+	}
+	cc, exists, err := model.GetCertInfoByUser(user, t.Host)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoByUser err", zap.String("uid", user), zap.String("host", t.Host), zap.Error(err))
+		return chatColor("warning", "数据库错误")
+	}
+	if !exists {
+		return chatColor("comment", "未订阅")
+	}
+
+	m := model.Mute{}
+	if snooze > 0 {
+		m.Until = time.Now().Add(snooze)
+	} else {
+		if len(cc.Cert) == 0 {
+			return chatColor("comment", "还没有检测到证书")
+		}
+		m.Serial = cc.Cert[0].SerialNumber
+	}
+	if _, err := muteCertInfo(user, cc, user, m); err != nil {
+		config.Logger.Error("func muteCertInfo err", zap.String("uid", user), zap.String("host", t.Host), zap.Error(err))
+		return chatColor("warning", "数据库错误")
+	}
+	return chatColor("info", chatMuteText(m))
+}
+
+func chatMuteText(m model.Mute) string {
+	if !m.Until.IsZero() && time.Now().Before(m.Until) {
+		return "提醒暂停至 " + m.Until.Format("2006-01-02 15:04")
+	}
+	return "已确认，证书更新前不再提醒"
+}
+
+// chatDaysLeft : days until notAfter, colored by the notice window
+func chatDaysLeft(notAfter, timeNow time.Time, noticeHours int64) string {
+	hours := int64(notAfter.Sub(timeNow).Hours())
+	switch {
+	case hours < 0:
+		return chatColor("warning", "已过期")
+	case hours <= noticeHours:
+		return chatColor("warning", fmt.Sprintf("剩余 %d 天", hours/24))
+	}
+	return chatColor("info", fmt.Sprintf("剩余 %d 天", hours/24))
+}
+
+func chatCAMark(isCA bool) string {
+	if isCA {
+		return " (CA)"
+	}
+	return ""
+}
+
+// chatColor : WeChat Work markdown font color, one of info, comment and warning
+func chatColor(color, text string) string {
+	return `<font color="` + color + `">` + text + `</font>`
+}
@@ -1,51 +1,90 @@
 package httpd
 
 import (
+	"context"
 	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/lifecycle"
 	"git.ifengidc.com/likuo/go-check-certs/model"
 	"go.uber.org/zap"
-	"sync"
 	"time"
 )
 
 var (
-	concurrencyNum  = 8
-	noticeTimeHours = 10
+	// noticeInterval : longer than the notice window, so the notice pass runs once a day
+	noticeInterval = 12 * time.Hour
+	// cronJobs : cron loops and probe workers, waited for on shutdown
+	cronJobs lifecycle.Group
 )
 
-func Init() {
-	cron()
+// Init : load notice policies and start the cron jobs, they stop when ctx is canceled
+func Init(ctx context.Context) {
+	if err := loadNoticePolicies(); err != nil {
+		config.Logger.Error("func loadNoticePolicies err, using default thresholds", zap.String("file", config.Settings().Notice.PolicyFile), zap.Error(err))
+	}
+	cron(ctx)
+	watchConfig(ctx)
+}
+
+// Shutdown : wait for the cron jobs to stop after the context of Init is canceled, hand the cron lease
+// over and drain pending notifications. Notifications still pending when ctx is done are canceled.
+func Shutdown(ctx context.Context) error {
+	err := cronJobs.Wait(ctx)
+	leader.release()
+	if sendErr := sending.Shutdown(ctx); err == nil {
+		err = sendErr
+	}
+	return err
 }
 
-func cron() {
+func cron(ctx context.Context) {
 	/*
 			1. 从库中获取待检查信息 (库操作)
 		    2. 判断是否过期
 		    3. 根据是否过期，判断是否通知
 		    4. 休眠，定时循环
+		多副本部署时只有持有 cron 租约的副本执行任务
 	*/
-	go func() {
-		for {
-			checkCertExpireTimeToDB()
-			time.Sleep(time.Hour)
+	leader.renew()
+	cronJobs.Go(func() {
+		leader.run(ctx)
+	})
+
+	// 每个 host 按各自的 next_check 探测，见 scheduler
+	scheduler.start(ctx, config.ProbeConcurrency)
+	cronJobs.Every(ctx, scheduleInterval, func() {
+		if leader.isLeader() {
+			stime := time.Now()
+			scheduler.tick(stime)
+			observeCronRun("schedule", stime)
 		}
-	}()
-
-	go func() {
-		for {
-			// notice time : 10:00 - 11:00
-			time.Sleep(time.Minute)
-			if checkNoticeTime() {
-				checkCertExpireTimeFromDB()
+	})
+
+	if kubeDiscoveryEnabled() {
+		cronJobs.Every(ctx, time.Minute, func() {
+			if leader.due("kubernetes", kubeDiscoveryInterval) {
+				stime := time.Now()
+				leader.markRun("kubernetes", stime)
+				syncKubernetes(ctx)
+				observeCronRun("kubernetes", stime)
 			}
-			time.Sleep(time.Hour)
+		})
+	}
+
+	// notice time : 10:00 - 11:00, once a day
+	// 提醒不随 ctx 中断，避免当天的提醒只发出一部分
+	cronJobs.Every(ctx, time.Minute, func() {
+		if checkNoticeTime() && leader.due("notice", noticeInterval) {
+			stime := time.Now()
+			leader.markRun("notice", stime)
+			checkCertExpireTimeFromDB()
+			observeCronRun("notice", stime)
 		}
-	}()
+	})
 }
 
 func checkNoticeTime() bool {
 	now := time.Now()
-	noticeTime := time.Date(now.Year(), now.Month(), now.Day(), noticeTimeHours, 0, 0, 0, now.Location())
+	noticeTime := time.Date(now.Year(), now.Month(), now.Day(), config.Settings().Notice.TimeHours, 0, 0, 0, now.Location())
 	diffTime := now.Sub(noticeTime).Hours()
 
 	// now - 10
@@ -78,118 +117,115 @@ func checkCertExpireTimeFromDB() {
 		return
 	}
 
+	silences := activeSilences(time.Now())
 	for _, certModel := range certModelList {
-		if len(certModel.Cert) == 0 {
+		policy := noticePolicyFor(certModel)
+		// 自动发现的 host 可能没有负责人
+		if len(certModel.Cert) == 0 || (len(certModel.User) == 0 && certModel.Team == "" && !policy.hasReceivers()) {
 			continue
 		}
+		if si, ok := model.SilencedBy(silences, certModel); ok {
+			config.Logger.Info("host silenced, notice skipped", zap.String("uid", "cron"), zap.String("host", certModel.Host), zap.String("silence", si.ID.Hex()), zap.String("reason", si.Reason))
+			continue
+		}
+		checkStaple(certModel, policy)
 		for _, c := range certModel.Cert {
-			var expireTime int64
-			// CA 提前5个月提醒，企业证书提前1个月提醒
-			switch c.IsCA {
-			case true:
-				expireTime = 5 * 30 * 24
-			case false:
-				expireTime = 30 * 24
-			}
-			if c.ExpireHours <= expireTime {
-				noticeToUser(certModel, c)
+			if c.ExpireHours <= policy.noticeHours(certModel, c.IsCA) || c.Revocation.Status == model.RevocationRevoked {
+				noticeToUser(certModel, policy, c)
 			}
 		}
 	}
 	config.Logger.Info("crontab func checkCertExpireTimeFromDB success", zap.String("uid", "cron"))
 }
 
-// checkCertExpireTimeToDB : run crontab for checking domain cert expire time
-func checkCertExpireTimeToDB() {
-
-	// 完成通知 channel
-	doneChan := make(chan struct{})
-	defer close(doneChan)
-
-	// get host channel
-	hostChan := getHostsFromDB(doneChan)
-
-	// make resultChan
-	resultChan := make(chan HostResult)
-
-	// 定义并发数
-	var wg sync.WaitGroup
-
-	wg.Add(concurrencyNum)
-	for i := 0; i < concurrencyNum; i++ {
-		go func() {
-			getCertInfoToResultChan(doneChan, hostChan, resultChan)
-			wg.Done()
-		}()
+// expireNoticeHours : configured notice hours of CA certs, or of medium criticality for other certs
+func expireNoticeHours(isCA bool) int64 {
+	notice := config.Settings().Notice
+	if isCA {
+		return int64(notice.CADays) * 24
 	}
+	return int64(notice.Days[string(model.CriticalityMedium)]) * 24
+}
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	for r := range resultChan {
-		if r.err != nil {
-			config.Logger.Error("func checkCertExpireTime err", zap.String("uid", "cron"), zap.String("host", r.Host), zap.Error(r.err))
-			continue
-		}
-		certModel, exists, err := model.GetCertInfoByHost(r.Host)
-		if err != nil {
-			config.Logger.Error("func GetCertInfoByHost err", zap.String("uid", "cron"), zap.String("host", r.Host), zap.Error(err))
-			continue
-		}
+// checkStaple : notice when must-staple cert is served without staple or staple is going stale
+func checkStaple(certModel model.CertModel, policy NoticePolicy) {
+	staple := certModel.Staple
+	if staple.MustStaple && !staple.Provided {
+		noticeStapleToUser(certModel, policy, "证书要求 OCSP Must-Staple，但握手中未提供 stapled OCSP 响应")
+		return
+	}
+	if staple.Provided && !staple.NextUpdate.IsZero() && time.Until(staple.NextUpdate).Hours() <= config.Settings().Notice.StapleStaleHours {
+		noticeStapleToUser(certModel, policy, "stapled OCSP 响应即将过期，nextUpdate: "+staple.NextUpdate.Format("2006-01-02 15:04:05"))
+	}
+}
 
-		if !exists {
-			config.Logger.Error("func GetCertInfoByHost err, host not found", zap.String("uid", "cron"), zap.String("host", r.Host), zap.String("err", "host not found"))
-			continue
+// storeProbeResult : store certs or the probe error of r on the host, and record its history
+func storeProbeResult(uid string, r HostResult) {
+	if r.err != nil {
+		config.Logger.Error("func checkCertExpireTime err", zap.String("uid", uid), zap.String("host", r.Host), zap.Error(r.err))
+		if _, err := model.UpdateProbeError(r.Host, r.err.Error(), r.probeTime); err != nil {
+			config.Logger.Error("func UpdateProbeError err", zap.String("uid", uid), zap.String("host", r.Host), zap.Error(err))
 		}
+		recordHistory(r)
+		return
+	}
+	certModel, exists, err := model.GetCertInfoByHost(r.Host)
+	if err != nil {
+		config.Logger.Error("func GetCertInfoByHost err", zap.String("uid", uid), zap.String("host", r.Host), zap.Error(err))
+		return
+	}
 
-		certModel.Cert = r.Certs
-		ok, err := model.UpdateCertInfo(certModel)
-		if err != nil {
-			config.Logger.Error("func UpdateCertInfo err", zap.String("uid", "cron"), zap.String("host", r.Host), zap.Error(err))
-			continue
-		}
-		if !ok {
-			config.Logger.Error("func UpdateCertInfo err, host not found", zap.String("uid", "cron"), zap.String("host", r.Host), zap.String("err", "host not found"))
-			continue
-		}
+	if !exists {
+		config.Logger.Error("func GetCertInfoByHost err, host not found", zap.String("uid", uid), zap.String("host", r.Host), zap.String("err", "host not found"))
+		return
 	}
-	config.Logger.Info("crontab func checkCertExpireTime success", zap.String("uid", "cron"))
-}
 
-func getCertInfoToResultChan(done <-chan struct{}, hostChan <-chan string, resultChan chan<- HostResult) {
-	for host := range hostChan {
-		select {
-		case resultChan <- GetDomainCertInfo(host):
-		case <-done:
-			return
-		}
+	certModel.Cert = r.Certs
+	certModel.Staple = r.Staple
+	certModel.Chain = r.Chain
+	ok, err := model.UpdateCertInfo(certModel)
+	if err != nil {
+		config.Logger.Error("func UpdateCertInfo err", zap.String("uid", uid), zap.String("host", r.Host), zap.Error(err))
+		return
+	}
+	if !ok {
+		config.Logger.Error("func UpdateCertInfo err, host not found", zap.String("uid", uid), zap.String("host", r.Host), zap.String("err", "host not found"))
+		return
+	}
+	if _, err := model.UpdateProbeError(r.Host, "", r.probeTime); err != nil {
+		config.Logger.Error("func UpdateProbeError err", zap.String("uid", uid), zap.String("host", r.Host), zap.Error(err))
 	}
+	recordHistory(r)
 }
 
-func getHostsFromDB(done <-chan struct{}) <-chan string {
-	hosts := make(chan string)
-	go func() {
-		defer close(hosts)
-		certModelList, exists, err := model.GetCertInfoListAll()
-		if err != nil {
-			config.Logger.Error("func model.GetCertInfoListAll err", zap.String("uid", "cron"), zap.Error(err))
-			return
+// recordHistory : record renewal of the leaf cert and changes of the probe state
+func recordHistory(r HostResult) {
+	prev := r.previous
+	events := []model.HistoryModel{}
+	switch {
+	case r.err != nil:
+		if prev.ProbeError == "" {
+			events = append(events, model.HistoryModel{Event: model.HistoryProbeFailed, Error: r.err.Error()})
 		}
-
-		if !exists {
-			config.Logger.Error("func model.GetCertInfoListAll err, cert host list not found", zap.String("uid", "cron"))
-			return
+	default:
+		if prev.ProbeError != "" {
+			events = append(events, model.HistoryModel{Event: model.HistoryProbeRecovered})
+		}
+		if len(r.Certs) == 0 {
+			break
+		}
+		leaf := r.Certs[0]
+		if len(prev.Cert) == 0 {
+			events = append(events, model.HistoryModel{Event: model.HistoryFirstSeen, Cert: &leaf})
+		} else if prev.Cert[0].SerialNumber != leaf.SerialNumber {
+			events = append(events, model.HistoryModel{Event: model.HistoryRenewed, Cert: &leaf})
 		}
+	}
 
-		for _, certModel := range certModelList {
-			select {
-			case hosts <- certModel.Host:
-			case <-done:
-				return
-			}
+	for _, h := range events {
+		h.Host = r.Host
+		if _, err := model.InsertHistory(h); err != nil {
+			config.Logger.Error("func model.InsertHistory err", zap.String("uid", "cron"), zap.String("host", r.Host), zap.Error(err))
 		}
-	}()
-	return hosts
+	}
 }
@@ -0,0 +1,270 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/discovery"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// maxDiscoveryUpload : zone files and crt.sh exports of large domains are big
+const maxDiscoveryUpload = 32 << 20
+
+// ProposalRequest : hosts to accept or reject, all means every pending proposal of user
+type ProposalRequest struct {
+	User  string   `json:"user"`
+	Hosts []string `json:"hosts"`
+	All   bool     `json:"all"`
+}
+
+// DiscoveryResult : outcome of a zone or CT import
+type DiscoveryResult struct {
+	Discovered int `json:"discovered"`
+	// Proposed : new proposals, the rest are monitored or proposed already
+	Proposed  []string `json:"proposed"`
+	Monitored []string `json:"monitored"`
+	Known     []string `json:"known"`
+}
+
+// ImportZone : propose hosts of A, AAAA and CNAME records from a BIND zone file or AXFR dump
+func (s *Service) ImportZone(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := r.Form.Get("uid")
+	origin := r.Form.Get("origin")
+	domains := splitList(r.Form.Get("domains"))
+	if uid == "" {
+		w.Write(error4000Response)
+		return
+	}
+	data, err := readUpload(w, r, maxDiscoveryUpload)
+	if err != nil {
+		config.Logger.Error("func readUpload err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4000, Msg: err.Error()}))
+		return
+	}
+	config.Logger.Info("new import zone request", zap.String("uid", uid), zap.String("origin", origin), zap.Int("size", len(data)))
+
+	names, err := discovery.ParseZone(bytes.NewReader(data), origin)
+	if err != nil {
+		config.Logger.Error("func discovery.ParseZone err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4011, Msg: err.Error()}))
+		return
+	}
+	// 只保留 zone 本身的域名，避免 zone 中的外部域名
+	if len(domains) == 0 && origin != "" {
+		domains = []string{origin}
+	}
+	if len(domains) > 0 {
+		filtered := []string{}
+		for _, name := range names {
+			if discovery.InDomains(name, domains) {
+				filtered = append(filtered, name)
+			}
+		}
+		names = filtered
+	}
+	writeProposals(w, uid, names, model.SourceDNSZone)
+}
+
+// ImportCT : propose hosts of a crt.sh JSON export for comma separated apex domains
+func (s *Service) ImportCT(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := r.Form.Get("uid")
+	domains := splitList(r.Form.Get("domains"))
+	if uid == "" || len(domains) == 0 {
+		w.Write(error4000Response)
+		return
+	}
+	data, err := readUpload(w, r, maxDiscoveryUpload)
+	if err != nil {
+		config.Logger.Error("func readUpload err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4000, Msg: err.Error()}))
+		return
+	}
+	config.Logger.Info("new import ct request", zap.String("uid", uid), zap.Strings("domains", domains), zap.Int("size", len(data)))
+
+	names, err := discovery.ParseCTExport(data, domains)
+	if err != nil {
+		config.Logger.Error("func discovery.ParseCTExport err", zap.String("uid", uid), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4011, Msg: err.Error()}))
+		return
+	}
+	writeProposals(w, uid, names, model.SourceCTLog)
+}
+
+// writeProposals : propose hosts which are not monitored yet
+func writeProposals(w http.ResponseWriter, uid string, names []string, source model.Source) {
+	result := DiscoveryResult{
+		Discovered: len(names),
+		Proposed:   []string{},
+		Monitored:  []string{},
+		Known:      []string{},
+	}
+	for _, name := range names {
+		_, monitored, err := model.GetCertInfoByHost(name)
+		if err != nil {
+			config.Logger.Error("func model.GetCertInfoByHost err", zap.String("uid", uid), zap.String("host", name), zap.Error(err))
+			w.Write(error5000Response)
+			return
+		}
+		if monitored {
+			result.Monitored = append(result.Monitored, name)
+			continue
+		}
+		ok, err := model.CreateProposal(name, uid, source)
+		if err != nil {
+			config.Logger.Error("func model.CreateProposal err", zap.String("uid", uid), zap.String("host", name), zap.Error(err))
+			w.Write(error5000Response)
+			return
+		}
+		if ok {
+			result.Proposed = append(result.Proposed, name)
+		} else {
+			result.Known = append(result.Known, name)
+		}
+	}
+	w.Write(genResponseStr(Response{Code: 200, Data: result, Msg: "import discovered hosts success"}))
+}
+
+// GetProposalList : get proposals of user, filtered by status
+func (s *Service) GetProposalList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := r.Form.Get("uid")
+	status := model.ProposalStatus(r.Form.Get("status"))
+	config.Logger.Info("new get proposal list request", zap.String("uid", uid), zap.String("status", string(status)))
+
+	proposalList, _, err := model.GetProposalListByUser(uid, status)
+	if err != nil {
+		config.Logger.Error("func model.GetProposalListByUser err", zap.String("uid", uid), zap.Error(err))
+		w.Write(error5000Response)
+		return
+	}
+	w.Write(genResponseStr(Response{Code: 200, Data: proposalList, Msg: "get proposal list success"}))
+}
+
+// AcceptProposals : add proposed hosts to the monitored set of user
+func (s *Service) AcceptProposals(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req, proposals, ok := pendingProposals(w, r)
+	if !ok {
+		return
+	}
+	config.Logger.Info("new accept proposals request", zap.String("uid", req.User), zap.Int("count", len(proposals)))
+
+	accepted := []string{}
+	for _, p := range proposals {
+		c := model.CertModel{
+			Host:   p.Host,
+			Port:   defaultProbePort,
+			User:   []string{req.User},
+			Source: p.Sources[0],
+		}
+		ok, err := createCertInfo(req.User, c)
+		if err != nil {
+			config.Logger.Error("func model.CreateCertInfo err", zap.String("uid", req.User), zap.String("host", p.Host), zap.Error(err))
+			continue
+		}
+		if !ok {
+			// host 已被其他请求添加，提议不再需要处理
+			config.Logger.Info("proposed host already exists", zap.String("uid", req.User), zap.String("host", p.Host))
+		}
+		accepted = append(accepted, p.Host)
+	}
+	if _, err := model.UpdateProposalStatus(req.User, accepted, model.ProposalAccepted); err != nil {
+		config.Logger.Error("func model.UpdateProposalStatus err", zap.String("uid", req.User), zap.Error(err))
+		w.Write(error5000Response)
+		return
+	}
+	w.Write(genResponseStr(Response{Code: 200, Data: accepted, Msg: "accept proposals success"}))
+}
+
+// RejectProposals : reject proposed hosts, they are not proposed again
+func (s *Service) RejectProposals(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req, proposals, ok := pendingProposals(w, r)
+	if !ok {
+		return
+	}
+	config.Logger.Info("new reject proposals request", zap.String("uid", req.User), zap.Int("count", len(proposals)))
+
+	hosts := make([]string, 0, len(proposals))
+	for _, p := range proposals {
+		hosts = append(hosts, p.Host)
+	}
+	if _, err := model.UpdateProposalStatus(req.User, hosts, model.ProposalRejected); err != nil {
+		config.Logger.Error("func model.UpdateProposalStatus err", zap.String("uid", req.User), zap.Error(err))
+		w.Write(error5000Response)
+		return
+	}
+	w.Write(genResponseStr(Response{Code: 200, Data: hosts, Msg: "reject proposals success"}))
+}
+
+// pendingProposals : decode ProposalRequest and select the pending proposals it names
+func pendingProposals(w http.ResponseWriter, r *http.Request) (ProposalRequest, []model.ProposalModel, bool) {
+	req := ProposalRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.User == "" || (!req.All && len(req.Hosts) == 0) {
+		config.Logger.Error("func pendingProposals decode json err", zap.String("uid", req.User), zap.Error(err))
+		w.Write(error4000Response)
+		return req, nil, false
+	}
+	proposalList, _, err := model.GetProposalListByUser(req.User, model.ProposalPending)
+	if err != nil {
+		config.Logger.Error("func model.GetProposalListByUser err", zap.String("uid", req.User), zap.Error(err))
+		w.Write(error5000Response)
+		return req, nil, false
+	}
+	if req.All {
+		return req, proposalList, true
+	}
+
+	wanted := map[string]bool{}
+	for _, host := range req.Hosts {
+		wanted[strings.ToLower(strings.TrimSpace(host))] = true
+	}
+	proposals := []model.ProposalModel{}
+	for _, p := range proposalList {
+		if wanted[p.Host] {
+			proposals = append(proposals, p)
+		}
+	}
+	return req, proposals, true
+}
+
+// readUpload : multipart file field or raw request body
+func readUpload(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		body = file
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		// application/x-www-form-urlencoded 的请求体已被 ParseForm 读取
+		return nil, errors.New("empty upload, send the file as multipart field file or as raw body with a non-form content type")
+	}
+	return data, nil
+}
+
+// splitList : comma separated values
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,111 @@
+package httpd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+var error4010Response = genResponseStr(Response{Code: 4010, Msg: "certificate file is missing or too large"})
+
+// FileCertInfo : cert parsed from an uploaded file
+type FileCertInfo struct {
+	model.CertInfo
+	// KeyMatched : a private key in the same file belongs to this cert
+	KeyMatched bool `json:"key_matched"`
+	// Expiring : within the same notice window as monitored hosts
+	Expiring     bool   `json:"expiring"`
+	SignatureAlg string `json:"signature_alg"`
+	// SunsetAlg : signature algorithm no longer trusted at cert expiry
+	SunsetAlg string `json:"sunset_alg,omitempty"`
+}
+
+// FileResult : check result of an uploaded file
+type FileResult struct {
+	File          string         `json:"file"`
+	Certs         []FileCertInfo `json:"certs"`
+	Keys          int            `json:"keys"`
+	UnmatchedKeys int            `json:"unmatched_keys"`
+}
+
+// CheckCertFile : check an uploaded PEM, DER, PKCS#12 or Java keystore file
+func (s *Service) CheckCertFile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid := r.Form.Get("uid")
+	r.Body = http.MaxBytesReader(w, r.Body, 2*certcheck.MaxFileSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		config.Logger.Error("func CheckCertFile get form file err", zap.String("uid", uid), zap.Error(err))
+		w.Write(error4010Response)
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, certcheck.MaxFileSize+1))
+	if err != nil || len(data) > certcheck.MaxFileSize {
+		config.Logger.Error("func CheckCertFile read form file err", zap.String("uid", uid), zap.String("file", header.Filename), zap.Error(err))
+		w.Write(error4010Response)
+		return
+	}
+	config.Logger.Info("new check cert file request", zap.String("uid", uid), zap.String("file", header.Filename), zap.Int("size", len(data)))
+
+	bundle, err := certcheck.Parse(header.Filename, data, r.FormValue("password"))
+	if err != nil {
+		config.Logger.Error("func certcheck.Parse err", zap.String("uid", uid), zap.String("file", header.Filename), zap.Error(err))
+		w.Write(genResponseStr(Response{Code: 4011, Msg: err.Error()}))
+		return
+	}
+
+	w.Write(genResponseStr(Response{
+		Code: 200,
+		Data: checkBundle(bundle, time.Now()),
+		Msg:  "check cert file success",
+	}))
+}
+
+// checkBundle : expiry, signature algorithm and key match of parsed certs
+func checkBundle(b *certcheck.Bundle, timeNow time.Time) FileResult {
+	result := FileResult{
+		File:          b.Path,
+		Certs:         []FileCertInfo{},
+		Keys:          len(b.Keys),
+		UnmatchedKeys: len(b.UnmatchedKeys()),
+	}
+	for _, cert := range b.Certs {
+		_, matched := b.KeyFor(cert)
+		info := FileCertInfo{
+			CertInfo:     fileCertInfo(cert, timeNow),
+			KeyMatched:   matched,
+			SignatureAlg: cert.SignatureAlgorithm.String(),
+		}
+		info.Expiring = info.ExpireHours <= expireNoticeHours(cert.IsCA)
+		// 根证书的签名不参与校验，不提示
+		if alg, sunset := certcheck.SunsetSigAlg(cert); sunset && !probe.IsSelfSigned(cert) {
+			info.SunsetAlg = alg.Name
+		}
+		result.Certs = append(result.Certs, info)
+	}
+	return result
+}
+
+func fileCertInfo(cert *x509.Certificate, timeNow time.Time) model.CertInfo {
+	return model.CertInfo{
+		CommonName:   cert.Subject.CommonName,
+		Issuer:       cert.Issuer.CommonName,
+		SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+		ExpireHours:  int64(cert.NotAfter.Sub(timeNow).Hours()),
+		IsCA:         cert.IsCA,
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+}
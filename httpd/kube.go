@@ -0,0 +1,131 @@
+package httpd
+
+import (
+	"context"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/kube"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"go.uber.org/zap"
+)
+
+var (
+	kubeDiscoveryInterval = time.Hour
+	kubeRequestTimeout    = 30 * time.Second
+)
+
+// kubeDiscoveryEnabled : kubernetes discovery runs if kubeconfig or in-cluster credentials are configured
+func kubeDiscoveryEnabled() bool {
+	return config.KubeConfig != "" || config.KubeInCluster
+}
+
+func kubeConfig() (*kube.Config, error) {
+	if config.KubeInCluster {
+		return kube.InClusterConfig()
+	}
+	return kube.LoadKubeconfig(config.KubeConfig, config.KubeContext)
+}
+
+// syncKubernetes : register Ingress and Gateway TLS hosts and TLS secrets not served by them
+func syncKubernetes(ctx context.Context) {
+	cfg, err := kubeConfig()
+	if err != nil {
+		config.Logger.Error("func kubeConfig err", zap.String("uid", "cron"), zap.Error(err))
+		return
+	}
+	inv, err := kube.NewClient(cfg, kubeRequestTimeout).Discover(ctx)
+	if err != nil {
+		config.Logger.Error("func kube.Discover err", zap.String("uid", "cron"), zap.Error(err))
+		return
+	}
+
+	timeNow := time.Now()
+	secrets := map[string]kube.Secret{}
+	for _, s := range inv.Secrets {
+		if s.Err != nil {
+			config.Logger.Error("kubernetes tls secret parse err", zap.String("uid", "cron"), zap.String("secret", s.Key()), zap.Error(s.Err))
+			continue
+		}
+		secrets[s.Key()] = s
+	}
+
+	served := map[string]bool{}
+	inserted := 0
+	for _, e := range inv.Endpoints {
+		c := model.CertModel{
+			Host:   e.Host,
+			Port:   e.Port,
+			Source: model.SourceKubernetes,
+			Labels: kubeLabels(e.Meta),
+			User:   kubeUsers(e.Meta),
+		}
+		if e.Secret != "" {
+			served[e.Secret] = true
+			c.Labels["secret"] = e.Secret
+			// 新增 host 在首次探测前先使用 secret 中的证书
+			if s, ok := secrets[e.Secret]; ok {
+				c.Cert = secretCertInfo(s, timeNow)
+			}
+		}
+		if syncKubeCertModel(c) {
+			inserted++
+		}
+	}
+
+	for key, s := range secrets {
+		if served[key] {
+			continue
+		}
+		c := model.CertModel{
+			Host:   "secret/" + key,
+			Source: model.SourceKubernetesSecret,
+			Labels: kubeLabels(s.Meta),
+			User:   kubeUsers(s.Meta),
+			Cert:   secretCertInfo(s, timeNow),
+		}
+		if syncKubeCertModel(c) {
+			inserted++
+		}
+	}
+	config.Logger.Info("crontab func syncKubernetes success", zap.String("uid", "cron"), zap.Int("endpoints", len(inv.Endpoints)), zap.Int("secrets", len(inv.Secrets)), zap.Int("inserted", inserted))
+}
+
+func syncKubeCertModel(c model.CertModel) bool {
+	inserted, err := syncCertInfo(kubernetesActor, c)
+	if err != nil {
+		config.Logger.Error("func syncCertInfo err", zap.String("uid", "cron"), zap.String("host", c.Host), zap.Error(err))
+		return false
+	}
+	return inserted
+}
+
+func kubeLabels(m kube.Meta) map[string]string {
+	labels := map[string]string{
+		"namespace": m.Namespace,
+		"kind":      m.Kind,
+		"name":      m.Name,
+	}
+	if owner := m.Owner; owner != "" {
+		labels["owner"] = owner
+	} else if m.Controller != "" {
+		labels["owner"] = m.Controller
+	}
+	return labels
+}
+
+func kubeUsers(m kube.Meta) []string {
+	if m.Owner == "" {
+		return nil
+	}
+	return []string{m.Owner}
+}
+
+func secretCertInfo(s kube.Secret, timeNow time.Time) []model.CertInfo {
+	certs := make([]model.CertInfo, 0, len(s.Certs))
+	for _, cert := range s.Certs {
+		certs = append(certs, fileCertInfo(cert, timeNow))
+	}
+	return certs
+}
@@ -0,0 +1,128 @@
+package httpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// defaultExpiringDays : expiring window of /groups without days
+const defaultExpiringDays = 30
+
+// HostLabelsRequest : change labels and criticality of a host
+type HostLabelsRequest struct {
+	// Labels : labels to set, a null value removes the label, labels not listed are kept
+	Labels map[string]*string `json:"labels,omitempty"`
+	// Criticality : low, medium, high or critical, empty resets to medium, absent keeps it
+	Criticality *model.Criticality `json:"criticality,omitempty"`
+}
+
+// HostGroups : hosts grouped by a field
+type HostGroups struct {
+	By     string            `json:"by"`
+	Days   int               `json:"days"`
+	Groups []model.CertGroup `json:"groups"`
+}
+
+// labelRoutes : label and criticality routes of /api/v1
+func (s *Service) labelRoutes() []apiRoute {
+	badRequest := apiResponse{Status: http.StatusBadRequest, Description: "invalid arguments", Body: APIError{}}
+	dbError := apiResponse{Status: http.StatusInternalServerError, Description: "database error", Body: APIError{}}
+
+	return []apiRoute{
+		{
+			Method: "PATCH", Path: "/hosts/:id", Handle: s.apiPatchHost,
+			Summary: "Set or remove labels and set the criticality of a host",
+			Params: []apiParam{
+				{Name: "id", In: "path", Description: "host id, or the host name", Required: true},
+				uidQueryParam,
+			},
+			Body: HostLabelsRequest{},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "the host", Body: model.CertModel{}},
+				badRequest,
+				{Status: http.StatusNotFound, Description: "host not found", Body: APIError{}},
+				dbError,
+			},
+		},
+		{
+			Method: "GET", Path: "/groups/:by", Handle: s.apiGroupHosts,
+			Summary: "Count hosts by team, criticality, source or a label, with expired, expiring and failing hosts",
+			Params: append([]apiParam{
+				{Name: "by", In: "path", Description: "team, criticality, source or label:<key>", Required: true},
+				{Name: "days", In: "query", Description: "expiring window in days, default 30"},
+			}, certQueryParams[:len(certQueryParams)-3]...),
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "groups sorted by value", Body: HostGroups{}}, badRequest, dbError},
+		},
+	}
+}
+
+func (s *Service) apiPatchHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := HostLabelsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	set, unset, err := model.SplitLabels(req.Labels)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.Criticality != nil && *req.Criticality != "" && !model.ValidCriticality(*req.Criticality) {
+		writeAPIError(w, http.StatusBadRequest, "invalid criticality %q, use low, medium, high or critical", *req.Criticality)
+		return
+	}
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+
+	actor := requestActor(r)
+	config.Logger.Info("new patch host request", zap.String("uid", actor), zap.String("host", c.Host), zap.Any("labels", req.Labels), zap.Any("criticality", req.Criticality))
+	if _, err := model.UpdateCertInfoLabels(c.Host, set, unset, req.Criticality); err != nil {
+		config.Logger.Error("func model.UpdateCertInfoLabels err", zap.String("uid", actor), zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	recordAudit(actor, model.AuditUpdate, c.Host, &c)
+	if c, ok = findHostOrError(w, c.Host); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+func (s *Service) apiGroupHosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	by := ps.ByName("by")
+	field, ok := model.GroupField(by)
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "invalid group %q, use team, criticality, source or label:<key>", by)
+		return
+	}
+	days := defaultExpiringDays
+	if v := r.Form.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid days %q", v)
+			return
+		}
+		days = n
+	}
+	q, _, err := parseCertQuery(r.Form)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	groups, err := model.GetCertInfoGroups(q, field, days)
+	if err != nil {
+		config.Logger.Error("func model.GetCertInfoGroups err", zap.String("by", by), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, HostGroups{By: by, Days: days, Groups: groups})
+}
@@ -0,0 +1,158 @@
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/election"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// cronLease : lease held by the replica running the cron jobs
+	cronLease = "cron"
+	// leaseTTL : expiry is computed from the mongo server clock, the local clocks of replicas only
+	// pace the renewals, so skew between them does not shorten or extend the lease
+	leaseTTL           = 30 * time.Second
+	leaseRenewInterval = 10 * time.Second
+)
+
+var (
+	leader = newLeaderElector(leaderID())
+
+	cronLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cert_cron_leader",
+		Help: "Whether this replica holds the cron lease.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cronLeader)
+}
+
+// LeaderStatus : holder of the cron lease, and whether it is this replica
+type LeaderStatus struct {
+	model.LeaseModel
+	Self    string `json:"self"`
+	Leading bool   `json:"leading"`
+	// Expired : no replica holds the lease, the next to renew takes it
+	Expired bool `json:"expired"`
+}
+
+// leaderElector : keep trying to hold the cron lease, only the holder runs the cron jobs
+type leaderElector struct {
+	*election.Elector
+}
+
+func newLeaderElector(id string) *leaderElector {
+	l := &leaderElector{&election.Elector{
+		Store: model.LeaseStore{},
+		Name:  cronLease,
+		ID:    id,
+		TTL:   leaseTTL,
+	}}
+	l.OnChange = l.changed
+	return l
+}
+
+// leaderID : hostname-pid-random, unique per process
+func leaderID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), bson.NewObjectId().Hex()[18:])
+}
+
+func (l *leaderElector) isLeader() bool {
+	return l.IsLeader()
+}
+
+// changed : 成为 leader 时从数据库加载探测结果，失去时清空，避免导出过期的结果
+func (l *leaderElector) changed(leading bool) {
+	config.Logger.Info("cron leadership changed", zap.String("uid", "cron"), zap.String("holder", l.ID), zap.Bool("leading", leading))
+	if leading {
+		cronLeader.Set(1)
+		loadProbeMetrics()
+	} else {
+		cronLeader.Set(0)
+		certMetrics.Reset()
+	}
+}
+
+// renew : acquire or renew the lease once, leadership is dropped if the lease cannot be renewed
+func (l *leaderElector) renew() {
+	if err := l.Renew(); err != nil {
+		l.logError("func model.AcquireLease err", err)
+	}
+}
+
+// run : renew the lease every leaseRenewInterval until ctx is canceled, a lease not renewed for leaseTTL
+// is taken over by another replica
+func (l *leaderElector) run(ctx context.Context) {
+	l.Run(ctx.Done(), leaseRenewInterval, func(err error) {
+		l.logError("func model.AcquireLease err", err)
+	})
+}
+
+// release : give up the lease on shutdown, so another replica takes over without waiting for it to expire
+func (l *leaderElector) release() {
+	released, err := l.Release()
+	if err != nil {
+		l.logError("func model.ReleaseLease err", err)
+		return
+	}
+	if released {
+		config.Logger.Info("cron lease released", zap.String("uid", "cron"), zap.String("holder", l.ID))
+	}
+}
+
+// due : whether this replica leads and job has not run under the lease for interval
+func (l *leaderElector) due(job string, interval time.Duration) bool {
+	ok, err := l.Due(job, interval, time.Now())
+	if err != nil {
+		config.Logger.Error("func model.GetLease err", zap.String("uid", "cron"), zap.String("job", job), zap.Error(err))
+	}
+	return ok
+}
+
+// markRun : record the start of job so a new leader does not repeat it
+func (l *leaderElector) markRun(job string, stime time.Time) {
+	if err := l.MarkRun(job, stime); err != nil {
+		config.Logger.Error("func model.MarkLeaseRun err", zap.String("uid", "cron"), zap.String("job", job), zap.Error(err))
+	}
+}
+
+func (l *leaderElector) logError(msg string, err error) {
+	config.Logger.Error(msg, zap.String("uid", "cron"), zap.String("holder", l.ID), zap.Error(err))
+}
+
+func (s *Service) apiGetLeader(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	lease, exists, err := model.GetLease(cronLease)
+	if err != nil {
+		config.Logger.Error("func model.GetLease err", zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	now, err := model.ServerTime()
+	if err != nil {
+		config.Logger.Error("func model.ServerTime err", zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, LeaderStatus{
+		LeaseModel: lease,
+		Self:       leader.ID,
+		Leading:    leader.isLeader(),
+		Expired:    !exists || !lease.ExpireAt.After(now),
+	})
+}
@@ -0,0 +1,98 @@
+package httpd
+
+import (
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/metrics"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	certMetrics = metrics.NewCertCollector(config.MetricLabels)
+
+	notificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cert_notifications_total",
+		Help: "Number of notifications by channel and result.",
+	}, []string{"channel", "result"})
+
+	cronRunDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cert_cron_run_duration_seconds",
+		Help: "Duration of the last cron run, job schedule is the tick queueing due hosts, not the probes.",
+	}, []string{"job"})
+
+	cronRunTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cert_cron_run_timestamp_seconds",
+		Help: "Unix time the last cron run finished.",
+	}, []string{"job"})
+)
+
+func init() {
+	prometheus.MustRegister(certMetrics, notificationsTotal, cronRunDuration, cronRunTimestamp)
+}
+
+// setProbeMetrics : export probe result r of host c, a failed probe keeps the last certs.
+// Only the leader exports probe metrics, the others leave them to its next loadProbeMetrics.
+func setProbeMetrics(c model.CertModel, r HostResult) {
+	if !leader.isLeader() {
+		return
+	}
+	snapshot := metrics.Snapshot{
+		Port:        r.Port,
+		Success:     r.err == nil,
+		Duration:    r.duration,
+		Certs:       r.Certs,
+		Time:        r.probeTime,
+		Criticality: c.Level(),
+		Team:        c.Team,
+		Labels:      c.Labels,
+	}
+	// 探测失败时保留上一次的证书信息
+	if r.err != nil {
+		if last, ok := certMetrics.Get(r.Host); ok {
+			snapshot.Certs = last.Certs
+		}
+	}
+	certMetrics.Set(r.Host, snapshot)
+}
+
+// loadProbeMetrics : export the last probe results stored in the database, on becoming the leader
+// and every metricsLoadInterval for results pushed by agents to other replicas
+func loadProbeMetrics() {
+	certModelList, err := model.GetProbedCertInfoList()
+	if err != nil {
+		config.Logger.Error("func model.GetProbedCertInfoList err", zap.String("uid", "cron"), zap.Error(err))
+		return
+	}
+	stored := make(map[string]metrics.Snapshot, len(certModelList))
+	for _, cm := range certModelList {
+		stored[cm.Host] = metrics.Snapshot{
+			Port:        normalizePort(cm.Port),
+			Success:     cm.ProbeError == "",
+			Certs:       cm.Cert,
+			Time:        cm.ProbeTime,
+			Criticality: cm.Level(),
+			Team:        cm.Team,
+			Labels:      cm.Labels,
+		}
+	}
+	certMetrics.Load(stored)
+}
+
+// observeCronRun : record duration of cron job run
+func observeCronRun(job string, stime time.Time) {
+	cronRunDuration.WithLabelValues(job).Set(time.Since(stime).Seconds())
+	cronRunTimestamp.WithLabelValues(job).Set(float64(time.Now().Unix()))
+}
+
+// observeNotification : record notification result by channel
+func observeNotification(channel string, err error) {
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	notificationsTotal.WithLabelValues(channel, result).Inc()
+}
@@ -1,17 +1,100 @@
 package httpd
 
 import (
+	"context"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/lifecycle"
 	"git.ifengidc.com/likuo/go-check-certs/model"
 	"git.ifengidc.com/likuo/go-check-certs/third/message"
+	"go.uber.org/zap"
 	"strings"
+	"time"
+)
+
+var (
+	// sending : notifications being sent, drained on shutdown and canceled when draining times out
+	sending = lifecycle.NewDrain()
 )
 
 // noticeToUser : send expires info to user when the domain cert will expire by wxwork notice
-func noticeToUser(cm model.CertModel, ci model.CertInfo) bool {
-	go message.Wechat(
-		strings.Join(cm.User, "|"),
-		"HTTPS证书过期提醒",
-		"检测域名: "+cm.Host+"\n主题名称: "+ci.CommonName+"\n过期时间: "+ci.NotAfter.Format("2006-01-02 15:04:05")+"\n是否CA: "+swapBoolToString(ci.IsCA),
-		"https://"+cm.Host)
-	return true
+func noticeToUser(cm model.CertModel, p NoticePolicy, ci model.CertInfo) bool {
+	title := "HTTPS证书过期提醒"
+	content := "检测域名: " + cm.Host + "\n主题名称: " + ci.CommonName + "\n过期时间: " + ci.NotAfter.Format("2006-01-02 15:04:05") + "\n是否CA: " + swapBoolToString(ci.IsCA)
+	if ci.Revocation.Status == model.RevocationRevoked {
+		title = "HTTPS证书吊销提醒"
+		content += "\n吊销时间: " + ci.Revocation.RevokedAt.Format("2006-01-02 15:04:05") + "\n检查来源: " + ci.Revocation.Source
+	}
+	return notify(cm, p, title, content)
+}
+
+// noticeStapleToUser : send ocsp stapling problem to user by wxwork notice
+func noticeStapleToUser(cm model.CertModel, p NoticePolicy, reason string) bool {
+	return notify(cm, p,
+		"HTTPS证书OCSP Stapling提醒",
+		"检测域名: "+cm.Host+"\n是否Must-Staple: "+swapBoolToString(cm.Staple.MustStaple)+"\n问题描述: "+reason)
+}
+
+// notify : send to the users of cm and policy p by wxwork notice, and to the webhooks of p.
+// Returns false if there is no one to notice.
+func notify(cm model.CertModel, p NoticePolicy, title, content string) bool {
+	sent := false
+	if users := noticeUsers(cm, p.Users); len(users) > 0 && p.wechat() {
+		uid := strings.Join(users, "|")
+		sendAsync(func(ctx context.Context) {
+			sendWechat(ctx, uid, title, content, "https://"+cm.Host)
+		})
+		sent = true
+	}
+	for _, url := range p.Webhooks {
+		url := url
+		event := WebhookEvent{
+			Host:        cm.Host,
+			Title:       title,
+			Content:     content,
+			Criticality: cm.Level(),
+			Team:        cm.Team,
+			Labels:      cm.Labels,
+			Policy:      p.Name,
+			Time:        time.Now(),
+		}
+		sendAsync(func(ctx context.Context) {
+			sendWebhook(ctx, url, event)
+		})
+		sent = true
+	}
+	return sent
+}
+
+// noticeUsers : users of cm, extra users and members on call of its team, who have not snoozed or acked its reminders
+func noticeUsers(cm model.CertModel, extra []string) []string {
+	now := time.Now()
+	candidates := append(append([]string{}, cm.User...), extra...)
+	if cm.Team != "" {
+		team, exists, err := model.GetTeamByName(cm.Team)
+		if err != nil {
+			config.Logger.Error("func model.GetTeamByName err", zap.String("uid", "cron"), zap.String("team", cm.Team), zap.Error(err))
+		}
+		if exists {
+			candidates = append(candidates, team.OnCall(now)...)
+		}
+	}
+
+	users := []string{}
+	for _, user := range model.RemoveDuplicateElement(candidates) {
+		if !cm.Muted(user, now) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// sendAsync : run send in the background, shutdown waits for it before exiting
+func sendAsync(send func(ctx context.Context)) {
+	sending.Go(send)
+}
+
+// sendWechat : send wechat work message and record result
+func sendWechat(ctx context.Context, uid, title, content, url string) {
+	err := message.Wechat(ctx, uid, title, content, url)
+	observeNotification("wechat", err)
 }
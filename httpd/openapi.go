@@ -0,0 +1,30 @@
+package httpd
+
+import "git.ifengidc.com/likuo/go-check-certs/openapi"
+
+// apiRoute, apiParam, apiResponse : see openapi.Route
+type (
+	apiRoute    = openapi.Route
+	apiParam    = openapi.Param
+	apiResponse = openapi.Response
+)
+
+// certQueryParams : query parameters of parseCertQuery
+var certQueryParams = []apiParam{
+	{Name: "user", In: "query", Description: "hosts of user"},
+	{Name: "team", In: "query", Description: "hosts of team"},
+	{Name: "status", In: "query", Description: "online (default), offline or all"},
+	{Name: "min_days", In: "query", Description: "minimum days until the soonest cert expiry"},
+	{Name: "max_days", In: "query", Description: "maximum days until the soonest cert expiry"},
+	{Name: "issuer", In: "query", Description: "substring of any cert issuer, case insensitive"},
+	{Name: "error", In: "query", Description: "true for hosts whose last probe failed, false for the others"},
+	{Name: "discrepancy", In: "query", Description: "true for hosts whose results differ between vantage points, false for the others"},
+	{Name: "label", In: "query", Description: "key=value, repeatable"},
+	{Name: "criticality", In: "query", Description: "low, medium, high or critical, comma separated, medium includes hosts without criticality"},
+	{Name: "sort", In: "query", Description: "host (default), expiry, add_time or update_time, - prefix for descending"},
+	{Name: "page", In: "query", Description: "page number, default 1"},
+	{Name: "limit", In: "query", Description: "page size, default 50, at most 1000"},
+}
+
+// uidQueryParam : actor of a change, see requestActor
+var uidQueryParam = apiParam{Name: "uid", In: "query", Description: "user making the change, recorded in the audit log"}
@@ -0,0 +1,177 @@
+package httpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// noticePolicies : replaced on reload
+	noticePolicies     []NoticePolicy
+	noticePoliciesLock sync.RWMutex
+	webhookClient      = &http.Client{Timeout: 10 * time.Second}
+)
+
+// NoticePolicyFile : format of config.NoticePolicyFile
+//
+//	policies:
+//	  - name: prod-critical
+//	    selector: {env: prod}
+//	    criticality: [high, critical]
+//	    notice_days: 60
+//	    users: [sre-oncall]
+//	    webhooks: [https://hooks.example.com/certs]
+//	    wechat: true
+type NoticePolicyFile struct {
+	Policies []NoticePolicy `yaml:"policies"`
+}
+
+// NoticePolicy : thresholds and receivers of hosts matching Selector and Criticality, the first matching policy wins
+type NoticePolicy struct {
+	Name string `yaml:"name"`
+	// Selector : labels the host must have, empty matches all hosts
+	Selector map[string]string `yaml:"selector"`
+	// Criticality : empty matches all levels
+	Criticality []model.Criticality `yaml:"criticality"`
+	// NoticeDays, CANoticeDays : 0 means the default of the criticality
+	NoticeDays   int `yaml:"notice_days"`
+	CANoticeDays int `yaml:"ca_notice_days"`
+	// Users : noticed in addition to the users and team of the host
+	Users    []string `yaml:"users"`
+	Webhooks []string `yaml:"webhooks"`
+	// Wechat : nil means true
+	Wechat *bool `yaml:"wechat"`
+}
+
+// WebhookEvent : body posted to the webhooks of a policy
+type WebhookEvent struct {
+	Host        string            `json:"host"`
+	Title       string            `json:"title"`
+	Content     string            `json:"content"`
+	Criticality model.Criticality `json:"criticality"`
+	Team        string            `json:"team,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Policy      string            `json:"policy,omitempty"`
+	Time        time.Time         `json:"time"`
+}
+
+// loadNoticePolicies : read the notice policy file if set, no policies otherwise
+func loadNoticePolicies() error {
+	path := config.Settings().Notice.PolicyFile
+	if path == "" {
+		noticePoliciesLock.Lock()
+		noticePolicies = nil
+		noticePoliciesLock.Unlock()
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file := NoticePolicyFile{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return err
+	}
+	for i, p := range file.Policies {
+		if p.Name == "" {
+			return fmt.Errorf("policy %d: name is required", i+1)
+		}
+		for _, c := range p.Criticality {
+			if !model.ValidCriticality(c) {
+				return fmt.Errorf("policy %s: invalid criticality %q", p.Name, c)
+			}
+		}
+		if p.NoticeDays < 0 || p.CANoticeDays < 0 {
+			return fmt.Errorf("policy %s: notice days must not be negative", p.Name)
+		}
+	}
+	noticePoliciesLock.Lock()
+	noticePolicies = file.Policies
+	noticePoliciesLock.Unlock()
+	config.Logger.Info("notice policies loaded", zap.String("file", path), zap.Int("policies", len(file.Policies)))
+	return nil
+}
+
+// matches : whether host cm is selected by p
+func (p NoticePolicy) matches(cm model.CertModel) bool {
+	return cm.HasLabels(p.Selector) && cm.LevelIn(p.Criticality)
+}
+
+// noticePolicyFor : first policy matching cm, or the default policy
+func noticePolicyFor(cm model.CertModel) NoticePolicy {
+	noticePoliciesLock.RLock()
+	defer noticePoliciesLock.RUnlock()
+	for _, p := range noticePolicies {
+		if p.matches(cm) {
+			return p
+		}
+	}
+	return NoticePolicy{}
+}
+
+// noticeHours : hours before expiry to notice cert of host cm, the configured notice days if p does not set them
+func (p NoticePolicy) noticeHours(cm model.CertModel, isCA bool) int64 {
+	notice := config.Settings().Notice
+	days := p.NoticeDays
+	if isCA {
+		days = p.CANoticeDays
+		if days == 0 {
+			days = notice.CADays
+		}
+	}
+	if days == 0 {
+		days = notice.Days[string(cm.Level())]
+	}
+	return int64(days) * 24
+}
+
+func (p NoticePolicy) wechat() bool {
+	return p.Wechat == nil || *p.Wechat
+}
+
+// hasReceivers : whether the policy notices anyone besides the users and team of the host
+func (p NoticePolicy) hasReceivers() bool {
+	return len(p.Webhooks) > 0 || (len(p.Users) > 0 && p.wechat())
+}
+
+// sendWebhook : post event to url and record result
+func sendWebhook(ctx context.Context, url string, event WebhookEvent) {
+	err := postWebhook(ctx, url, event)
+	if err != nil {
+		config.Logger.Error("func postWebhook err", zap.String("uid", "cron"), zap.String("host", event.Host), zap.String("url", url), zap.Error(err))
+	}
+	observeNotification("webhook", err)
+}
+
+func postWebhook(ctx context.Context, url string, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
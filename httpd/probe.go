@@ -0,0 +1,127 @@
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/metrics"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultProbeModule = probe.DefaultModule
+	defaultProbePort   = probe.DefaultPort
+)
+
+// ProbeModule : how to connect to a probe target
+type ProbeModule = probe.Module
+
+var probeModules = loadProbeModules()
+
+func init() {
+	probe.RevocationOCSP = config.ProbeOCSP
+	probe.RevocationCRL = config.ProbeCRL
+}
+
+// loadProbeModules : built-in probe modules and the modules of the config file
+func loadProbeModules() map[string]ProbeModule {
+	modules := map[string]ProbeModule{}
+	for name, m := range probe.Modules {
+		modules[name] = m
+	}
+	for name, m := range config.ProbeModules {
+		if m.Timeout == 0 {
+			m.Timeout = probe.Modules[defaultProbeModule].Timeout
+		}
+		modules[name] = ProbeModule{Protocol: m.Protocol, Timeout: m.Timeout, RootCAs: m.RootCAs, ServerName: m.ServerName}
+	}
+	return modules
+}
+
+// Probe : probe target cert live and return prometheus metrics of the target only
+func (s *Service) Probe(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	target := r.Form.Get("target")
+	moduleName := r.Form.Get("module")
+	if moduleName == "" {
+		moduleName = defaultProbeModule
+	}
+	module, ok := probeModules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	host, port, err := splitProbeTarget(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 不超过 prometheus 的抓取超时时间
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			timeout := time.Duration((seconds - 0.5) * float64(time.Second))
+			if timeout > 0 && timeout < module.Timeout {
+				module.Timeout = timeout
+			}
+		}
+	}
+
+	result := probeCertInfo(r.Context(), host, port, module)
+	if result.err != nil {
+		config.Logger.Error("func probeCertInfo err", zap.String("target", target), zap.String("module", moduleName), zap.Error(result.err))
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&targetCollector{
+		host: host,
+		snapshot: metrics.Snapshot{
+			Port:     port,
+			Success:  result.err == nil,
+			Duration: result.duration,
+			Certs:    result.Certs,
+		},
+	})
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// targetCollector : export a single probe result for /probe
+type targetCollector struct {
+	host     string
+	snapshot metrics.Snapshot
+}
+
+func (c *targetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metrics.CertExpirySecondsDesc
+	ch <- metrics.CertProbeSuccessDesc
+	ch <- metrics.CertProbeDurationDesc
+}
+
+func (c *targetCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics.CollectSnapshot(ch, c.host, c.snapshot)
+}
+
+// splitProbeTarget : split host:port, port defaults to 443
+func splitProbeTarget(target string) (string, string, error) {
+	if target == "" {
+		return "", "", errors.New("target parameter is missing")
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		if strings.Contains(err.Error(), "missing port") {
+			return strings.Trim(target, "[]"), defaultProbePort, nil
+		}
+		return "", "", err
+	}
+	return host, port, nil
+}
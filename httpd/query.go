@@ -0,0 +1,126 @@
+package httpd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"git.ifengidc.com/likuo/go-check-certs/model"
+)
+
+const defaultPageLimit = 50
+
+// CertInfoPage : a page of cert info list
+type CertInfoPage struct {
+	Total int               `json:"total"`
+	Page  int               `json:"page"`
+	Limit int               `json:"limit"`
+	Items []model.CertModel `json:"items"`
+}
+
+// parseCertQuery : list filters from query parameters
+//
+//	user=likuo            hosts of user
+//	team=sre              hosts of team
+//	status=online         online (default), offline or all
+//	min_days=0&max_days=30  days until the soonest cert expiry
+//	issuer=Let's Encrypt  substring of any cert issuer
+//	error=true            hosts whose last probe failed, false for the others
+//	discrepancy=true      hosts whose results differ between vantage points, false for the others
+//	label=team=sre        repeatable
+//	criticality=high,critical  any of the levels, medium includes hosts without criticality
+//	sort=-expiry          host (default), expiry, add_time or update_time, - for descending
+//	page=1&limit=50       paging, returns CertInfoPage instead of a plain list
+func parseCertQuery(form url.Values) (model.CertQuery, bool, error) {
+	q := model.CertQuery{
+		User:   form.Get("user"),
+		Team:   form.Get("team"),
+		Issuer: form.Get("issuer"),
+		Sort:   form.Get("sort"),
+	}
+
+	switch status := form.Get("status"); status {
+	case "", "online":
+	case "offline":
+		q.Statuses = []model.Status{model.Offline}
+	case "all":
+		q.Statuses = []model.Status{model.Online, model.Offline}
+	default:
+		return q, false, fmt.Errorf("invalid status %q", status)
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **int
+	}{{"min_days", &q.MinDays}, {"max_days", &q.MaxDays}} {
+		if v := form.Get(p.name); v != "" {
+			days, err := strconv.Atoi(v)
+			if err != nil {
+				return q, false, fmt.Errorf("invalid %s %q", p.name, v)
+			}
+			*p.dst = &days
+		}
+	}
+
+	if v := form.Get("error"); v != "" {
+		probeError, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, false, fmt.Errorf("invalid error %q", v)
+		}
+		q.ProbeError = &probeError
+	}
+
+	if v := form.Get("discrepancy"); v != "" {
+		discrepancy, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, false, fmt.Errorf("invalid discrepancy %q", v)
+		}
+		q.Discrepancy = &discrepancy
+	}
+
+	for _, label := range form["label"] {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || strings.ContainsAny(kv[0], ".$") {
+			return q, false, fmt.Errorf("invalid label %q, use key=value", label)
+		}
+		if q.Labels == nil {
+			q.Labels = map[string]string{}
+		}
+		q.Labels[kv[0]] = kv[1]
+	}
+
+	for _, v := range form["criticality"] {
+		for _, c := range strings.Split(v, ",") {
+			if !model.ValidCriticality(model.Criticality(c)) {
+				return q, false, fmt.Errorf("invalid criticality %q, use low, medium, high or critical", c)
+			}
+			q.Criticalities = append(q.Criticalities, model.Criticality(c))
+		}
+	}
+
+	if _, ok := model.CertQuerySorts[strings.TrimPrefix(q.Sort, "-")]; q.Sort != "" && !ok {
+		return q, false, fmt.Errorf("invalid sort %q", q.Sort)
+	}
+
+	// 未指定分页参数时返回全部，兼容原有调用方
+	paged := form.Get("page") != "" || form.Get("limit") != ""
+	if paged {
+		q.Page, q.Limit = 1, defaultPageLimit
+		if v := form.Get("page"); v != "" {
+			page, err := strconv.Atoi(v)
+			if err != nil || page < 1 {
+				return q, false, fmt.Errorf("invalid page %q", v)
+			}
+			q.Page = page
+		}
+		if v := form.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > model.MaxQueryLimit {
+				return q, false, fmt.Errorf("invalid limit %q, must be 1-%d", v, model.MaxQueryLimit)
+			}
+			q.Limit = limit
+		}
+	}
+	return q, paged, nil
+}
@@ -0,0 +1,58 @@
+package httpd
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+
+	"go.uber.org/zap"
+)
+
+// configWatchInterval : how often the config file and the notice policy file are checked for changes
+const configWatchInterval = 10 * time.Second
+
+// Reload : reload the config file and the notice policy file. Changed settings that need a restart
+// are logged and not applied, and the current settings are kept if a file is invalid.
+func Reload() {
+	restart, err := config.Reload()
+	if err != nil {
+		config.Logger.Error("func config.Reload err, keeping current settings", zap.String("file", config.Path), zap.Error(err))
+	} else if len(restart) > 0 {
+		config.Logger.Warn("config changes not applied until restart", zap.String("file", config.Path), zap.Strings("settings", restart))
+	}
+	if err := loadNoticePolicies(); err != nil {
+		config.Logger.Error("func loadNoticePolicies err, keeping current policies", zap.String("file", config.Settings().Notice.PolicyFile), zap.Error(err))
+	}
+	config.Logger.Info("configuration reloaded", zap.String("file", config.Path))
+}
+
+// watchConfig : reload when the config file or the notice policy file changes
+func watchConfig(ctx context.Context) {
+	stamps := configStamps()
+	cronJobs.Every(ctx, configWatchInterval, func() {
+		if configStamps() != stamps {
+			Reload()
+			stamps = configStamps()
+		}
+	})
+}
+
+// configStamps : modification time and size of the config file and the notice policy file
+func configStamps() string {
+	return fileStamp(config.Path) + "|" + fileStamp(config.Settings().Notice.PolicyFile)
+}
+
+// fileStamp : modification time and size of path, empty if it is not set or missing
+func fileStamp(path string) string {
+	if path == "" {
+		return ""
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fi.ModTime().String() + "/" + strconv.FormatInt(fi.Size(), 10)
+}
@@ -0,0 +1,215 @@
+package httpd
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	scheduleInterval = time.Minute
+	// scheduleBatch : hosts queued at most per tick, also the queue size
+	scheduleBatch = 1000
+	// jitterFraction : next checks are spread by this fraction of the delay either way
+	jitterFraction = 0.1
+	// targetProbeLimit : probes of a target, its resolved IP and port, per targetProbeWindow,
+	// hosts sharing a load balancer share the limit
+	targetProbeLimit  = 10
+	targetProbeWindow = time.Minute
+	// metricsLoadInterval : reload probe metrics from the database, see loadProbeMetrics
+	metricsLoadInterval = 5 * time.Minute
+)
+
+var (
+	scheduler = &probeScheduler{queue: make(chan model.CertModel, scheduleBatch), queued: map[string]bool{}}
+	// targetLimiter : limits scheduled probes only, live probes of /probe, checks and chat are not limited
+	targetLimiter = &probeLimiter{probes: map[string][]time.Time{}}
+
+	probeQueueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cert_probe_queue_length",
+		Help: "Number of hosts queued or being probed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(probeQueueLength)
+}
+
+// probeScheduler : queue of hosts due for a probe, a host is never queued twice so slow probes
+// delay the queue instead of overlapping
+type probeScheduler struct {
+	queue chan model.CertModel
+	sync.Mutex
+	// queued : hosts queued or being probed
+	queued   map[string]bool
+	lastLoad time.Time
+}
+
+// start : run workers probing queued hosts until ctx is canceled, probes in flight are aborted
+func (s *probeScheduler) start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		cronJobs.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case c := <-s.queue:
+					s.probe(ctx, c)
+					s.done(c.Host)
+				}
+			}
+		})
+	}
+}
+
+// tick : queue hosts due at now, returns the number queued
+func (s *probeScheduler) tick(now time.Time) int {
+	if now.Sub(s.lastLoad) >= metricsLoadInterval {
+		s.lastLoad = now
+		loadProbeMetrics()
+	}
+
+	certModelList, err := model.GetDueCertInfoList(now, scheduleBatch)
+	if err != nil {
+		config.Logger.Error("func model.GetDueCertInfoList err", zap.String("uid", "cron"), zap.Error(err))
+		return 0
+	}
+	n := 0
+	for _, c := range certModelList {
+		if s.enqueue(c) {
+			n++
+		}
+	}
+	return n
+}
+
+// enqueue : queue c unless it is already queued or the queue is full
+func (s *probeScheduler) enqueue(c model.CertModel) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.queued[c.Host] {
+		return false
+	}
+	select {
+	case s.queue <- c:
+		s.queued[c.Host] = true
+		probeQueueLength.Set(float64(len(s.queued)))
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *probeScheduler) done(host string) {
+	s.Lock()
+	delete(s.queued, host)
+	probeQueueLength.Set(float64(len(s.queued)))
+	s.Unlock()
+}
+
+// probe : probe c, store the result and schedule its next check
+func (s *probeScheduler) probe(ctx context.Context, c model.CertModel) {
+	now := time.Now()
+	port := normalizePort(c.Port)
+	// 同一目标探测过于频繁时推迟，不计为失败
+	if !targetLimiter.allow(ctx, c.Host, port, now) {
+		if err := model.SetNextCheck(c.Host, now.Add(jitter(targetProbeWindow)), c.ProbeFailures); err != nil {
+			config.Logger.Error("func model.SetNextCheck err", zap.String("uid", "cron"), zap.String("host", c.Host), zap.Error(err))
+		}
+		return
+	}
+	r := probeCertInfo(ctx, c.Host, port, probeModules[defaultProbeModule])
+	// 关闭时中断的探测不记录，next_check 不变，由下一个 leader 重新探测
+	if ctx.Err() != nil {
+		return
+	}
+	r.previous = c
+	failures := 0
+	certs := r.Certs
+	if r.err != nil {
+		failures = c.ProbeFailures + 1
+		certs = c.Cert
+	}
+
+	// 多个探测点时，只有主探测点的结果写入 host 和 metrics
+	if len(c.Vantages) > 0 {
+		recordVantageResult(model.CentralVantage, r)
+	}
+	if c.ProbeVantages()[0] == model.CentralVantage {
+		setProbeMetrics(c, r)
+		storeProbeResult("cron", r)
+	}
+
+	next := time.Now().Add(jitter(nextCheckDelay(c, certs, failures, now)))
+	if err := model.SetNextCheck(c.Host, next, failures); err != nil {
+		config.Logger.Error("func model.SetNextCheck err", zap.String("uid", "cron"), zap.String("host", c.Host), zap.Error(err))
+	}
+}
+
+// nextCheckDelay : see model.NextCheckDelay, certs expire within the notice window of the policy of c
+func nextCheckDelay(c model.CertModel, certs []model.CertInfo, failures int, now time.Time) time.Duration {
+	policy := noticePolicyFor(c)
+	return model.NextCheckDelay(certs, failures, now, func(isCA bool) int64 { return policy.noticeHours(c, isCA) })
+}
+
+// jitter : d spread by jitterFraction either way
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*jitterFraction*float64(d))
+}
+
+// probeLimiter : allow targetProbeLimit probes of a target per targetProbeWindow
+type probeLimiter struct {
+	sync.Mutex
+	probes map[string][]time.Time
+}
+
+// target : resolved IP and port of host, the smallest IP if host has several so that the
+// key does not change with the order of DNS answers. host itself if it does not resolve.
+func (l *probeLimiter) target(ctx context.Context, host, port string) string {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return net.JoinHostPort(host, port)
+	}
+	ip := addrs[0].IP.String()
+	for _, addr := range addrs[1:] {
+		if s := addr.IP.String(); s < ip {
+			ip = s
+		}
+	}
+	return net.JoinHostPort(ip, port)
+}
+
+// allow : whether host:port may be probed at now, and record the probe if so
+func (l *probeLimiter) allow(ctx context.Context, host, port string, now time.Time) bool {
+	target := l.target(ctx, host, port)
+	l.Lock()
+	defer l.Unlock()
+	recent := l.probes[target][:0]
+	for _, t := range l.probes[target] {
+		if now.Sub(t) < targetProbeWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= targetProbeLimit {
+		l.probes[target] = recent
+		return false
+	}
+	l.probes[target] = append(recent, now)
+	// 清理过期记录，避免无限增长
+	if len(l.probes) > scheduleBatch*10 {
+		for k, times := range l.probes {
+			if now.Sub(times[len(times)-1]) >= targetProbeWindow {
+				delete(l.probes, k)
+			}
+		}
+	}
+	return true
+}
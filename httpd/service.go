@@ -1,14 +1,18 @@
 package httpd
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/openapi"
+	"git.ifengidc.com/likuo/go-check-certs/web"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
@@ -16,6 +20,7 @@ type Service struct {
 	addr   string
 	ln     net.Listener
 	router *httprouter.Router
+	server *http.Server
 }
 
 func New(listen string) (*Service, error) {
@@ -27,7 +32,7 @@ func New(listen string) (*Service, error) {
 
 func (s *Service) Start() error {
 	s.initHandler()
-	server := http.Server{}
+	server := &http.Server{}
 	server.Handler = s.router
 	server.Handler = s.auth(server.Handler)
 	server.Handler = s.accessLog(cors(server.Handler))
@@ -38,10 +43,11 @@ func (s *Service) Start() error {
 	}
 
 	s.ln = ln
+	s.server = server
 
 	// server
 	go func() {
-		if err := server.Serve(s.ln); err != nil {
+		if err := server.Serve(s.ln); err != nil && err != http.ErrServerClosed {
 			config.Logger.Error("httpd server error", zap.Error(err))
 		}
 	}()
@@ -55,6 +61,11 @@ func (s *Service) Close() error {
 	return nil
 }
 
+// Shutdown : stop accepting connections and wait for requests in flight until ctx is done
+func (s *Service) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
 func (s *Service) initHandler() {
 	s.router.GET("/receive/cert", s.Index)
 	s.router.GET("/receive/cert/check", s.GetCertExpireTime)
@@ -63,6 +74,21 @@ func (s *Service) initHandler() {
 	s.router.DELETE("/receive/cert/check", s.DeleteCertInfo)
 	s.router.GET("/receive/cert/list", s.GetCertInfolist)
 	s.router.GET("/receive/cert/user/list", s.GetCertInfoByUser)
+	s.router.GET("/receive/cert/host", s.GetCertInfoByHost)
+	openapi.Register(s.router, apiV1Prefix, s.apiV1Routes())
+	s.router.GET("/", s.Dashboard)
+	s.router.Handler("GET", web.Prefix+"*filepath", web.Assets())
+	s.router.Handler("GET", "/metrics", promhttp.Handler())
+	s.router.GET("/probe", s.Probe)
+	s.router.POST("/receive/cert/file", s.CheckCertFile)
+	s.router.POST("/receive/cert/import", s.ImportCertInfo)
+	s.router.GET("/receive/cert/export", s.ExportCertInfo)
+	s.router.POST("/receive/cert/discover/zone", s.ImportZone)
+	s.router.POST("/receive/cert/discover/ct", s.ImportCT)
+	s.router.GET("/receive/cert/discover/list", s.GetProposalList)
+	s.router.POST("/receive/cert/discover/accept", s.AcceptProposals)
+	s.router.POST("/receive/cert/discover/reject", s.RejectProposals)
+	s.router.POST("/receive/cert/chat", s.Chat)
 }
 
 func (s *Service) accessLog(inner http.Handler) http.Handler {
@@ -91,6 +117,7 @@ func cors(inner http.Handler) http.Handler {
 				`DELETE`,
 				`GET`,
 				`OPTIONS`,
+				`PATCH`,
 				`POST`,
 				`PUT`,
 			}, ", "))
@@ -0,0 +1,200 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/chatops"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SilenceRequest : create a silence, End or Duration is required
+type SilenceRequest struct {
+	Host     string            `json:"host,omitempty"`
+	Selector map[string]string `json:"selector,omitempty"`
+	// Start : default now
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+	// Duration : from start, 7d or 12h
+	Duration string `json:"duration,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// SilenceInfo : silence with its state at the time of the request
+type SilenceInfo struct {
+	model.SilenceModel
+	State model.SilenceState `json:"state"`
+}
+
+// silenceRoutes : silence routes of /api/v1
+func (s *Service) silenceRoutes() []apiRoute {
+	sidParam := apiParam{Name: "sid", In: "path", Description: "silence id", Required: true}
+	notFound := apiResponse{Status: http.StatusNotFound, Description: "silence not found", Body: APIError{}}
+	badRequest := apiResponse{Status: http.StatusBadRequest, Description: "invalid arguments", Body: APIError{}}
+	dbError := apiResponse{Status: http.StatusInternalServerError, Description: "database error", Body: APIError{}}
+
+	return []apiRoute{
+		{
+			Method: "GET", Path: "/silences", Handle: s.apiListSilences,
+			Summary: "List silences, newest first",
+			Params: []apiParam{
+				{Name: "host", In: "query", Description: "silences of host"},
+				{Name: "state", In: "query", Description: "pending, active, expired or all, comma separated, default pending,active"},
+			},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "silences", Body: []SilenceInfo{}}, badRequest, dbError},
+		},
+		{
+			Method: "POST", Path: "/silences", Handle: s.apiCreateSilence,
+			Summary: "Stop reminders of a host, or of hosts with labels, for a time", Params: []apiParam{uidQueryParam}, Body: SilenceRequest{},
+			Responses: []apiResponse{{Status: http.StatusCreated, Description: "silence created", Body: SilenceInfo{}}, badRequest, dbError},
+		},
+		{
+			Method: "GET", Path: "/silences/:sid", Handle: s.apiGetSilence,
+			Summary: "Get a silence", Params: []apiParam{sidParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the silence", Body: SilenceInfo{}}, notFound, dbError},
+		},
+		{
+			Method: "DELETE", Path: "/silences/:sid", Handle: s.apiExpireSilence,
+			Summary: "Expire a silence now, it is kept in the list", Params: []apiParam{sidParam, uidQueryParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the expired silence", Body: SilenceInfo{}}, notFound, dbError},
+		},
+	}
+}
+
+// validateSilence : silence of req created by creator at now
+func validateSilence(req SilenceRequest, creator string, now time.Time) (model.SilenceModel, error) {
+	si := model.SilenceModel{
+		Host:     strings.ToLower(strings.TrimSpace(req.Host)),
+		Selector: req.Selector,
+		Start:    now,
+		Reason:   strings.TrimSpace(req.Reason),
+		Creator:  creator,
+	}
+	if req.Start != nil {
+		si.Start = *req.Start
+	}
+	switch {
+	case req.End != nil && req.Duration != "":
+		return si, errors.New("set end or duration, not both")
+	case req.End != nil:
+		si.End = *req.End
+	case req.Duration != "":
+		d, ok := chatops.ParseSnooze(req.Duration)
+		if !ok || d <= 0 {
+			return si, fmt.Errorf("invalid duration %q, use 7d or 12h", req.Duration)
+		}
+		si.End = si.Start.Add(d)
+	default:
+		return si, errors.New("end or duration is required")
+	}
+	return si, si.Validate(now)
+}
+
+// findSilenceOrError : find silence by id, or write 404/500
+func findSilenceOrError(w http.ResponseWriter, id string) (model.SilenceModel, bool) {
+	if !bson.IsObjectIdHex(id) {
+		writeAPIError(w, http.StatusNotFound, "silence %s not found", id)
+		return model.SilenceModel{}, false
+	}
+	si, exists, err := model.GetSilenceByID(bson.ObjectIdHex(id))
+	if err != nil {
+		config.Logger.Error("func model.GetSilenceByID err", zap.String("id", id), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return si, false
+	}
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "silence %s not found", id)
+		return si, false
+	}
+	return si, true
+}
+
+func silenceInfo(si model.SilenceModel, now time.Time) SilenceInfo {
+	return SilenceInfo{SilenceModel: si, State: si.State(now)}
+}
+
+// activeSilences : silences active at now, nil if they cannot be read
+func activeSilences(now time.Time) []model.SilenceModel {
+	silenceList, err := model.GetSilenceList("", []model.SilenceState{model.SilenceActive}, now)
+	if err != nil {
+		config.Logger.Error("func model.GetSilenceList err", zap.String("uid", "cron"), zap.Error(err))
+		return nil
+	}
+	return silenceList
+}
+
+func (s *Service) apiListSilences(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	states, err := model.ParseSilenceStates(r.Form.Get("state"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	now := time.Now()
+	silenceList, err := model.GetSilenceList(strings.ToLower(r.Form.Get("host")), states, now)
+	if err != nil {
+		config.Logger.Error("func model.GetSilenceList err", zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	infoList := []SilenceInfo{}
+	for _, si := range silenceList {
+		infoList = append(infoList, silenceInfo(si, now))
+	}
+	writeJSON(w, http.StatusOK, infoList)
+}
+
+func (s *Service) apiCreateSilence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := SilenceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	now := time.Now()
+	si, err := validateSilence(req, requestActor(r), now)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	config.Logger.Info("new create silence request", zap.String("uid", si.Creator), zap.String("host", si.Host), zap.Any("selector", si.Selector), zap.Time("start", si.Start), zap.Time("end", si.End))
+	si, err = model.CreateSilence(si)
+	if err != nil {
+		config.Logger.Error("func model.CreateSilence err", zap.String("uid", si.Creator), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, silenceInfo(si, now))
+}
+
+func (s *Service) apiGetSilence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if si, ok := findSilenceOrError(w, ps.ByName("sid")); ok {
+		writeJSON(w, http.StatusOK, silenceInfo(si, time.Now()))
+	}
+}
+
+func (s *Service) apiExpireSilence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	si, ok := findSilenceOrError(w, ps.ByName("sid"))
+	if !ok {
+		return
+	}
+	actor := requestActor(r)
+	now := time.Now()
+	config.Logger.Info("new expire silence request", zap.String("uid", actor), zap.String("id", si.ID.Hex()))
+	if _, err := model.ExpireSilence(si.ID, actor, now); err != nil {
+		config.Logger.Error("func model.ExpireSilence err", zap.String("uid", actor), zap.String("id", si.ID.Hex()), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if si, ok = findSilenceOrError(w, si.ID.Hex()); ok {
+		writeJSON(w, http.StatusOK, silenceInfo(si, now))
+	}
+}
@@ -0,0 +1,337 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+var teamNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// TeamRequest : create or replace a team
+type TeamRequest struct {
+	Name     string         `json:"name,omitempty"`
+	Members  []string       `json:"members"`
+	Rotation model.Rotation `json:"rotation"`
+}
+
+// TeamInfo : team with its members on call and number of hosts
+type TeamInfo struct {
+	model.TeamModel
+	OnCall []string `json:"on_call"`
+	Hosts  int      `json:"hosts"`
+}
+
+// HostTeamRequest : assign a host to a team, empty team unassigns it
+type HostTeamRequest struct {
+	Team string `json:"team"`
+}
+
+// teamRoutes : team routes of /api/v1
+func (s *Service) teamRoutes() []apiRoute {
+	teamParam := apiParam{Name: "team", In: "path", Description: "team name", Required: true}
+	notFound := apiResponse{Status: http.StatusNotFound, Description: "team not found", Body: APIError{}}
+	badRequest := apiResponse{Status: http.StatusBadRequest, Description: "invalid arguments", Body: APIError{}}
+	dbError := apiResponse{Status: http.StatusInternalServerError, Description: "database error", Body: APIError{}}
+
+	return []apiRoute{
+		{
+			Method: "GET", Path: "/teams", Handle: s.apiListTeams,
+			Summary:   "List teams",
+			Params:    []apiParam{{Name: "member", In: "query", Description: "teams of member"}},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "teams", Body: []TeamInfo{}}, dbError},
+		},
+		{
+			Method: "POST", Path: "/teams", Handle: s.apiCreateTeam,
+			Summary: "Create a team", Body: TeamRequest{},
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "team created", Body: TeamInfo{}},
+				badRequest,
+				{Status: http.StatusConflict, Description: "team exists", Body: APIError{}},
+				dbError,
+			},
+		},
+		{
+			Method: "POST", Path: "/teams/migrate", Handle: s.apiMigrateTeams,
+			Summary: "Assign hosts without a team to the personal team of their first user",
+			Params:  []apiParam{{Name: "dry_run", In: "query", Description: "true to report without changing anything"}, uidQueryParam},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "migration result", Body: model.TeamMigration{}},
+				dbError,
+			},
+		},
+		{
+			Method: "GET", Path: "/teams/:team", Handle: s.apiGetTeam,
+			Summary: "Get a team", Params: []apiParam{teamParam},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the team", Body: TeamInfo{}}, notFound, dbError},
+		},
+		{
+			Method: "PUT", Path: "/teams/:team", Handle: s.apiUpdateTeam,
+			Summary: "Replace members and rotation of a team", Params: []apiParam{teamParam}, Body: TeamRequest{},
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "the team", Body: TeamInfo{}}, badRequest, notFound, dbError},
+		},
+		{
+			Method: "DELETE", Path: "/teams/:team", Handle: s.apiDeleteTeam,
+			Summary: "Delete a team that owns no hosts", Params: []apiParam{teamParam},
+			Responses: []apiResponse{
+				{Status: http.StatusNoContent, Description: "team deleted"},
+				notFound,
+				{Status: http.StatusConflict, Description: "team still owns hosts", Body: APIError{}},
+				dbError,
+			},
+		},
+		{
+			Method: "GET", Path: "/teams/:team/hosts", Handle: s.apiListTeamHosts,
+			Summary: "List hosts of a team", Params: append([]apiParam{teamParam}, certQueryParams...),
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "a page of hosts", Body: CertInfoPage{}}, badRequest, notFound, dbError},
+		},
+		{
+			Method: "PUT", Path: "/hosts/:id/team", Handle: s.apiSetHostTeam,
+			Summary: "Assign a host to a team",
+			Params:  []apiParam{{Name: "id", In: "path", Description: "host id, or the host name", Required: true}, uidQueryParam},
+			Body:    HostTeamRequest{},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "the host", Body: model.CertModel{}},
+				badRequest,
+				{Status: http.StatusNotFound, Description: "host or team not found", Body: APIError{}},
+				dbError,
+			},
+		},
+	}
+}
+
+// validateTeam : check name, members and rotation, the rotation starts now if no start is given
+func validateTeam(t *model.TeamModel) error {
+	if !teamNameRegexp.MatchString(t.Name) {
+		return fmt.Errorf("invalid team name %q", t.Name)
+	}
+	members := []string{}
+	for _, m := range t.Members {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	t.Members = model.RemoveDuplicateElement(members)
+	if len(t.Members) == 0 {
+		return errors.New("a team needs at least one member")
+	}
+
+	r := &t.Rotation
+	if len(r.Members) == 0 {
+		t.Rotation = model.Rotation{}
+		return nil
+	}
+	for _, m := range r.Members {
+		if !containsString(t.Members, m) {
+			return fmt.Errorf("rotation member %s is not a team member", m)
+		}
+	}
+	if r.PeriodHours < 1 {
+		return errors.New("rotation period_hours must be at least 1")
+	}
+	if r.Start.IsZero() {
+		r.Start = time.Now().Truncate(time.Hour)
+	}
+	return nil
+}
+
+// teamInfo : t with on call members and host count
+func teamInfo(t model.TeamModel) (TeamInfo, error) {
+	hosts, err := model.CountCertInfoByTeam(t.Name)
+	return TeamInfo{TeamModel: t, OnCall: t.OnCall(time.Now()), Hosts: hosts}, err
+}
+
+// findTeamOrError : find team, writes 404 or 500 if it cannot be returned
+func findTeamOrError(w http.ResponseWriter, name string) (model.TeamModel, bool) {
+	t, exists, err := model.GetTeamByName(name)
+	if err != nil {
+		config.Logger.Error("func model.GetTeamByName err", zap.String("team", name), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return t, false
+	}
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "team %s not found", name)
+		return t, false
+	}
+	return t, true
+}
+
+func writeTeamInfo(w http.ResponseWriter, status int, t model.TeamModel) {
+	info, err := teamInfo(t)
+	if err != nil {
+		config.Logger.Error("func model.CountCertInfoByTeam err", zap.String("team", t.Name), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, status, info)
+}
+
+func (s *Service) apiListTeams(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	teamList, _, err := model.GetTeamList(r.Form.Get("member"))
+	if err != nil {
+		config.Logger.Error("func model.GetTeamList err", zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	infoList := []TeamInfo{}
+	for _, t := range teamList {
+		info, err := teamInfo(t)
+		if err != nil {
+			config.Logger.Error("func model.CountCertInfoByTeam err", zap.String("team", t.Name), zap.Error(err))
+			writeAPIError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		infoList = append(infoList, info)
+	}
+	writeJSON(w, http.StatusOK, infoList)
+}
+
+func (s *Service) apiCreateTeam(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := TeamRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	t := model.TeamModel{Name: req.Name, Members: req.Members, Rotation: req.Rotation}
+	if err := validateTeam(&t); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	config.Logger.Info("new create team request", zap.String("team", t.Name), zap.Strings("members", t.Members))
+	ok, err := model.CreateTeam(t)
+	if err != nil {
+		config.Logger.Error("func model.CreateTeam err", zap.String("team", t.Name), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if !ok {
+		writeAPIError(w, http.StatusConflict, "team %s exists", t.Name)
+		return
+	}
+	if t, ok = findTeamOrError(w, t.Name); ok {
+		writeTeamInfo(w, http.StatusCreated, t)
+	}
+}
+
+func (s *Service) apiGetTeam(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if t, ok := findTeamOrError(w, ps.ByName("team")); ok {
+		writeTeamInfo(w, http.StatusOK, t)
+	}
+}
+
+func (s *Service) apiUpdateTeam(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := TeamRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	t, ok := findTeamOrError(w, ps.ByName("team"))
+	if !ok {
+		return
+	}
+	if req.Name != "" && req.Name != t.Name {
+		writeAPIError(w, http.StatusBadRequest, "team cannot be renamed")
+		return
+	}
+	t.Members, t.Rotation = req.Members, req.Rotation
+	// 修改成员后不再是个人团队
+	t.Personal = t.Personal && len(t.Members) == 1
+	if err := validateTeam(&t); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	config.Logger.Info("new update team request", zap.String("team", t.Name), zap.Strings("members", t.Members))
+	if _, err := model.UpdateTeam(t); err != nil {
+		config.Logger.Error("func model.UpdateTeam err", zap.String("team", t.Name), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if t, ok = findTeamOrError(w, t.Name); ok {
+		writeTeamInfo(w, http.StatusOK, t)
+	}
+}
+
+func (s *Service) apiDeleteTeam(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t, ok := findTeamOrError(w, ps.ByName("team"))
+	if !ok {
+		return
+	}
+	hosts, err := model.CountCertInfoByTeam(t.Name)
+	if err != nil {
+		config.Logger.Error("func model.CountCertInfoByTeam err", zap.String("team", t.Name), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	// 团队下还有 host 时不能删除，避免 host 失去负责人
+	if hosts > 0 {
+		writeAPIError(w, http.StatusConflict, "team %s still owns %d hosts, assign them to another team first", t.Name, hosts)
+		return
+	}
+
+	config.Logger.Info("new delete team request", zap.String("team", t.Name))
+	if _, err := model.DeleteTeam(t.Name); err != nil {
+		config.Logger.Error("func model.DeleteTeam err", zap.String("team", t.Name), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *Service) apiListTeamHosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if t, ok := findTeamOrError(w, ps.ByName("team")); ok {
+		s.apiListCertInfo(w, r, "", t.Name)
+	}
+}
+
+func (s *Service) apiSetHostTeam(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := HostTeamRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	c, ok := findHostOrError(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+	if req.Team != "" {
+		if _, ok := findTeamOrError(w, req.Team); !ok {
+			return
+		}
+	}
+
+	actor := requestActor(r)
+	config.Logger.Info("new set host team request", zap.String("uid", actor), zap.String("host", c.Host), zap.String("team", req.Team))
+	if _, err := model.SetCertInfoTeam(c.Host, req.Team); err != nil {
+		config.Logger.Error("func model.SetCertInfoTeam err", zap.String("host", c.Host), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	recordAudit(actor, model.AuditUpdate, c.Host, &c)
+	if c, ok = findHostOrError(w, c.Host); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+func (s *Service) apiMigrateTeams(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	dryRun := r.Form.Get("dry_run") == "true"
+	config.Logger.Info("new migrate teams request", zap.Bool("dry_run", dryRun))
+	result, err := model.MigratePersonalTeams(dryRun, requestActor(r))
+	if err != nil {
+		config.Logger.Error("func model.MigratePersonalTeams err", zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
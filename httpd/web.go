@@ -0,0 +1,14 @@
+package httpd
+
+import (
+	"net/http"
+
+	"git.ifengidc.com/likuo/go-check-certs/web"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Dashboard : single page dashboard, see package web
+func (s *Service) Dashboard(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	web.Index(w, r)
+}
@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// listLimit : items per page of list requests
+	listLimit = 500
+	// maxResponseSize : upper bound of a single list page
+	maxResponseSize = 64 << 20
+)
+
+// ErrNotFound : resource type is not served by the API server, e.g. Gateway API CRDs are not installed
+var ErrNotFound = errors.New("resource not found")
+
+// Client : minimal read-only kubernetes API client
+type Client struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// NewClient : create client from config
+func NewClient(cfg *Config, timeout time.Duration) *Client {
+	return &Client{
+		server: strings.TrimSuffix(cfg.Server, "/"),
+		token:  cfg.Token,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: cfg.TLSConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}
+}
+
+// objectMeta : the subset of metadata we need
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	OwnerReferences []struct {
+		Kind       string `json:"kind"`
+		Name       string `json:"name"`
+		Controller bool   `json:"controller"`
+	} `json:"ownerReferences"`
+}
+
+type listMeta struct {
+	Continue string `json:"continue"`
+}
+
+// list : get all pages of a list request, handle is called with the items of each page
+func (c *Client) list(ctx context.Context, path string, query url.Values, handle func(items json.RawMessage) error) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("limit", fmt.Sprint(listLimit))
+	for {
+		page := struct {
+			Metadata listMeta        `json:"metadata"`
+			Items    json.RawMessage `json:"items"`
+		}{}
+		if err := c.get(ctx, path+"?"+query.Encode(), &page); err != nil {
+			return err
+		}
+		if len(page.Items) > 0 {
+			if err := handle(page.Items); err != nil {
+				return err
+			}
+		}
+		if page.Metadata.Continue == "" {
+			return nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.server+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("GET %s: %w", path, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// kubernetes 返回 Status 对象，取其中的 message
+		status := struct {
+			Message string `json:"message"`
+		}{}
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(body, &status) == nil && status.Message != "" {
+			return fmt.Errorf("GET %s: %s: %s", path, resp.Status, status.Message)
+		}
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out)
+}
@@ -0,0 +1,198 @@
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// Config : how to reach and authenticate to an API server
+type Config struct {
+	Server    string
+	Token     string
+	TLSConfig *tls.Config
+}
+
+// kubeconfig : the subset of the kubeconfig file format we need
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// LoadKubeconfig : load config of context from kubeconfig file, empty context means current-context
+func LoadKubeconfig(path, context string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kc := kubeconfig{}
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if context == "" {
+		context = kc.CurrentContext
+	}
+	// 相对路径相对于 kubeconfig 所在目录
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == context {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: context %q not found", path, context)
+	}
+
+	cfg := &Config{TLSConfig: &tls.Config{}}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		cfg.Server = c.Cluster.Server
+		cfg.TLSConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		cfg.TLSConfig.ServerName = c.Cluster.TLSServerName
+		caData, err := dataOrFile(c.Cluster.CertificateAuthorityData, resolve(c.Cluster.CertificateAuthority))
+		if err != nil {
+			return nil, fmt.Errorf("%s: cluster %q: %v", path, clusterName, err)
+		}
+		if caData != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caData) {
+				return nil, fmt.Errorf("%s: cluster %q: no certificates in certificate authority", path, clusterName)
+			}
+			cfg.TLSConfig.RootCAs = pool
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: cluster %q not found", path, clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("%s: user %q: exec and auth-provider credentials are not supported", path, userName)
+		}
+		cfg.Token = u.User.Token
+		if u.User.TokenFile != "" {
+			token, err := ioutil.ReadFile(resolve(u.User.TokenFile))
+			if err != nil {
+				return nil, err
+			}
+			cfg.Token = strings.TrimSpace(string(token))
+		}
+		certData, err := dataOrFile(u.User.ClientCertificateData, resolve(u.User.ClientCertificate))
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %q: %v", path, userName, err)
+		}
+		keyData, err := dataOrFile(u.User.ClientKeyData, resolve(u.User.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %q: %v", path, userName, err)
+		}
+		if certData != nil || keyData != nil {
+			pair, err := tls.X509KeyPair(certData, keyData)
+			if err != nil {
+				return nil, fmt.Errorf("%s: user %q: %v", path, userName, err)
+			}
+			cfg.TLSConfig.Certificates = []tls.Certificate{pair}
+		}
+		break
+	}
+
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("%s: cluster %q has no server", path, clusterName)
+	}
+	return cfg, nil
+}
+
+// InClusterConfig : config from the pod service account
+func InClusterConfig() (*Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes cluster, KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT is empty")
+	}
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	caData, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, errors.New("no certificates in service account ca.crt")
+	}
+	return &Config{
+		Server:    "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		TLSConfig: &tls.Config{RootCAs: pool},
+	}, nil
+}
+
+// dataOrFile : base64 inline data takes precedence over file
+func dataOrFile(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
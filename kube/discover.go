@@ -0,0 +1,249 @@
+package kube
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+)
+
+const (
+	// OwnerAnnotation : annotation holding the user to notify, the owner label is used if absent
+	OwnerAnnotation = "go-check-certs/owner"
+	ownerLabel      = "owner"
+
+	KindSecret  = "Secret"
+	KindIngress = "Ingress"
+	KindGateway = "Gateway"
+
+	secretTypeTLS = "kubernetes.io/tls"
+)
+
+// gatewayVersions : Gateway API versions to try, newest first
+var gatewayVersions = []string{"v1", "v1beta1"}
+
+// Meta : where a discovered object lives and who owns it
+type Meta struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Owner : user from the owner annotation or label
+	Owner string
+	// Controller : Kind/Name of the controlling owner reference, e.g. Certificate/www
+	Controller string
+}
+
+// Endpoint : TLS host served by an Ingress or Gateway listener
+type Endpoint struct {
+	Meta
+	Host string
+	Port string
+	// Secret : namespace/name of the TLS secret, empty if not referenced
+	Secret string
+}
+
+// Secret : kubernetes.io/tls secret and the certs parsed from tls.crt
+type Secret struct {
+	Meta
+	Certs []*x509.Certificate
+	Err   error
+}
+
+// Key : namespace/name
+func (s Secret) Key() string {
+	return s.Namespace + "/" + s.Name
+}
+
+// Inventory : result of a discovery run
+type Inventory struct {
+	Secrets   []Secret
+	Endpoints []Endpoint
+}
+
+// Discover : list TLS secrets, Ingress TLS hosts and Gateway TLS listeners of all namespaces
+func (c *Client) Discover(ctx context.Context) (*Inventory, error) {
+	inv := &Inventory{}
+	secrets, err := c.listSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv.Secrets = secrets
+
+	ingresses, err := c.listIngressEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv.Endpoints = append(inv.Endpoints, ingresses...)
+
+	gateways, err := c.listGatewayEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv.Endpoints = append(inv.Endpoints, gateways...)
+	return inv, nil
+}
+
+func (c *Client) listSecrets(ctx context.Context) ([]Secret, error) {
+	secrets := []Secret{}
+	query := url.Values{"fieldSelector": {"type=" + secretTypeTLS}}
+	err := c.list(ctx, "/api/v1/secrets", query, func(items json.RawMessage) error {
+		var page []struct {
+			Metadata objectMeta        `json:"metadata"`
+			Type     string            `json:"type"`
+			Data     map[string]string `json:"data"`
+		}
+		if err := json.Unmarshal(items, &page); err != nil {
+			return err
+		}
+		for _, item := range page {
+			if item.Type != secretTypeTLS {
+				continue
+			}
+			s := Secret{Meta: newMeta(KindSecret, item.Metadata)}
+			s.Certs, s.Err = parseTLSCrt(s.Key()+"/tls.crt", item.Data["tls.crt"])
+			secrets = append(secrets, s)
+		}
+		return nil
+	})
+	return secrets, err
+}
+
+func (c *Client) listIngressEndpoints(ctx context.Context) ([]Endpoint, error) {
+	endpoints := []Endpoint{}
+	err := c.list(ctx, "/apis/networking.k8s.io/v1/ingresses", nil, func(items json.RawMessage) error {
+		var page []struct {
+			Metadata objectMeta `json:"metadata"`
+			Spec     struct {
+				TLS []struct {
+					Hosts      []string `json:"hosts"`
+					SecretName string   `json:"secretName"`
+				} `json:"tls"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(items, &page); err != nil {
+			return err
+		}
+		for _, item := range page {
+			meta := newMeta(KindIngress, item.Metadata)
+			for _, t := range item.Spec.TLS {
+				secret := ""
+				if t.SecretName != "" {
+					secret = meta.Namespace + "/" + t.SecretName
+				}
+				for _, host := range t.Hosts {
+					if !probeable(host) {
+						continue
+					}
+					endpoints = append(endpoints, Endpoint{Meta: meta, Host: host, Port: "443", Secret: secret})
+				}
+			}
+		}
+		return nil
+	})
+	return endpoints, err
+}
+
+func (c *Client) listGatewayEndpoints(ctx context.Context) ([]Endpoint, error) {
+	for _, version := range gatewayVersions {
+		endpoints := []Endpoint{}
+		err := c.list(ctx, "/apis/gateway.networking.k8s.io/"+version+"/gateways", nil, func(items json.RawMessage) error {
+			var page []struct {
+				Metadata objectMeta `json:"metadata"`
+				Spec     struct {
+					Listeners []struct {
+						Hostname string `json:"hostname"`
+						Port     int    `json:"port"`
+						Protocol string `json:"protocol"`
+						TLS      struct {
+							CertificateRefs []struct {
+								Kind      string `json:"kind"`
+								Name      string `json:"name"`
+								Namespace string `json:"namespace"`
+							} `json:"certificateRefs"`
+						} `json:"tls"`
+					} `json:"listeners"`
+				} `json:"spec"`
+			}
+			if err := json.Unmarshal(items, &page); err != nil {
+				return err
+			}
+			for _, item := range page {
+				meta := newMeta(KindGateway, item.Metadata)
+				for _, l := range item.Spec.Listeners {
+					if (l.Protocol != "HTTPS" && l.Protocol != "TLS") || !probeable(l.Hostname) {
+						continue
+					}
+					secret := ""
+					for _, ref := range l.TLS.CertificateRefs {
+						if ref.Kind != "" && ref.Kind != KindSecret {
+							continue
+						}
+						namespace := ref.Namespace
+						if namespace == "" {
+							namespace = meta.Namespace
+						}
+						secret = namespace + "/" + ref.Name
+						break
+					}
+					endpoints = append(endpoints, Endpoint{Meta: meta, Host: l.Hostname, Port: fmt.Sprint(l.Port), Secret: secret})
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return endpoints, err
+	}
+	// 未安装 Gateway API
+	return []Endpoint{}, nil
+}
+
+func newMeta(kind string, m objectMeta) Meta {
+	meta := Meta{
+		Kind:      kind,
+		Namespace: m.Namespace,
+		Name:      m.Name,
+		Owner:     m.Annotations[OwnerAnnotation],
+	}
+	if meta.Owner == "" {
+		meta.Owner = m.Labels[ownerLabel]
+	}
+	for _, ref := range m.OwnerReferences {
+		if ref.Controller {
+			meta.Controller = ref.Kind + "/" + ref.Name
+			break
+		}
+	}
+	return meta
+}
+
+// probeable : wildcard and empty hosts cannot be probed
+func probeable(host string) bool {
+	return host != "" && !strings.HasPrefix(host, "*")
+}
+
+// parseTLSCrt : parse base64 encoded PEM chain of a TLS secret
+func parseTLSCrt(name, data string) ([]*x509.Certificate, error) {
+	if data == "" {
+		return nil, errors.New("tls.crt is empty")
+	}
+	pemData, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := certcheck.Parse(name, pemData, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Certs) == 0 {
+		return nil, fmt.Errorf("%s: no certificate found", name)
+	}
+	return b.Certs, nil
+}
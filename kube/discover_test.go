@@ -0,0 +1,143 @@
+package kube
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+// testTLSCrt : base64 encoded PEM cert for cn, as in the tls.crt of a TLS secret
+func testTLSCrt(t *testing.T, cn string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// fakeAPIServer : serves the given paths, other paths are 404 like resources that are not installed
+func fakeAPIServer(t *testing.T, pages map[string]string) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, `{"kind":"Status","message":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		key := r.URL.Path
+		if c := r.URL.Query().Get("continue"); c != "" {
+			key += "?continue=" + c
+		}
+		body, ok := pages[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(&Config{Server: server.URL, Token: testToken}, 5*time.Second)
+}
+
+func TestDiscover(t *testing.T) {
+	client := fakeAPIServer(t, map[string]string{
+		// secret 分两页返回
+		"/api/v1/secrets": `{"metadata":{"continue":"page2"},"items":[
+			{"metadata":{"name":"www-tls","namespace":"web","annotations":{"go-check-certs/owner":"alice"},"labels":{"owner":"bob"},
+				"ownerReferences":[{"kind":"Certificate","name":"www","controller":true}]},
+			 "type":"kubernetes.io/tls","data":{"tls.crt":"` + testTLSCrt(t, "www.example.com") + `"}}]}`,
+		"/api/v1/secrets?continue=page2": `{"metadata":{},"items":[
+			{"metadata":{"name":"broken","namespace":"web","labels":{"owner":"bob"}},"type":"kubernetes.io/tls","data":{"tls.crt":""}},
+			{"metadata":{"name":"token","namespace":"web"},"type":"Opaque","data":{}}]}`,
+		"/apis/networking.k8s.io/v1/ingresses": `{"metadata":{},"items":[
+			{"metadata":{"name":"www","namespace":"web","labels":{"owner":"bob"}},
+			 "spec":{"tls":[{"hosts":["www.example.com","*.example.com"],"secretName":"www-tls"},{"hosts":["api.example.com"]}]}}]}`,
+		// 只安装了 v1beta1 的 Gateway API
+		"/apis/gateway.networking.k8s.io/v1beta1/gateways": `{"metadata":{},"items":[
+			{"metadata":{"name":"edge","namespace":"infra","ownerReferences":[{"kind":"Helm","name":"edge","controller":false}]},
+			 "spec":{"listeners":[
+				{"hostname":"edge.example.com","port":8443,"protocol":"HTTPS","tls":{"certificateRefs":[{"kind":"Secret","name":"edge-tls","namespace":"certs"}]}},
+				{"hostname":"plain.example.com","port":80,"protocol":"HTTP"},
+				{"hostname":"tls.example.com","port":443,"protocol":"TLS","tls":{"certificateRefs":[{"name":"tls-cert"}]}},
+				{"port":443,"protocol":"HTTPS"}]}}]}`,
+	})
+
+	inv, err := client.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inv.Secrets) != 2 {
+		t.Fatalf("secrets = %+v, want the two TLS secrets", inv.Secrets)
+	}
+	www, broken := inv.Secrets[0], inv.Secrets[1]
+	wantMeta := Meta{Kind: KindSecret, Namespace: "web", Name: "www-tls", Owner: "alice", Controller: "Certificate/www"}
+	if www.Meta != wantMeta || www.Key() != "web/www-tls" {
+		t.Errorf("secret meta = %+v, want %+v", www.Meta, wantMeta)
+	}
+	if www.Err != nil || len(www.Certs) != 1 || www.Certs[0].Subject.CommonName != "www.example.com" {
+		t.Errorf("secret certs = %v, err %v, want www.example.com", www.Certs, www.Err)
+	}
+	// owner 注解不存在时使用 owner 标签
+	if broken.Owner != "bob" || broken.Err == nil {
+		t.Errorf("broken secret: owner %q, err %v, want bob and an error", broken.Owner, broken.Err)
+	}
+
+	ingress := Meta{Kind: KindIngress, Namespace: "web", Name: "www", Owner: "bob"}
+	gateway := Meta{Kind: KindGateway, Namespace: "infra", Name: "edge"}
+	want := []Endpoint{
+		{Meta: ingress, Host: "www.example.com", Port: "443", Secret: "web/www-tls"},
+		{Meta: ingress, Host: "api.example.com", Port: "443"},
+		{Meta: gateway, Host: "edge.example.com", Port: "8443", Secret: "certs/edge-tls"},
+		{Meta: gateway, Host: "tls.example.com", Port: "443", Secret: "infra/tls-cert"},
+	}
+	if !reflect.DeepEqual(inv.Endpoints, want) {
+		t.Errorf("endpoints =\n%+v\nwant\n%+v", inv.Endpoints, want)
+	}
+}
+
+func TestDiscoverWithoutGatewayAPI(t *testing.T) {
+	client := fakeAPIServer(t, map[string]string{
+		"/api/v1/secrets":                      `{"metadata":{},"items":[]}`,
+		"/apis/networking.k8s.io/v1/ingresses": `{"metadata":{},"items":[]}`,
+	})
+	inv, err := client.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("missing gateway api must not fail discovery: %v", err)
+	}
+	if len(inv.Secrets) != 0 || len(inv.Endpoints) != 0 {
+		t.Errorf("inventory = %+v, want empty", inv)
+	}
+}
+
+func TestDiscoverError(t *testing.T) {
+	client := fakeAPIServer(t, map[string]string{})
+	client.token = "wrong"
+	if _, err := client.Discover(context.Background()); err == nil || err.Error() != "GET /api/v1/secrets?fieldSelector=type%3Dkubernetes.io%2Ftls&limit=500: 401 Unauthorized: Unauthorized" {
+		t.Errorf("err = %v, want the message of the Status object", err)
+	}
+}
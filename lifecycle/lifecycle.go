@@ -0,0 +1,88 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Group : background goroutines waited for on shutdown
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// Go : run f in the background
+func (g *Group) Go(f func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f()
+	}()
+}
+
+// Every : run job now and then every interval until ctx is canceled
+func (g *Group) Every(ctx context.Context, interval time.Duration, job func()) {
+	g.Go(func() {
+		for {
+			job()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	})
+}
+
+// Wait : wait for the goroutines of g, or until ctx is done
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain : background goroutines given a context that is only canceled when draining them times out,
+// e.g. outgoing messages that should still be sent on shutdown
+type Drain struct {
+	group  Group
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewDrain() *Drain {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Drain{ctx: ctx, cancel: cancel}
+}
+
+// Go : run f in the background
+func (d *Drain) Go(f func(ctx context.Context)) {
+	d.group.Go(func() { f(d.ctx) })
+}
+
+// Shutdown : wait for the goroutines of d until ctx is done, then cancel the ones still running
+func (d *Drain) Shutdown(ctx context.Context) error {
+	err := d.group.Wait(ctx)
+	d.cancel()
+	return err
+}
+
+// WaitSignal : call reload for each SIGHUP received on signals, return the first other signal
+func WaitSignal(signals <-chan os.Signal, reload func(sig os.Signal)) os.Signal {
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			return sig
+		}
+		reload(sig)
+	}
+	return nil
+}
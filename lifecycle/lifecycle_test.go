@@ -0,0 +1,129 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGroupWait(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	g.Go(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait() of a running goroutine = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	if err := g.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() = %v", err)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	var g Group
+	var runs int32
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Every(ctx, time.Millisecond, func() { atomic.AddInt32(&runs, 1) })
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runs) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&runs); n < 3 {
+		t.Errorf("job ran %d times, want at least 3", n)
+	}
+
+	cancel()
+	wait, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+	if err := g.Wait(wait); err != nil {
+		t.Fatalf("Wait() after cancel = %v", err)
+	}
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(5 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != n {
+		t.Error("job ran after the loop stopped")
+	}
+
+	// the first run is immediate, not after interval
+	var first int32
+	g.Every(ctx, time.Hour, func() { atomic.AddInt32(&first, 1) })
+	if err := g.Wait(wait); err != nil || atomic.LoadInt32(&first) != 1 {
+		t.Errorf("Every() on a canceled context ran %d times, err = %v, want 1", first, err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	d := NewDrain()
+	sent := make(chan struct{})
+	d.Go(func(ctx context.Context) {
+		// pending messages are still sent after the cron jobs stopped
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Millisecond):
+			close(sent)
+		}
+	})
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	select {
+	case <-sent:
+	default:
+		t.Error("pending message was canceled, want it sent")
+	}
+
+	d = NewDrain()
+	canceled := make(chan struct{})
+	d.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(canceled)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() of a stuck message = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("stuck message not canceled when draining timed out")
+	}
+}
+
+func TestWaitSignal(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		signals []os.Signal
+		want    os.Signal
+		reloads int
+	}{
+		{name: "term", signals: []os.Signal{syscall.SIGTERM}, want: syscall.SIGTERM},
+		{name: "reload then interrupt", signals: []os.Signal{syscall.SIGHUP, syscall.SIGHUP, os.Interrupt, syscall.SIGHUP}, want: os.Interrupt, reloads: 2},
+		{name: "closed", signals: []os.Signal{syscall.SIGHUP}, reloads: 1},
+	} {
+		signals := make(chan os.Signal, len(tt.signals))
+		for _, sig := range tt.signals {
+			signals <- sig
+		}
+		if tt.want == nil {
+			close(signals)
+		}
+		reloads := []os.Signal{}
+		got := WaitSignal(signals, func(sig os.Signal) { reloads = append(reloads, sig) })
+		if got != tt.want || len(reloads) != tt.reloads {
+			t.Errorf("%s: WaitSignal() = %v after %d reloads, want %v after %d", tt.name, got, len(reloads), tt.want, tt.reloads)
+		}
+		for _, sig := range reloads {
+			if !reflect.DeepEqual(sig, syscall.SIGHUP) {
+				t.Errorf("%s: reload on %v", tt.name, sig)
+			}
+		}
+	}
+}
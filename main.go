@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"git.ifengidc.com/likuo/go-check-certs/config"
 	"git.ifengidc.com/likuo/go-check-certs/httpd"
+	"git.ifengidc.com/likuo/go-check-certs/lifecycle"
 	"git.ifengidc.com/likuo/go-check-certs/third/message"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
+
+	"go.uber.org/zap"
 )
 
+// shutdownTimeout : time for requests, probes and notifications in flight to finish on shutdown
+const shutdownTimeout = 20 * time.Second
+
 /*
 基础功能:
 1. 证书校验
@@ -45,7 +54,7 @@ func init() {
 }
 
 func main() {
-	service, err := httpd.New(":8888")
+	service, err := httpd.New(config.Listen)
 	if err != nil {
 		panic(err)
 	}
@@ -53,12 +62,31 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer service.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
 	go message.Init()
-	go httpd.Init()
+	httpd.Init(ctx)
+
+	// SIGHUP 重新加载配置，SIGINT/SIGTERM 退出
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	sig := lifecycle.WaitSignal(signals, func(sig os.Signal) {
+		config.Logger.Info("reloading configuration", zap.String("signal", sig.String()))
+		httpd.Reload()
+	})
+	// 再次收到信号时直接退出
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	config.Logger.Info("shutting down", zap.String("signal", sig.String()), zap.Duration("timeout", shutdownTimeout))
 
-	terminate := make(chan os.Signal, 1)
-	signal.Notify(terminate, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGHUP)
-	<-terminate
+	cancel()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := service.Shutdown(shutdownCtx); err != nil {
+		config.Logger.Error("http service shutdown err", zap.Error(err))
+	}
+	if err := httpd.Shutdown(shutdownCtx); err != nil {
+		config.Logger.Error("cron shutdown err", zap.Error(err))
+	}
+	config.Logger.Info("shut down")
+	_ = config.Logger.Sync()
 }
@@ -0,0 +1,146 @@
+// Package metrics exports the last probe result of each host, see httpd.certMetrics.
+// It does not use the database, so the collector can be tested without mongo.
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/config/configfile"
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	CertExpirySecondsDesc = prometheus.NewDesc(
+		"cert_expiry_seconds",
+		"Seconds until the cert expires.",
+		[]string{"host", "port", "cn", "serial", "is_ca"}, nil)
+	CertProbeSuccessDesc = prometheus.NewDesc(
+		"cert_probe_success",
+		"Whether the last probe of the host succeeded.",
+		[]string{"host", "port"}, nil)
+	CertProbeDurationDesc = prometheus.NewDesc(
+		"cert_probe_duration_seconds",
+		"Duration of the last probe of the host.",
+		[]string{"host", "port"}, nil)
+)
+
+// Snapshot : last probe result of host for metrics
+type Snapshot struct {
+	Port    string
+	Success bool
+	// Duration : zero if the snapshot was loaded from the database, which does not store it
+	Duration time.Duration
+	Certs    []probe.CertInfo
+	Time     time.Time
+	// Criticality, Team, Labels : of the host record, for cert_host_info
+	Criticality schema.Criticality
+	Team        string
+	Labels      map[string]string
+}
+
+// CertCollector : export last probe results, cert expiry is computed at scrape time
+type CertCollector struct {
+	sync.RWMutex
+	hosts        map[string]Snapshot
+	labelKeys    []string
+	hostInfoDesc *prometheus.Desc
+}
+
+// NewCertCollector : collector exporting the host labels of labelKeys on cert_host_info
+func NewCertCollector(labelKeys []string) *CertCollector {
+	labelNames := []string{"host", "criticality", "team"}
+	for _, key := range labelKeys {
+		labelNames = append(labelNames, configfile.MetricLabelName(key))
+	}
+	return &CertCollector{
+		hosts:     map[string]Snapshot{},
+		labelKeys: labelKeys,
+		hostInfoDesc: prometheus.NewDesc(
+			"cert_host_info",
+			"Criticality, team and labels of the host, labels are the keys of METRICLABELS.",
+			labelNames, nil),
+	}
+}
+
+// Set : replace the snapshot of host after a probe
+func (c *CertCollector) Set(host string, snapshot Snapshot) {
+	c.Lock()
+	c.hosts[host] = snapshot
+	c.Unlock()
+}
+
+// Load : replace the snapshots by the last probe results stored in the database, snapshots of
+// probes not stored yet are kept but take the host info of stored. Hosts not in stored were
+// removed and are dropped.
+func (c *CertCollector) Load(stored map[string]Snapshot) {
+	hosts := make(map[string]Snapshot, len(stored))
+	c.Lock()
+	defer c.Unlock()
+	for host, s := range stored {
+		snapshot, ok := c.hosts[host]
+		// mongo 存储的时间精确到毫秒
+		if !ok || s.Time.After(snapshot.Time.Truncate(time.Millisecond)) {
+			snapshot = s
+		}
+		snapshot.Criticality, snapshot.Team, snapshot.Labels = s.Criticality, s.Team, s.Labels
+		hosts[host] = snapshot
+	}
+	c.hosts = hosts
+}
+
+// Reset : drop all snapshots, when this replica is no longer the leader
+func (c *CertCollector) Reset() {
+	c.Lock()
+	c.hosts = map[string]Snapshot{}
+	c.Unlock()
+}
+
+// Get : get last snapshot of host
+func (c *CertCollector) Get(host string) (Snapshot, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	snapshot, ok := c.hosts[host]
+	return snapshot, ok
+}
+
+func (c *CertCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- CertExpirySecondsDesc
+	ch <- CertProbeSuccessDesc
+	ch <- CertProbeDurationDesc
+	ch <- c.hostInfoDesc
+}
+
+func (c *CertCollector) Collect(ch chan<- prometheus.Metric) {
+	c.RLock()
+	defer c.RUnlock()
+	for host, snapshot := range c.hosts {
+		CollectSnapshot(ch, host, snapshot)
+		labelValues := []string{host, string(snapshot.Criticality), snapshot.Team}
+		for _, key := range c.labelKeys {
+			labelValues = append(labelValues, snapshot.Labels[key])
+		}
+		ch <- prometheus.MustNewConstMetric(c.hostInfoDesc, prometheus.GaugeValue, 1, labelValues...)
+	}
+}
+
+// CollectSnapshot : export the probe metrics of snapshot, without cert_host_info
+func CollectSnapshot(ch chan<- prometheus.Metric, host string, snapshot Snapshot) {
+	success := 0.0
+	if snapshot.Success {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(CertProbeSuccessDesc, prometheus.GaugeValue, success, host, snapshot.Port)
+	if snapshot.Duration > 0 {
+		ch <- prometheus.MustNewConstMetric(CertProbeDurationDesc, prometheus.GaugeValue, snapshot.Duration.Seconds(), host, snapshot.Port)
+	}
+	for _, cert := range snapshot.Certs {
+		ch <- prometheus.MustNewConstMetric(CertExpirySecondsDesc, prometheus.GaugeValue,
+			time.Until(cert.NotAfter).Seconds(),
+			host, snapshot.Port, cert.CommonName, cert.SerialNumber, strconv.FormatBool(cert.IsCA))
+	}
+}
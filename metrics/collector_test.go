@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gather : scrape c, values by metric name and labels, e.g. cert_probe_success{host=a,port=443}
+func gather(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() err = %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := []string{}
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			values[family.GetName()+"{"+strings.Join(labels, ",")+"}"] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func keys(values map[string]float64) []string {
+	list := []string{}
+	for k := range values {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestCollect(t *testing.T) {
+	c := NewCertCollector([]string{"env", "cost-center"})
+	c.Set("www.example.com", Snapshot{
+		Port:     "443",
+		Success:  true,
+		Duration: 1500 * time.Millisecond,
+		Certs: []probe.CertInfo{
+			{CommonName: "www.example.com", SerialNumber: "0A", NotAfter: time.Now().Add(48 * time.Hour)},
+			{CommonName: "Example CA", SerialNumber: "01", IsCA: true, NotAfter: time.Now().Add(-time.Hour)},
+		},
+		Criticality: schema.CriticalityHigh,
+		Team:        "sre",
+		Labels:      map[string]string{"env": "prod", "owner": "likuo"},
+	})
+	// loaded from the database, without a duration
+	c.Set("down.example.com", Snapshot{Port: "8443"})
+
+	got := gather(t, c)
+	want := map[string]float64{
+		"cert_probe_success{host=www.example.com,port=443}":                                                1,
+		"cert_probe_duration_seconds{host=www.example.com,port=443}":                                       1.5,
+		"cert_host_info{criticality=high,host=www.example.com,label_cost_center=,label_env=prod,team=sre}": 1,
+		"cert_probe_success{host=down.example.com,port=8443}":                                              0,
+		"cert_host_info{criticality=,host=down.example.com,label_cost_center=,label_env=,team=}":           1,
+		"cert_expiry_seconds{cn=www.example.com,host=www.example.com,is_ca=false,port=443,serial=0A}":      48 * 3600,
+		"cert_expiry_seconds{cn=Example CA,host=www.example.com,is_ca=true,port=443,serial=01}":            -3600,
+	}
+	if strings.Join(keys(got), "\n") != strings.Join(keys(want), "\n") {
+		t.Fatalf("metrics =\n%s\nwant\n%s", strings.Join(keys(got), "\n"), strings.Join(keys(want), "\n"))
+	}
+	for k, v := range want {
+		// expiry is computed at scrape time
+		if math.Abs(got[k]-v) > 60 {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	probed := time.Date(2026, 3, 1, 10, 0, 0, 123456789, time.UTC)
+	stored := func(at time.Time, success bool, team string) Snapshot {
+		return Snapshot{Port: "443", Success: success, Time: at, Team: team}
+	}
+	for _, tt := range []struct {
+		name   string
+		live   *Snapshot
+		stored Snapshot
+		want   Snapshot
+	}{
+		{
+			name:   "not probed here",
+			stored: stored(probed, false, "sre"),
+			want:   stored(probed, false, "sre"),
+		},
+		{
+			name:   "probed here and stored",
+			live:   &Snapshot{Port: "443", Success: true, Duration: time.Second, Time: probed, Team: "old"},
+			stored: stored(probed.Truncate(time.Millisecond), true, "sre"),
+			want:   Snapshot{Port: "443", Success: true, Duration: time.Second, Time: probed, Team: "sre"},
+		},
+		{
+			name:   "probed here not stored yet",
+			live:   &Snapshot{Port: "443", Success: true, Duration: time.Second, Time: probed, Team: "old"},
+			stored: stored(probed.Add(-time.Hour), false, "sre"),
+			want:   Snapshot{Port: "443", Success: true, Duration: time.Second, Time: probed, Team: "sre"},
+		},
+		{
+			name:   "probed later elsewhere",
+			live:   &Snapshot{Port: "443", Success: true, Duration: time.Second, Time: probed, Team: "old"},
+			stored: stored(probed.Add(time.Minute), false, "sre"),
+			want:   stored(probed.Add(time.Minute), false, "sre"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCertCollector(nil)
+			if tt.live != nil {
+				c.Set("www.example.com", *tt.live)
+			}
+			c.Set("removed.example.com", Snapshot{Port: "443", Success: true})
+			c.Load(map[string]Snapshot{"www.example.com": tt.stored})
+
+			got, ok := c.Get("www.example.com")
+			if !ok {
+				t.Fatal("Get(www.example.com) not found after Load")
+			}
+			if got.Port != tt.want.Port || got.Success != tt.want.Success || got.Duration != tt.want.Duration || !got.Time.Equal(tt.want.Time) || got.Team != tt.want.Team {
+				t.Errorf("Get(www.example.com) = %+v, want %+v", got, tt.want)
+			}
+			if _, ok := c.Get("removed.example.com"); ok {
+				t.Error("Load kept removed.example.com, which is not stored")
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := NewCertCollector(nil)
+	c.Set("www.example.com", Snapshot{Port: "443", Success: true})
+	c.Reset()
+	if got := gather(t, c); len(got) != 0 {
+		t.Errorf("metrics after Reset = %v, want none", keys(got))
+	}
+	c.Set("www.example.com", Snapshot{Port: "443", Success: true})
+	if _, ok := c.Get("www.example.com"); !ok {
+		t.Error("Set after Reset not exported")
+	}
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+var (
+	auditC = config.MongoSession.DB(config.MongoDatabase).C("audit")
+)
+
+// audit log documents, see schema.AuditModel
+type (
+	AuditModel  = schema.AuditModel
+	AuditAction = schema.AuditAction
+	AuditState  = schema.AuditState
+	AuditQuery  = schema.AuditQuery
+)
+
+const (
+	AuditCreate      = schema.AuditCreate
+	AuditUpdate      = schema.AuditUpdate
+	AuditDelete      = schema.AuditDelete
+	AuditRestore     = schema.AuditRestore
+	AuditSubscribe   = schema.AuditSubscribe
+	AuditUnsubscribe = schema.AuditUnsubscribe
+)
+
+var (
+	// NewAudit : see schema.NewAudit
+	NewAudit = schema.NewAudit
+	// AuditCreateAction : see schema.CreateAction
+	AuditCreateAction = schema.CreateAction
+)
+
+func init() {
+	auditCIndex := []mgo.Index{
+		{
+			Key:        []string{"host", "-time"},
+			Background: true,
+		},
+		{
+			Key:        []string{"actor", "-time"},
+			Background: true,
+		},
+		{
+			Key:        []string{"-time"},
+			Background: true,
+		},
+	}
+
+	for _, v := range auditCIndex {
+		err := auditC.EnsureIndex(v)
+		if err != nil {
+			config.Logger.Error("EnsureIndex error", zap.Error(err))
+		}
+	}
+}
+
+func InsertAudit(a AuditModel) (bool, error) {
+	a.ID = bson.NewObjectId()
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	err := auditC.Insert(a)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetAuditList : audit entries matching query, newest first, and the total count before paging
+func GetAuditList(q AuditQuery) ([]AuditModel, int, error) {
+	auditList := []AuditModel{}
+	query := auditC.Find(q.Selector())
+	total, err := query.Count()
+	if err != nil {
+		return auditList, 0, err
+	}
+	query = query.Sort("-time", "-_id")
+	if q.Limit > 0 {
+		if q.Limit > MaxQueryLimit {
+			q.Limit = MaxQueryLimit
+		}
+		if q.Page > 1 {
+			query = query.Skip((q.Page - 1) * q.Limit)
+		}
+		query = query.Limit(q.Limit)
+	}
+	err = query.All(&auditList)
+	return auditList, total, err
+}
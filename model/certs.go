@@ -1,7 +1,10 @@
 package model
 
 import (
+	"fmt"
 	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
 	"go.uber.org/zap"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -9,35 +12,68 @@ import (
 	"time"
 )
 
-type Status int
+var (
+	certC = config.MongoSession.DB(config.MongoDatabase).C("cert")
+)
+
+// documents, defined in package schema so that their rules are tested without the database
+type (
+	Status      = schema.Status
+	CertModel   = schema.CertModel
+	ArchiveInfo = schema.ArchiveInfo
+	Mute        = schema.Mute
+	Criticality = schema.Criticality
+	Source      = schema.Source
+)
 
 const (
-	Online  Status = 0
-	Offline Status = 1
+	Online  = schema.Online
+	Offline = schema.Offline
+
+	CriticalityLow      = schema.CriticalityLow
+	CriticalityMedium   = schema.CriticalityMedium
+	CriticalityHigh     = schema.CriticalityHigh
+	CriticalityCritical = schema.CriticalityCritical
+
+	SourceUser             = schema.SourceUser
+	SourceKubernetes       = schema.SourceKubernetes
+	SourceKubernetesSecret = schema.SourceKubernetesSecret
 )
 
 var (
-	certC = config.MongoSession.DB(config.MongoDatabase).C("cert")
+	// Criticalities : from least to most critical
+	Criticalities = schema.Criticalities
+	// ValidCriticality : see schema.ValidCriticality
+	ValidCriticality = schema.ValidCriticality
+	// NextCheckDelay : see schema.NextCheckDelay
+	NextCheckDelay = schema.NextCheckDelay
+	// SplitLabels, ValidateLabel, GroupField : see schema.SplitLabels
+	SplitLabels   = schema.SplitLabels
+	ValidateLabel = schema.ValidateLabel
+	GroupField    = schema.GroupField
 )
 
-type CertModel struct {
-	ID         bson.ObjectId `bson:"_id" json:"id"`
-	User       []string      `bson:"user" json:"user"`
-	Status     Status        `bson:"status" json:"status"`
-	Host       string        `bson:"host" json:"host"`
-	Port       string        `bson:"port" json:"port"`
-	AddTime    time.Time     `bson:"add_time" json:"add_time"`
-	UpdateTime time.Time     `bson:"update_time" json:"update_time"`
-	Cert       []CertInfo    `bson:"cert" json:"cert"`
-}
+// probe results, defined in package probe so that probe agents build without the database
+type (
+	CertInfo         = probe.CertInfo
+	ChainIssueType   = probe.ChainIssueType
+	ChainIssue       = probe.ChainIssue
+	StapleInfo       = probe.StapleInfo
+	RevocationStatus = probe.RevocationStatus
+	RevocationInfo   = probe.RevocationInfo
+)
 
-type CertInfo struct {
-	CommonName  string    `bson:"common_name" json:"common_name"`
-	ExpireHours int64     `bson:"expire_hours" json:"expire_hours"`
-	IsCA        bool      `bson:"is_ca" json:"is_ca"`
-	NotBefore   time.Time `bson:"not_before" json:"not_before"`
-	NotAfter    time.Time `bson:"not_after" json:"not_after"`
-}
+const (
+	ChainMissingIntermediate = probe.ChainMissingIntermediate
+	ChainExtraCert           = probe.ChainExtraCert
+	ChainWrongOrder          = probe.ChainWrongOrder
+	ChainServedRoot          = probe.ChainServedRoot
+
+	RevocationUnchecked = probe.RevocationUnchecked
+	RevocationGood      = probe.RevocationGood
+	RevocationRevoked   = probe.RevocationRevoked
+	RevocationUnknown   = probe.RevocationUnknown
+)
 
 func init() {
 	certCIndex := []mgo.Index{
@@ -52,6 +88,43 @@ func init() {
 			Background: true,
 			Sparse:     true,
 		},
+		// 列表按过期时间筛选排序
+		{
+			Key:        []string{"status", "expire_at"},
+			Background: true,
+		},
+		{
+			Key:        []string{"user", "status", "expire_at"},
+			Background: true,
+		},
+		{
+			Key:        []string{"probe_error"},
+			Background: true,
+			Sparse:     true,
+		},
+		{
+			Key:        []string{"cert.issuer"},
+			Background: true,
+		},
+		{
+			Key:        []string{"team"},
+			Background: true,
+			Sparse:     true,
+		},
+		{
+			Key:        []string{"criticality"},
+			Background: true,
+			Sparse:     true,
+		},
+		{
+			Key:        []string{"vantages"},
+			Background: true,
+			Sparse:     true,
+		},
+		{
+			Key:        []string{"status", "next_check"},
+			Background: true,
+		},
 	}
 
 	for _, v := range certCIndex {
@@ -71,7 +144,11 @@ func CreateCertInfo(c CertModel) (bool, error) {
 	// Insert new cert if host not exists
 	if !exists {
 		ok, err := InsertCertInfo(c)
-		return ok, err
+		if err != nil || ok {
+			return ok, err
+		}
+		// host 已归档时重新启用，不恢复原来的订阅用户
+		return reviveCertInfo(c)
 	}
 
 	// 判断user是否已经在userlist中
@@ -92,6 +169,7 @@ func InsertCertInfo(c CertModel) (bool, error) {
 	c.AddTime = time.Now()
 	c.UpdateTime = time.Now()
 	c.Status = Online
+	c.ExpireAt = schema.SoonestExpiry(c.Cert)
 
 	err := certC.Insert(c)
 	if err != nil {
@@ -104,6 +182,26 @@ func InsertCertInfo(c CertModel) (bool, error) {
 
 }
 
+// reviveCertInfo : bring archived host back online for the users of c
+func reviveCertInfo(c CertModel) (bool, error) {
+	err := certC.Update(bson.M{"host": c.Host, "status": Offline}, bson.M{
+		"$set": bson.M{
+			"user":        RemoveDuplicateElement(c.User),
+			"port":        c.Port,
+			"status":      Online,
+			"update_time": time.Now(),
+		},
+		"$unset": bson.M{"archive": ""},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func UpdateCertInfo(c CertModel) (bool, error) {
 	// user 去重
 	c.User = RemoveDuplicateElement(c.User)
@@ -116,6 +214,9 @@ func UpdateCertInfo(c CertModel) (bool, error) {
 			"port":        c.Port,
 			"update_time": time.Now(),
 			"cert":        c.Cert,
+			"expire_at":   schema.SoonestExpiry(c.Cert),
+			"staple":      c.Staple,
+			"chain":       c.Chain,
 		},
 	})
 	if err != nil {
@@ -127,15 +228,133 @@ func UpdateCertInfo(c CertModel) (bool, error) {
 	return true, nil
 }
 
-func DeleteCertInfo(c CertModel) (bool, error) {
-	//err := certC.Update(bson.M{"_id": c.ID, "status": Online}, bson.M{
-	//	"$set": bson.M{
-	//		"status": Offline,
-	//	},
-	//})
+// SyncCertInfo : insert discovered host or update its labels and users, certs are only
+// replaced for hosts that are not probed live. Returns true if host was inserted.
+func SyncCertInfo(c CertModel) (bool, error) {
+	cc, exists, err := GetCertInfoByHost(c.Host)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		if c.User == nil {
+			c.User = []string{}
+		}
+		return InsertCertInfo(c)
+	}
 
-	err := certC.RemoveId(c.ID)
+	update := bson.M{"$set": c.SyncFields(cc, time.Now())}
+	if len(c.User) > 0 {
+		update["$addToSet"] = bson.M{"user": bson.M{"$each": c.User}}
+	}
+	err = certC.Update(bson.M{"_id": cc.ID}, update)
+	if err != nil {
+		return false, err
+	}
+	return false, nil
+}
 
+// UpdateProbeError : record result of the last probe of host finished at probeTime, empty probeErr clears the error
+func UpdateProbeError(host, probeErr string, probeTime time.Time) (bool, error) {
+	err := certC.Update(bson.M{"host": host, "status": Online}, bson.M{
+		"$set": bson.M{
+			"probe_error": probeErr,
+			"probe_time":  probeTime,
+		},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateCertInfoLabels : set and remove labels of host, and set its criticality if it is not nil
+func UpdateCertInfoLabels(host string, set map[string]string, unset []string, criticality *Criticality) (bool, error) {
+	setFields := bson.M{"update_time": time.Now()}
+	for k, v := range set {
+		setFields["labels."+k] = v
+	}
+	update := bson.M{"$set": setFields}
+	unsetFields := bson.M{}
+	for _, k := range unset {
+		unsetFields["labels."+k] = ""
+	}
+	if criticality != nil {
+		if *criticality == "" {
+			unsetFields["criticality"] = ""
+		} else {
+			setFields["criticality"] = *criticality
+		}
+	}
+	if len(unsetFields) > 0 {
+		update["$unset"] = unsetFields
+	}
+
+	err := certC.Update(bson.M{"host": host, "status": Online}, update)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// MuteCertInfo : set mute of user on host, replacing the previous one
+func MuteCertInfo(host, user string, m Mute) (bool, error) {
+	// uid 作为字段名，不能包含 . 和 $
+	if user == "" || strings.ContainsAny(user, ".$") {
+		return false, fmt.Errorf("invalid user %q", user)
+	}
+	err := certC.Update(bson.M{"host": host, "user": user, "status": Online}, bson.M{
+		"$set": bson.M{
+			"mutes." + user: m,
+		},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteCertInfo : archive host, it is kept Offline with the reason and who deleted it
+func DeleteCertInfo(c CertModel, by, reason string) (bool, error) {
+	err := certC.Update(bson.M{"_id": c.ID, "status": Online}, bson.M{
+		"$set": bson.M{
+			"status":      Offline,
+			"update_time": time.Now(),
+			"archive":     ArchiveInfo{Reason: reason, By: by, Time: time.Now()},
+		},
+	})
+
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UnsubscribeCertInfo : remove user from host, the host is deleted with its last user unless a team owns it
+func UnsubscribeCertInfo(c CertModel, user string) (bool, error) {
+	if len(c.User) == 1 && c.User[0] == user && c.Team == "" {
+		return DeleteCertInfo(c, user, "last user unsubscribed")
+	}
+	return DeleteUserFromCertInfo(c, user)
+}
+
+// RestoreCertInfo : bring archived host back online with the users it had
+func RestoreCertInfo(c CertModel) (bool, error) {
+	err := certC.Update(bson.M{"_id": c.ID, "status": Offline}, bson.M{
+		"$set":   bson.M{"status": Online, "update_time": time.Now()},
+		"$unset": bson.M{"archive": ""},
+	})
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return false, nil
@@ -179,6 +398,49 @@ func GetCertInfoByHost(host string) (CertModel, bool, error) {
 	return c, true, nil
 }
 
+// GetCertInfoByID : get online cert info by id
+func GetCertInfoByID(id bson.ObjectId) (CertModel, bool, error) {
+	c := CertModel{}
+	err := certC.Find(bson.M{"_id": id, "status": Online}).One(&c)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return c, false, nil
+		}
+		return c, false, err
+	}
+	return c, true, nil
+}
+
+// GetArchivedCertInfo : get archived cert info by id if id is valid, otherwise by host
+func GetArchivedCertInfo(id bson.ObjectId, host string) (CertModel, bool, error) {
+	c := CertModel{}
+	selector := bson.M{"host": host, "status": Offline}
+	if id.Valid() {
+		selector = bson.M{"_id": id, "status": Offline}
+	}
+	err := certC.Find(selector).One(&c)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return c, false, nil
+		}
+		return c, false, err
+	}
+	return c, true, nil
+}
+
+// GetAnyCertInfoByHost : get cert info by host whatever its status
+func GetAnyCertInfoByHost(host string) (CertModel, bool, error) {
+	c := CertModel{}
+	err := certC.Find(bson.M{"host": host}).One(&c)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return c, false, nil
+		}
+		return c, false, err
+	}
+	return c, true, nil
+}
+
 func GetCertInfoByUser(user, host string) (CertModel, bool, error) {
 	c := CertModel{}
 	err := certC.Find(bson.M{"user": user, "host": host, "status": Online}).One(&c)
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+type HistoryEvent string
+
+const (
+	HistoryFirstSeen      HistoryEvent = "first_seen"
+	HistoryRenewed        HistoryEvent = "renewed"
+	HistoryProbeFailed    HistoryEvent = "probe_failed"
+	HistoryProbeRecovered HistoryEvent = "probe_recovered"
+)
+
+// historyRetention : history older than this is removed by mongo
+const historyRetention = 2 * 365 * 24 * time.Hour
+
+var (
+	historyC = config.MongoSession.DB(config.MongoDatabase).C("history")
+)
+
+// HistoryModel : change of the cert served by host or of its probe state
+type HistoryModel struct {
+	ID    bson.ObjectId `bson:"_id" json:"id"`
+	Host  string        `bson:"host" json:"host"`
+	Time  time.Time     `bson:"time" json:"time"`
+	Event HistoryEvent  `bson:"event" json:"event"`
+	// Cert : leaf cert after the change, empty for probe failures
+	Cert  *CertInfo `bson:"cert,omitempty" json:"cert,omitempty"`
+	Error string    `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+func init() {
+	historyCIndex := []mgo.Index{
+		{
+			Key:        []string{"host", "-time"},
+			Background: true,
+		},
+		{
+			Key:         []string{"time"},
+			Background:  true,
+			ExpireAfter: historyRetention,
+		},
+	}
+
+	for _, v := range historyCIndex {
+		err := historyC.EnsureIndex(v)
+		if err != nil {
+			config.Logger.Error("EnsureIndex error", zap.Error(err))
+		}
+	}
+}
+
+func InsertHistory(h HistoryModel) (bool, error) {
+	h.ID = bson.NewObjectId()
+	if h.Time.IsZero() {
+		h.Time = time.Now()
+	}
+	err := historyC.Insert(h)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetHistoryByHost : latest history of host, newest first
+func GetHistoryByHost(host string, limit int) ([]HistoryModel, bool, error) {
+	historyList := []HistoryModel{}
+	err := historyC.Find(bson.M{"host": host}).Sort("-time").Limit(limit).All(&historyList)
+	if err != nil {
+		return historyList, false, err
+	}
+	return historyList, len(historyList) > 0, nil
+}
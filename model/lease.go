@@ -0,0 +1,160 @@
+package model
+
+import (
+	"errors"
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+var (
+	leaseC = config.MongoSession.DB(config.MongoDatabase).C("lease")
+)
+
+// LeaseModel : a named lock held by Holder until ExpireAt unless renewed
+type LeaseModel struct {
+	Name        string    `bson:"_id" json:"name"`
+	Holder      string    `bson:"holder" json:"holder"`
+	AcquireTime time.Time `bson:"acquire_time" json:"acquire_time"`
+	RenewTime   time.Time `bson:"renew_time" json:"renew_time"`
+	ExpireAt    time.Time `bson:"expire_at" json:"expire_at"`
+	// Runs : last run of each job done under the lease, kept across holders
+	Runs map[string]time.Time `bson:"runs,omitempty" json:"runs,omitempty"`
+}
+
+func init() {
+	// 旧版本在 expire_at 上建有 TTL 索引，会在租约过期一小时后连同 runs 一起删除
+	if err := leaseC.DropIndex("expire_at"); err != nil && !strings.Contains(err.Error(), "index not found") && !strings.Contains(err.Error(), "ns not found") {
+		config.Logger.Error("DropIndex error", zap.Error(err))
+	}
+}
+
+// strongLeaseC : lease collection on a copy of the session in strong mode. The global session is
+// eventual and may read a stale secondary, which could make two replicas believe they hold a lease.
+// Call the returned func when done.
+func strongLeaseC() (*mgo.Collection, func()) {
+	session := config.MongoSession.Copy()
+	session.SetMode(mgo.Strong, true)
+	return leaseC.With(session), session.Close
+}
+
+// ServerTime : current time of the mongo server. Lease expiry is computed and compared with it
+// rather than the local clock, so clock skew between replicas cannot make two of them lead.
+func ServerTime() (time.Time, error) {
+	c, done := strongLeaseC()
+	defer done()
+	return serverTime(c)
+}
+
+// serverTime : ServerTime on the session of c
+func serverTime(c *mgo.Collection) (time.Time, error) {
+	result := struct {
+		LocalTime time.Time `bson:"localTime"`
+	}{}
+	if err := c.Database.Session.Run("isMaster", &result); err != nil {
+		return time.Time{}, err
+	}
+	if result.LocalTime.IsZero() {
+		return time.Time{}, errors.New("isMaster returned no localTime")
+	}
+	return result.LocalTime, nil
+}
+
+// AcquireLease : renew lease name if holder holds it, or take it over if it is free or expired.
+// Returns false if another holder holds it.
+func AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	c, done := strongLeaseC()
+	defer done()
+	now, err := serverTime(c)
+	if err != nil {
+		return false, err
+	}
+	err = c.Update(bson.M{"_id": name, "holder": holder, "expire_at": bson.M{"$gt": now}}, bson.M{
+		"$set": bson.M{"renew_time": now, "expire_at": now.Add(ttl)},
+	})
+	if err == nil {
+		return true, nil
+	}
+	if err != mgo.ErrNotFound {
+		return false, err
+	}
+
+	// 租约不存在或已过期时接管，被他人持有时 upsert 会因 _id 重复失败
+	_, err = c.Upsert(bson.M{"_id": name, "expire_at": bson.M{"$lte": now}}, bson.M{
+		"$set": bson.M{
+			"holder":       holder,
+			"acquire_time": now,
+			"renew_time":   now,
+			"expire_at":    now.Add(ttl),
+		},
+	})
+	if err != nil {
+		if mgo.IsDup(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLease : give up lease name if holder holds it
+func ReleaseLease(name, holder string) error {
+	c, done := strongLeaseC()
+	defer done()
+	now, err := serverTime(c)
+	if err != nil {
+		return err
+	}
+	err = c.Update(bson.M{"_id": name, "holder": holder}, bson.M{
+		"$set": bson.M{"expire_at": now},
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// GetLease : lease name, expired or not
+func GetLease(name string) (LeaseModel, bool, error) {
+	c, done := strongLeaseC()
+	defer done()
+	l := LeaseModel{}
+	err := c.FindId(name).One(&l)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return l, false, nil
+		}
+		return l, false, err
+	}
+	return l, true, nil
+}
+
+// MarkLeaseRun : record that job ran at t under lease name
+func MarkLeaseRun(name, job string, t time.Time) error {
+	c, done := strongLeaseC()
+	defer done()
+	return c.UpdateId(name, bson.M{"$set": bson.M{"runs." + job: t}})
+}
+
+// LeaseStore : leases in mongo, see election.Store
+type LeaseStore struct{}
+
+func (LeaseStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	return AcquireLease(name, holder, ttl)
+}
+
+func (LeaseStore) Release(name, holder string) error {
+	return ReleaseLease(name, holder)
+}
+
+func (LeaseStore) Runs(name string) (map[string]time.Time, error) {
+	l, _, err := GetLease(name)
+	return l.Runs, err
+}
+
+func (LeaseStore) MarkRun(name, job string, t time.Time) error {
+	return MarkLeaseRun(name, job, t)
+}
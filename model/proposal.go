@@ -0,0 +1,122 @@
+package model
+
+import (
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+type ProposalStatus string
+
+const (
+	ProposalPending  ProposalStatus = "pending"
+	ProposalAccepted ProposalStatus = "accepted"
+	ProposalRejected ProposalStatus = "rejected"
+)
+
+const (
+	SourceDNSZone Source = "dns_zone"
+	SourceCTLog   Source = "ct_log"
+)
+
+var (
+	proposalC = config.MongoSession.DB(config.MongoDatabase).C("proposal")
+)
+
+// ProposalModel : discovered host waiting to be accepted into the monitored set
+type ProposalModel struct {
+	ID         bson.ObjectId  `bson:"_id" json:"id"`
+	Host       string         `bson:"host" json:"host"`
+	User       string         `bson:"user" json:"user"`
+	Sources    []Source       `bson:"sources" json:"sources"`
+	Status     ProposalStatus `bson:"status" json:"status"`
+	AddTime    time.Time      `bson:"add_time" json:"add_time"`
+	UpdateTime time.Time      `bson:"update_time" json:"update_time"`
+}
+
+func init() {
+	proposalCIndex := []mgo.Index{
+		{
+			Key:        []string{"host", "user"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"user", "status"},
+			Background: true,
+		},
+	}
+
+	// 旧版本的唯一索引只有 host，不同用户无法提议同一个 host
+	if err := proposalC.DropIndex("host"); err != nil && !strings.Contains(err.Error(), "index not found") && !strings.Contains(err.Error(), "ns not found") {
+		config.Logger.Error("DropIndex error", zap.Error(err))
+	}
+	for _, v := range proposalCIndex {
+		err := proposalC.EnsureIndex(v)
+		if err != nil {
+			config.Logger.Error("EnsureIndex error", zap.Error(err))
+		}
+	}
+}
+
+// CreateProposal : propose host discovered by source to user, returns false if host was already proposed to user.
+// Pending proposals record the additional source, accepted and rejected ones are left alone.
+func CreateProposal(host, user string, source Source) (bool, error) {
+	now := time.Now()
+	err := proposalC.Insert(ProposalModel{
+		ID:         bson.NewObjectId(),
+		Host:       host,
+		User:       user,
+		Sources:    []Source{source},
+		Status:     ProposalPending,
+		AddTime:    now,
+		UpdateTime: now,
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !strings.Contains(err.Error(), "E11000 duplicate key error collection") {
+		return false, err
+	}
+
+	err = proposalC.Update(bson.M{"host": host, "user": user, "status": ProposalPending}, bson.M{
+		"$addToSet": bson.M{"sources": source},
+		"$set":      bson.M{"update_time": now},
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return false, err
+	}
+	return false, nil
+}
+
+// GetProposalListByUser : proposals of user, empty status means all
+func GetProposalListByUser(user string, status ProposalStatus) ([]ProposalModel, bool, error) {
+	proposalList := []ProposalModel{}
+	query := bson.M{"user": user}
+	if status != "" {
+		query["status"] = status
+	}
+	err := proposalC.Find(query).Sort("host").All(&proposalList)
+	if err != nil {
+		return proposalList, false, err
+	}
+	return proposalList, len(proposalList) > 0, nil
+}
+
+// UpdateProposalStatus : set status of user's pending proposals for hosts
+func UpdateProposalStatus(user string, hosts []string, status ProposalStatus) (int, error) {
+	info, err := proposalC.UpdateAll(bson.M{
+		"user":   user,
+		"host":   bson.M{"$in": hosts},
+		"status": ProposalPending,
+	}, bson.M{
+		"$set": bson.M{"status": status, "update_time": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Updated, nil
+}
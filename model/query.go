@@ -0,0 +1,247 @@
+package model
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MaxQueryLimit : upper bound of CertQuery.Limit
+const MaxQueryLimit = 1000
+
+// hasExpiry : aggregation expression, whether the host has expire_at. It is null when not set,
+// so it is checked before comparing expire_at.
+var hasExpiry = bson.M{"$gt": []interface{}{"$expire_at", nil}}
+
+// CertQuerySorts : sort parameter to field, - prefix sorts descending
+var CertQuerySorts = map[string]string{
+	"host":        "host",
+	"expiry":      "expire_at",
+	"add_time":    "add_time",
+	"update_time": "update_time",
+}
+
+// CertQuery : filter, sort and page of cert info list, zero values do not filter
+type CertQuery struct {
+	User string
+	Team string
+	// Statuses : empty means Online only
+	Statuses []Status
+	// MinDays, MaxDays : range of days until the soonest cert expiry
+	MinDays *int
+	MaxDays *int
+	// Issuer : case insensitive substring of the issuer of any cert
+	Issuer string
+	// ProbeError : true for hosts whose last probe failed, false for the others
+	ProbeError *bool
+	// Discrepancy : true for hosts whose results differ between vantage points, false for the others
+	Discrepancy *bool
+	Labels      map[string]string
+	// Criticalities : hosts of any of these, medium includes hosts without criticality
+	Criticalities []Criticality
+	// Sort : key of CertQuerySorts with optional - prefix, default host
+	Sort string
+	// Page : 1 based, used with Limit
+	Page  int
+	Limit int
+}
+
+func (q CertQuery) selector() bson.M {
+	selector := bson.M{"status": Online}
+	if len(q.Statuses) == 1 {
+		selector["status"] = q.Statuses[0]
+	} else if len(q.Statuses) > 1 {
+		selector["status"] = bson.M{"$in": q.Statuses}
+	}
+	if q.User != "" {
+		selector["user"] = q.User
+	}
+	if q.Team != "" {
+		selector["team"] = q.Team
+	}
+
+	now := time.Now()
+	expireAt := bson.M{}
+	if q.MinDays != nil {
+		expireAt["$gte"] = now.AddDate(0, 0, *q.MinDays)
+	}
+	if q.MaxDays != nil {
+		expireAt["$lt"] = now.AddDate(0, 0, *q.MaxDays+1)
+	}
+	if len(expireAt) > 0 {
+		selector["expire_at"] = expireAt
+	}
+
+	if q.Issuer != "" {
+		selector["cert.issuer"] = bson.RegEx{Pattern: regexp.QuoteMeta(q.Issuer), Options: "i"}
+	}
+	if q.ProbeError != nil {
+		if *q.ProbeError {
+			selector["probe_error"] = bson.M{"$nin": []interface{}{"", nil}}
+		} else {
+			selector["probe_error"] = bson.M{"$in": []interface{}{"", nil}}
+		}
+	}
+	if q.Discrepancy != nil {
+		if *q.Discrepancy {
+			selector["discrepancy"] = bson.M{"$nin": []interface{}{"", nil}}
+		} else {
+			selector["discrepancy"] = bson.M{"$in": []interface{}{"", nil}}
+		}
+	}
+	for k, v := range q.Labels {
+		selector["labels."+k] = v
+	}
+	if len(q.Criticalities) > 0 {
+		in := []interface{}{}
+		for _, c := range q.Criticalities {
+			in = append(in, c)
+			if c == CriticalityMedium {
+				in = append(in, "", nil)
+			}
+		}
+		selector["criticality"] = bson.M{"$in": in}
+	}
+	return selector
+}
+
+func (q CertQuery) sortField() string {
+	desc := strings.HasPrefix(q.Sort, "-")
+	field, ok := CertQuerySorts[strings.TrimPrefix(q.Sort, "-")]
+	if !ok {
+		field = "host"
+	}
+	if desc {
+		return "-" + field
+	}
+	return field
+}
+
+// GetCertInfoList : cert info matching query and the total count before paging
+func GetCertInfoList(q CertQuery) ([]CertModel, int, error) {
+	certModelList := []CertModel{}
+	query := certC.Find(q.selector())
+	total, err := query.Count()
+	if err != nil {
+		return certModelList, 0, err
+	}
+
+	// host 保证分页顺序稳定
+	sortField := q.sortField()
+	if strings.TrimPrefix(sortField, "-") == "expire_at" {
+		err = q.expirySorted(sortField).All(&certModelList)
+		return certModelList, total, err
+	}
+	if strings.TrimPrefix(sortField, "-") == "host" {
+		query = query.Sort(sortField)
+	} else {
+		query = query.Sort(sortField, "host")
+	}
+	if skip, limit := q.pageBounds(); limit > 0 {
+		query = query.Skip(skip).Limit(limit)
+	}
+	err = query.All(&certModelList)
+	return certModelList, total, err
+}
+
+// pageBounds : documents to skip and to return, 0 limit returns all
+func (q CertQuery) pageBounds() (int, int) {
+	if q.Limit <= 0 {
+		return 0, 0
+	}
+	limit := q.Limit
+	if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+	if q.Page > 1 {
+		return (q.Page - 1) * limit, limit
+	}
+	return 0, limit
+}
+
+// expirySorted : hosts matching q sorted by expire_at as sortField says, hosts without expire_at last
+// either way. A plain sort puts them first in ascending order, as null sorts before dates.
+func (q CertQuery) expirySorted(sortField string) *mgo.Pipe {
+	order := 1
+	if strings.HasPrefix(sortField, "-") {
+		order = -1
+	}
+	pipeline := []bson.M{
+		{"$match": q.selector()},
+		{"$addFields": bson.M{"_has_expiry": hasExpiry}},
+		{"$sort": bson.D{{Name: "_has_expiry", Value: -1}, {Name: "expire_at", Value: order}, {Name: "host", Value: 1}}},
+	}
+	if skip, limit := q.pageBounds(); limit > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": skip}, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"_has_expiry": 0}})
+	return certC.Pipe(pipeline)
+}
+
+// CertGroup : hosts sharing the value of the group field, empty value when it is not set
+type CertGroup struct {
+	Value string `bson:"_id" json:"value"`
+	Hosts int    `bson:"hosts" json:"hosts"`
+	// Expired, Expiring : soonest cert expired, or expires within the given days
+	Expired  int `bson:"expired" json:"expired"`
+	Expiring int `bson:"expiring" json:"expiring"`
+	// Failing : last probe failed
+	Failing int `bson:"failing" json:"failing"`
+}
+
+// GetCertInfoGroups : hosts matching query grouped by field, sorted by value
+func GetCertInfoGroups(q CertQuery, field string, expiringDays int) ([]CertGroup, error) {
+	groupList := []CertGroup{}
+	now := time.Now()
+	countIf := func(cond interface{}) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": []interface{}{cond, 1, 0}}}
+	}
+	pipeline := []bson.M{
+		{"$match": q.selector()},
+		{"$group": bson.M{
+			"_id":   bson.M{"$ifNull": []interface{}{"$" + field, ""}},
+			"hosts": bson.M{"$sum": 1},
+			"expired": countIf(bson.M{"$and": []interface{}{
+				hasExpiry,
+				bson.M{"$lt": []interface{}{"$expire_at", now}},
+			}}),
+			"expiring": countIf(bson.M{"$and": []interface{}{
+				hasExpiry,
+				bson.M{"$gte": []interface{}{"$expire_at", now}},
+				bson.M{"$lt": []interface{}{"$expire_at", now.AddDate(0, 0, expiringDays)}},
+			}}),
+			"failing": countIf(bson.M{"$gt": []interface{}{bson.M{"$ifNull": []interface{}{"$probe_error", ""}}, ""}}),
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	err := certC.Pipe(pipeline).All(&groupList)
+	if err != nil || field != "criticality" {
+		return groupList, err
+	}
+
+	// 未设置的 criticality 按 medium 统计
+	merged := []CertGroup{}
+	medium := -1
+	for _, g := range groupList {
+		if g.Value == "" {
+			g.Value = string(CriticalityMedium)
+		}
+		if g.Value == string(CriticalityMedium) && medium >= 0 {
+			merged[medium].Hosts += g.Hosts
+			merged[medium].Expired += g.Expired
+			merged[medium].Expiring += g.Expiring
+			merged[medium].Failing += g.Failing
+			continue
+		}
+		if g.Value == string(CriticalityMedium) {
+			medium = len(merged)
+		}
+		merged = append(merged, g)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Value < merged[j].Value })
+	return merged, nil
+}
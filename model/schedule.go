@@ -0,0 +1,42 @@
+package model
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// GetDueCertInfoList : online hosts probed from CentralVantage whose next check is due at now,
+// most overdue first, at most limit
+func GetDueCertInfoList(now time.Time, limit int) ([]CertModel, error) {
+	certModelList := []CertModel{}
+	err := certC.Find(bson.M{
+		"status": Online,
+		"source": bson.M{"$ne": SourceKubernetesSecret},
+		"$and": []bson.M{
+			{"$or": []bson.M{{"next_check": bson.M{"$lte": now}}, {"next_check": bson.M{"$exists": false}}}},
+			{"$or": []bson.M{{"vantages": CentralVantage}, {"vantages": bson.M{"$exists": false}}, {"vantages": bson.M{"$size": 0}}}},
+		},
+	}).Sort("next_check").Limit(limit).All(&certModelList)
+	return certModelList, err
+}
+
+// GetProbedCertInfoList : online hosts probed at least once, with the fields exported as metrics
+func GetProbedCertInfoList() ([]CertModel, error) {
+	certModelList := []CertModel{}
+	err := certC.Find(bson.M{"status": Online, "probe_time": bson.M{"$exists": true}}).Select(bson.M{
+		"host": 1, "port": 1, "cert": 1, "probe_error": 1, "probe_time": 1, "criticality": 1, "team": 1, "labels": 1,
+	}).All(&certModelList)
+	return certModelList, err
+}
+
+// SetNextCheck : schedule the next probe of host, failures is the number of consecutive failed probes
+func SetNextCheck(host string, next time.Time, failures int) error {
+	err := certC.Update(bson.M{"host": host, "status": Online}, bson.M{
+		"$set": bson.M{"next_check": next, "probe_failures": failures},
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"reflect"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate      AuditAction = "create"
+	AuditUpdate      AuditAction = "update"
+	AuditDelete      AuditAction = "delete"
+	AuditRestore     AuditAction = "restore"
+	AuditSubscribe   AuditAction = "subscribe"
+	AuditUnsubscribe AuditAction = "unsubscribe"
+)
+
+// AuditModel : a change of a host record, the audit log is append only
+type AuditModel struct {
+	ID     bson.ObjectId `bson:"_id" json:"id"`
+	Time   time.Time     `bson:"time" json:"time"`
+	Actor  string        `bson:"actor" json:"actor"`
+	Action AuditAction   `bson:"action" json:"action"`
+	Host   string        `bson:"host" json:"host"`
+	// Before, After : nil when the host did not exist
+	Before *AuditState `bson:"before,omitempty" json:"before,omitempty"`
+	After  *AuditState `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// AuditState : fields of a host record tracked by the audit log, probe results are left out
+type AuditState struct {
+	Status Status            `bson:"status" json:"status"`
+	User   []string          `bson:"user" json:"user"`
+	Port   string            `bson:"port" json:"port"`
+	Team   string            `bson:"team,omitempty" json:"team,omitempty"`
+	Labels map[string]string `bson:"labels,omitempty" json:"labels,omitempty"`
+	// Criticality : as set, empty means medium
+	Criticality Criticality  `bson:"criticality,omitempty" json:"criticality,omitempty"`
+	Vantages    []string     `bson:"vantages,omitempty" json:"vantages,omitempty"`
+	Archive     *ArchiveInfo `bson:"archive,omitempty" json:"archive,omitempty"`
+	// Mutes : snoozes and acks of reminders by user
+	Mutes map[string]Mute `bson:"mutes,omitempty" json:"mutes,omitempty"`
+}
+
+// AuditState : tracked fields of c
+func (c CertModel) AuditState() *AuditState {
+	return &AuditState{
+		Status:      c.Status,
+		User:        c.User,
+		Port:        c.Port,
+		Team:        c.Team,
+		Labels:      c.Labels,
+		Criticality: c.Criticality,
+		Vantages:    c.Vantages,
+		Archive:     c.Archive,
+		Mutes:       c.Mutes,
+	}
+}
+
+// NewAudit : change of host by actor, before or after is nil if host did not exist
+func NewAudit(actor string, action AuditAction, host string, before, after *CertModel) AuditModel {
+	a := AuditModel{Actor: actor, Action: action, Host: host}
+	if before != nil {
+		a.Before = before.AuditState()
+	}
+	if after != nil {
+		a.After = after.AuditState()
+	}
+	return a
+}
+
+// Unchanged : the tracked fields are the same before and after, e.g. a sync that found nothing new
+func (a AuditModel) Unchanged() bool {
+	return reflect.DeepEqual(a.Before, a.After)
+}
+
+// CreateAction : audit action of adding user to host, false if the user was already subscribed.
+// before is the stored host, if it exists.
+func CreateAction(before CertModel, exists bool, user string) (AuditAction, bool) {
+	if !exists {
+		return AuditCreate, true
+	}
+	for _, u := range before.User {
+		if u == user {
+			return "", false
+		}
+	}
+	return AuditSubscribe, true
+}
+
+// AuditQuery : filter and page of the audit log, zero values do not filter
+type AuditQuery struct {
+	Host   string
+	Actor  string
+	Action AuditAction
+	Since  time.Time
+	Until  time.Time
+	// Page : 1 based, used with Limit
+	Page  int
+	Limit int
+}
+
+// Selector : mongo selector of the filters of q, Until is exclusive
+func (q AuditQuery) Selector() bson.M {
+	selector := bson.M{}
+	if q.Host != "" {
+		selector["host"] = q.Host
+	}
+	if q.Actor != "" {
+		selector["actor"] = q.Actor
+	}
+	if q.Action != "" {
+		selector["action"] = q.Action
+	}
+	timeRange := bson.M{}
+	if !q.Since.IsZero() {
+		timeRange["$gte"] = q.Since
+	}
+	if !q.Until.IsZero() {
+		timeRange["$lt"] = q.Until
+	}
+	if len(timeRange) > 0 {
+		selector["time"] = timeRange
+	}
+	return selector
+}
@@ -0,0 +1,144 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNewAudit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	stored := CertModel{
+		ID:          bson.NewObjectId(),
+		Host:        "www.example.com",
+		User:        []string{"likuo"},
+		Port:        "443",
+		Team:        "sre",
+		Labels:      map[string]string{"env": "prod"},
+		Criticality: CriticalityHigh,
+		Vantages:    []string{"bj"},
+		Mutes:       map[string]Mute{"likuo": {Serial: "0A"}},
+		// probe results are not tracked
+		Cert:       []probe.CertInfo{{CommonName: "www.example.com"}},
+		ProbeError: "timeout",
+		ProbeTime:  now,
+	}
+	archived := stored
+	archived.Status = Offline
+	archived.Archive = &ArchiveInfo{Reason: "decommissioned", By: "likuo", Time: now}
+
+	a := NewAudit("likuo", AuditDelete, stored.Host, &stored, &archived)
+	if a.Actor != "likuo" || a.Action != AuditDelete || a.Host != "www.example.com" {
+		t.Errorf("NewAudit() = %+v", a)
+	}
+	want := &AuditState{
+		User:        []string{"likuo"},
+		Port:        "443",
+		Team:        "sre",
+		Labels:      map[string]string{"env": "prod"},
+		Criticality: CriticalityHigh,
+		Vantages:    []string{"bj"},
+		Mutes:       map[string]Mute{"likuo": {Serial: "0A"}},
+	}
+	if !reflect.DeepEqual(a.Before, want) {
+		t.Errorf("Before = %+v, want %+v", a.Before, want)
+	}
+	want.Status, want.Archive = Offline, archived.Archive
+	if !reflect.DeepEqual(a.After, want) {
+		t.Errorf("After = %+v, want %+v", a.After, want)
+	}
+
+	if a := NewAudit("api", AuditCreate, stored.Host, nil, &stored); a.Before != nil || a.After == nil {
+		t.Errorf("create: Before = %+v, After = %+v, want only After", a.Before, a.After)
+	}
+	if a := NewAudit("api", AuditDelete, stored.Host, &stored, nil); a.Before == nil || a.After != nil {
+		t.Errorf("delete of a missing host: Before = %+v, After = %+v, want only Before", a.Before, a.After)
+	}
+}
+
+func TestAuditUnchanged(t *testing.T) {
+	stored := CertModel{
+		Host:   "www.example.com",
+		User:   []string{"likuo"},
+		Port:   "443",
+		Labels: map[string]string{"namespace": "web"},
+	}
+	for _, tt := range []struct {
+		name      string
+		change    func(c *CertModel)
+		unchanged bool
+	}{
+		{name: "nothing", change: func(c *CertModel) {}, unchanged: true},
+		{
+			name: "probe result",
+			change: func(c *CertModel) {
+				c.Cert = []probe.CertInfo{{CommonName: "www.example.com"}}
+				c.ProbeTime = time.Now()
+				c.UpdateTime = time.Now()
+			},
+			unchanged: true,
+		},
+		{name: "same labels in a new map", change: func(c *CertModel) { c.Labels = map[string]string{"namespace": "web"} }, unchanged: true},
+		{name: "label", change: func(c *CertModel) { c.Labels = map[string]string{"namespace": "api"} }},
+		{name: "port", change: func(c *CertModel) { c.Port = "8443" }},
+		{name: "user", change: func(c *CertModel) { c.User = []string{"likuo", "ops"} }},
+		{name: "snooze", change: func(c *CertModel) { c.Mutes = map[string]Mute{"likuo": {Until: time.Now()}} }},
+		{name: "criticality", change: func(c *CertModel) { c.Criticality = CriticalityLow }},
+	} {
+		after := stored
+		tt.change(&after)
+		if got := NewAudit("kubernetes", AuditUpdate, stored.Host, &stored, &after).Unchanged(); got != tt.unchanged {
+			t.Errorf("%s: Unchanged() = %v, want %v", tt.name, got, tt.unchanged)
+		}
+	}
+	if NewAudit("kubernetes", AuditCreate, stored.Host, nil, &stored).Unchanged() {
+		t.Error("create: Unchanged() = true, want false")
+	}
+}
+
+func TestCreateAction(t *testing.T) {
+	stored := CertModel{Host: "www.example.com", User: []string{"likuo", "ops"}}
+	for _, tt := range []struct {
+		name    string
+		exists  bool
+		user    string
+		action  AuditAction
+		changed bool
+	}{
+		{name: "new host", user: "likuo", action: AuditCreate, changed: true},
+		{name: "new user", exists: true, user: "zhangsan", action: AuditSubscribe, changed: true},
+		{name: "already subscribed", exists: true, user: "ops"},
+	} {
+		action, changed := CreateAction(stored, tt.exists, tt.user)
+		if action != tt.action || changed != tt.changed {
+			t.Errorf("%s: CreateAction() = %q, %v, want %q, %v", tt.name, action, changed, tt.action, tt.changed)
+		}
+	}
+}
+
+func TestAuditQuerySelector(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	for _, tt := range []struct {
+		name string
+		q    AuditQuery
+		want bson.M
+	}{
+		{name: "all", q: AuditQuery{Page: 2, Limit: 10}, want: bson.M{}},
+		{
+			name: "host and action",
+			q:    AuditQuery{Host: "www.example.com", Action: AuditDelete},
+			want: bson.M{"host": "www.example.com", "action": AuditDelete},
+		},
+		{name: "actor since", q: AuditQuery{Actor: "likuo", Since: since}, want: bson.M{"actor": "likuo", "time": bson.M{"$gte": since}}},
+		{name: "time range", q: AuditQuery{Since: since, Until: until}, want: bson.M{"time": bson.M{"$gte": since, "$lt": until}}},
+	} {
+		if got := tt.q.Selector(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Selector() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
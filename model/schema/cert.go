@@ -0,0 +1,156 @@
+// Package schema defines the documents stored by package model and the rules on them.
+// It does not use the database, so the rules can be tested without mongo.
+package schema
+
+import (
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type Status int
+
+const (
+	Online  Status = 0
+	Offline Status = 1
+)
+
+type CertModel struct {
+	ID         bson.ObjectId      `bson:"_id" json:"id"`
+	User       []string           `bson:"user" json:"user"`
+	Status     Status             `bson:"status" json:"status"`
+	Host       string             `bson:"host" json:"host"`
+	Port       string             `bson:"port" json:"port"`
+	AddTime    time.Time          `bson:"add_time" json:"add_time"`
+	UpdateTime time.Time          `bson:"update_time" json:"update_time"`
+	Cert       []probe.CertInfo   `bson:"cert" json:"cert"`
+	Staple     probe.StapleInfo   `bson:"staple" json:"staple"`
+	Chain      []probe.ChainIssue `bson:"chain" json:"chain"`
+	// Source : how the host was added, empty means by user
+	Source Source            `bson:"source,omitempty" json:"source,omitempty"`
+	Labels map[string]string `bson:"labels,omitempty" json:"labels,omitempty"`
+	// Criticality : empty means CriticalityMedium
+	Criticality Criticality `bson:"criticality,omitempty" json:"criticality,omitempty"`
+	// ExpireAt : soonest NotAfter of Cert, kept for filtering and sorting
+	ExpireAt time.Time `bson:"expire_at,omitempty" json:"expire_at,omitempty"`
+	// ProbeError : error of the last probe, empty if it succeeded
+	ProbeError string    `bson:"probe_error,omitempty" json:"probe_error,omitempty"`
+	ProbeTime  time.Time `bson:"probe_time,omitempty" json:"probe_time,omitempty"`
+	// NextCheck : when the scheduler probes the host next, unset means as soon as possible
+	NextCheck time.Time `bson:"next_check,omitempty" json:"next_check,omitempty"`
+	// ProbeFailures : consecutive failed probes, for backoff
+	ProbeFailures int `bson:"probe_failures,omitempty" json:"probe_failures,omitempty"`
+	// Team : owning team, reminders also go to its members on call and the host is kept
+	// when its last user unsubscribes
+	Team string `bson:"team,omitempty" json:"team,omitempty"`
+	// Mutes : reminders muted per user, keyed by uid
+	Mutes map[string]Mute `bson:"mutes,omitempty" json:"mutes,omitempty"`
+	// Archive : why and by whom the host was deleted, set while status is Offline
+	Archive *ArchiveInfo `bson:"archive,omitempty" json:"archive,omitempty"`
+	// Vantages : vantage points probing the host, see ProbeVantages
+	Vantages []string `bson:"vantages,omitempty" json:"vantages,omitempty"`
+	// Discrepancy : how the last results differ between vantage points, empty if they agree
+	Discrepancy string `bson:"discrepancy,omitempty" json:"discrepancy,omitempty"`
+}
+
+// ArchiveInfo : deletion of a host, which is kept Offline so it can be restored
+type ArchiveInfo struct {
+	Reason string    `bson:"reason" json:"reason"`
+	By     string    `bson:"by" json:"by"`
+	Time   time.Time `bson:"time" json:"time"`
+}
+
+// Mute : reminders of a host muted for one user, by snooze until Until or by ack until
+// the leaf cert with serial number Serial is replaced
+type Mute struct {
+	Until  time.Time `bson:"until,omitempty" json:"until,omitempty"`
+	Serial string    `bson:"serial,omitempty" json:"serial,omitempty"`
+}
+
+type Criticality string
+
+const (
+	CriticalityLow      Criticality = "low"
+	CriticalityMedium   Criticality = "medium"
+	CriticalityHigh     Criticality = "high"
+	CriticalityCritical Criticality = "critical"
+)
+
+// Criticalities : from least to most critical
+var Criticalities = []Criticality{CriticalityLow, CriticalityMedium, CriticalityHigh, CriticalityCritical}
+
+// Level : criticality of host, defaults to medium
+func (c CertModel) Level() Criticality {
+	if c.Criticality == "" {
+		return CriticalityMedium
+	}
+	return c.Criticality
+}
+
+func ValidCriticality(c Criticality) bool {
+	for _, v := range Criticalities {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+type Source string
+
+const (
+	SourceUser Source = ""
+	// SourceKubernetes : Ingress or Gateway host, probed like user hosts
+	SourceKubernetes Source = "kubernetes"
+	// SourceKubernetesSecret : TLS secret not served by a known host, certs come from the secret
+	SourceKubernetesSecret Source = "kubernetes_secret"
+)
+
+// Probeable : host can be probed live
+func (c CertModel) Probeable() bool {
+	return c.Source != SourceKubernetesSecret
+}
+
+// Muted : reminders of c are muted for user at now
+func (c CertModel) Muted(user string, now time.Time) bool {
+	m, ok := c.Mutes[user]
+	if !ok {
+		return false
+	}
+	if now.Before(m.Until) {
+		return true
+	}
+	return m.Serial != "" && len(c.Cert) > 0 && c.Cert[0].SerialNumber == m.Serial
+}
+
+// SyncFields : fields of stored set by discovered host c. Labels are always refreshed, source
+// and port only if discovery added the host, certs only if the host is not probed live.
+func (c CertModel) SyncFields(stored CertModel, now time.Time) bson.M {
+	set := bson.M{"update_time": now}
+	for k, v := range c.Labels {
+		set["labels."+k] = v
+	}
+	// 用户手动添加的 host 保持来源不变
+	if stored.Source != SourceUser {
+		set["source"] = c.Source
+		set["port"] = c.Port
+		if !c.Probeable() {
+			set["cert"] = c.Cert
+			set["expire_at"] = SoonestExpiry(c.Cert)
+		}
+	}
+	return set
+}
+
+// SoonestExpiry : soonest NotAfter of certs, zero if there are none
+func SoonestExpiry(certs []probe.CertInfo) time.Time {
+	expireAt := time.Time{}
+	for _, c := range certs {
+		if expireAt.IsZero() || c.NotAfter.Before(expireAt) {
+			expireAt = c.NotAfter
+		}
+	}
+	return expireAt
+}
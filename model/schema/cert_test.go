@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSyncFields(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := now.Add(30 * 24 * time.Hour)
+	certs := []probe.CertInfo{{CommonName: "www.example.com", NotAfter: notAfter}}
+	labels := map[string]string{"namespace": "web", "kind": "Ingress"}
+
+	for _, tt := range []struct {
+		name   string
+		stored Source
+		c      CertModel
+		want   bson.M
+	}{
+		{
+			name:   "user host keeps source and port",
+			stored: SourceUser,
+			c:      CertModel{Source: SourceKubernetes, Port: "8443", Labels: labels},
+			want:   bson.M{"update_time": now, "labels.namespace": "web", "labels.kind": "Ingress"},
+		},
+		{
+			name:   "discovered host follows discovery",
+			stored: SourceKubernetes,
+			c:      CertModel{Source: SourceKubernetes, Port: "8443", Labels: labels, Cert: certs},
+			want:   bson.M{"update_time": now, "labels.namespace": "web", "labels.kind": "Ingress", "source": SourceKubernetes, "port": "8443"},
+		},
+		{
+			name:   "secret replaces certs",
+			stored: SourceKubernetes,
+			c:      CertModel{Source: SourceKubernetesSecret, Cert: certs},
+			want:   bson.M{"update_time": now, "source": SourceKubernetesSecret, "port": "", "cert": certs, "expire_at": notAfter},
+		},
+		{
+			name:   "user host keeps probed certs",
+			stored: SourceUser,
+			c:      CertModel{Source: SourceKubernetesSecret, Cert: certs},
+			want:   bson.M{"update_time": now},
+		},
+	} {
+		got := tt.c.SyncFields(CertModel{Source: tt.stored}, now)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	MaxLabelValueLength = 256
+	// labelGroupPrefix : group by a label, label:env
+	labelGroupPrefix = "label:"
+)
+
+// labelKeyRegexp : label keys are document field names, so . and $ are not allowed
+var labelKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+// groupFields : group by parameter to field, besides label:<key>
+var groupFields = map[string]string{
+	"team":        "team",
+	"criticality": "criticality",
+	"source":      "source",
+}
+
+func ValidLabelKey(key string) bool {
+	return labelKeyRegexp.MatchString(key)
+}
+
+// ValidateLabel : check key and length of value of a label or selector
+func ValidateLabel(key, value string) error {
+	if !ValidLabelKey(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	if len(value) > MaxLabelValueLength {
+		return fmt.Errorf("label %s is longer than %d bytes", key, MaxLabelValueLength)
+	}
+	return nil
+}
+
+// SplitLabels : split a label change into labels to set and to remove, a nil value removes the label
+func SplitLabels(labels map[string]*string) (map[string]string, []string, error) {
+	set := map[string]string{}
+	unset := []string{}
+	for k, v := range labels {
+		value := ""
+		if v != nil {
+			value = *v
+		}
+		if err := ValidateLabel(k, value); err != nil {
+			return nil, nil, err
+		}
+		if v == nil {
+			unset = append(unset, k)
+			continue
+		}
+		set[k] = *v
+	}
+	return set, unset, nil
+}
+
+// HasLabels : c has all labels of selector, an empty selector matches all hosts
+func (c CertModel) HasLabels(selector map[string]string) bool {
+	for k, v := range selector {
+		if value, ok := c.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// LevelIn : criticality of c is one of levels, empty levels match all hosts
+func (c CertModel) LevelIn(levels []Criticality) bool {
+	if len(levels) == 0 {
+		return true
+	}
+	for _, l := range levels {
+		if l == c.Level() {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupField : field to group hosts by, by is team, criticality, source or label:<key>
+func GroupField(by string) (string, bool) {
+	if key := strings.TrimPrefix(by, labelGroupPrefix); key != by {
+		return "labels." + key, ValidLabelKey(key)
+	}
+	field, ok := groupFields[by]
+	return field, ok
+}
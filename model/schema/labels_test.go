@@ -0,0 +1,131 @@
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSplitLabels(t *testing.T) {
+	str := func(s string) *string { return &s }
+	for _, tt := range []struct {
+		name   string
+		labels map[string]*string
+		set    map[string]string
+		unset  []string
+		err    string
+	}{
+		{name: "empty", set: map[string]string{}, unset: []string{}},
+		{
+			name:   "set and remove",
+			labels: map[string]*string{"env": str("prod"), "service": str(""), "region": nil, "old-key_2": nil},
+			set:    map[string]string{"env": "prod", "service": ""},
+			unset:  []string{"old-key_2", "region"},
+		},
+		{name: "dotted key", labels: map[string]*string{"app.kubernetes.io/name": str("cms")}, err: `invalid label key "app.kubernetes.io/name"`},
+		{name: "operator key", labels: map[string]*string{"$set": nil}, err: `invalid label key "$set"`},
+		{name: "leading dash", labels: map[string]*string{"-env": str("prod")}, err: `invalid label key "-env"`},
+		{name: "long key", labels: map[string]*string{strings.Repeat("k", 64): str("v")}, err: `invalid label key "` + strings.Repeat("k", 64) + `"`},
+		{name: "long value", labels: map[string]*string{"env": str(strings.Repeat("v", MaxLabelValueLength+1))}, err: "label env is longer than 256 bytes"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			set, unset, err := SplitLabels(tt.labels)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("SplitLabels() err = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitLabels() err = %v", err)
+			}
+			sort.Strings(unset)
+			if !reflect.DeepEqual(set, tt.set) || !reflect.DeepEqual(unset, tt.unset) {
+				t.Errorf("SplitLabels() = %v, %v, want %v, %v", set, unset, tt.set, tt.unset)
+			}
+		})
+	}
+	if err := ValidateLabel("env", strings.Repeat("v", MaxLabelValueLength)); err != nil {
+		t.Errorf("ValidateLabel() of a value at the limit err = %v", err)
+	}
+}
+
+func TestHasLabels(t *testing.T) {
+	c := CertModel{Labels: map[string]string{"env": "prod", "service": "cms", "team": ""}}
+	for _, tt := range []struct {
+		selector map[string]string
+		want     bool
+	}{
+		{selector: nil, want: true},
+		{selector: map[string]string{"env": "prod"}, want: true},
+		{selector: map[string]string{"env": "prod", "service": "cms"}, want: true},
+		{selector: map[string]string{"team": ""}, want: true},
+		{selector: map[string]string{"env": "test"}},
+		{selector: map[string]string{"env": "prod", "region": "bj"}},
+		{selector: map[string]string{"region": ""}},
+	} {
+		if got := c.HasLabels(tt.selector); got != tt.want {
+			t.Errorf("HasLabels(%v) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+	if !(CertModel{}).HasLabels(nil) || (CertModel{}).HasLabels(map[string]string{"env": "prod"}) {
+		t.Error("host without labels must only match the empty selector")
+	}
+}
+
+func TestCriticality(t *testing.T) {
+	for _, tt := range []struct {
+		criticality Criticality
+		level       Criticality
+		levels      []Criticality
+		in          bool
+	}{
+		{criticality: "", level: CriticalityMedium, levels: nil, in: true},
+		{criticality: "", level: CriticalityMedium, levels: []Criticality{CriticalityMedium}, in: true},
+		{criticality: "", level: CriticalityMedium, levels: []Criticality{CriticalityHigh, CriticalityCritical}},
+		{criticality: CriticalityCritical, level: CriticalityCritical, levels: []Criticality{CriticalityHigh, CriticalityCritical}, in: true},
+		{criticality: CriticalityLow, level: CriticalityLow, levels: []Criticality{CriticalityMedium}},
+	} {
+		c := CertModel{Criticality: tt.criticality}
+		if got := c.Level(); got != tt.level {
+			t.Errorf("Level() of %q = %s, want %s", tt.criticality, got, tt.level)
+		}
+		if got := c.LevelIn(tt.levels); got != tt.in {
+			t.Errorf("LevelIn(%v) of %q = %v, want %v", tt.levels, tt.criticality, got, tt.in)
+		}
+	}
+
+	for _, c := range Criticalities {
+		if !ValidCriticality(c) {
+			t.Errorf("ValidCriticality(%s) = false", c)
+		}
+	}
+	for _, c := range []Criticality{"", "urgent", "High"} {
+		if ValidCriticality(c) {
+			t.Errorf("ValidCriticality(%q) = true", c)
+		}
+	}
+}
+
+func TestGroupField(t *testing.T) {
+	for _, tt := range []struct {
+		by    string
+		field string
+		ok    bool
+	}{
+		{by: "team", field: "team", ok: true},
+		{by: "criticality", field: "criticality", ok: true},
+		{by: "source", field: "source", ok: true},
+		{by: "label:env", field: "labels.env", ok: true},
+		{by: "label:a.b", field: "labels.a.b"},
+		{by: "label:"},
+		{by: "user"},
+		{by: "env"},
+	} {
+		field, ok := GroupField(tt.by)
+		if ok != tt.ok || (ok && field != tt.field) {
+			t.Errorf("GroupField(%q) = %q, %v, want %q, %v", tt.by, field, ok, tt.field, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+)
+
+const (
+	// retryBaseDelay, retryMaxDelay : backoff of failing hosts, doubled per consecutive failure
+	retryBaseDelay = 5 * time.Minute
+	retryMaxDelay  = time.Hour
+	// nearExpiryDelay : hosts within their notice window or expired
+	nearExpiryDelay = time.Hour
+	// soonExpiryDelay : hosts expiring within soonExpiryWindow
+	soonExpiryDelay  = 6 * time.Hour
+	soonExpiryWindow = 90 * 24 * time.Hour
+	farExpiryDelay   = 24 * time.Hour
+)
+
+// NextCheckDelay : delay until NextCheck, backoff after failures, otherwise by how soon certs expire.
+// noticeHours is the notice window of a cert of the host.
+func NextCheckDelay(certs []probe.CertInfo, failures int, now time.Time, noticeHours func(isCA bool) int64) time.Duration {
+	if failures > 0 {
+		delay := retryBaseDelay
+		for i := 1; i < failures && delay < retryMaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		return delay
+	}
+	if len(certs) == 0 {
+		return nearExpiryDelay
+	}
+
+	delay := farExpiryDelay
+	for _, ci := range certs {
+		left := ci.NotAfter.Sub(now)
+		if left <= time.Duration(noticeHours(ci.IsCA))*time.Hour {
+			return nearExpiryDelay
+		}
+		if left <= soonExpiryWindow {
+			delay = soonExpiryDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+)
+
+func TestNextCheckDelay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	leaf := func(left time.Duration) probe.CertInfo { return probe.CertInfo{NotAfter: now.Add(left)} }
+	ca := func(left time.Duration) probe.CertInfo { return probe.CertInfo{NotAfter: now.Add(left), IsCA: true} }
+	// 叶子证书提前 30 天提醒，CA 提前 60 天
+	noticeHours := func(isCA bool) int64 {
+		if isCA {
+			return 60 * 24
+		}
+		return 30 * 24
+	}
+
+	for _, tt := range []struct {
+		name     string
+		certs    []probe.CertInfo
+		failures int
+		want     time.Duration
+	}{
+		{name: "first failure", certs: []probe.CertInfo{leaf(days(365))}, failures: 1, want: 5 * time.Minute},
+		{name: "third failure", failures: 3, want: 20 * time.Minute},
+		{name: "backoff capped", failures: 5, want: time.Hour},
+		{name: "many failures", failures: 100, want: time.Hour},
+		{name: "no certs", want: nearExpiryDelay},
+		{name: "far expiry", certs: []probe.CertInfo{leaf(days(365)), ca(days(3650))}, want: farExpiryDelay},
+		{name: "soon expiry", certs: []probe.CertInfo{leaf(days(80)), ca(days(3650))}, want: soonExpiryDelay},
+		{name: "within notice", certs: []probe.CertInfo{leaf(days(29)), ca(days(3650))}, want: nearExpiryDelay},
+		{name: "at notice", certs: []probe.CertInfo{leaf(days(30))}, want: nearExpiryDelay},
+		{name: "ca within its notice", certs: []probe.CertInfo{leaf(days(365)), ca(days(45))}, want: nearExpiryDelay},
+		{name: "leaf notice does not apply to ca", certs: []probe.CertInfo{ca(days(75))}, want: soonExpiryDelay},
+		{name: "expired", certs: []probe.CertInfo{leaf(-time.Hour)}, want: nearExpiryDelay},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextCheckDelay(tt.certs, tt.failures, now, noticeHours); got != tt.want {
+				t.Errorf("NextCheckDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
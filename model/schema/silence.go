@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type SilenceState string
+
+const (
+	SilencePending SilenceState = "pending"
+	SilenceActive  SilenceState = "active"
+	SilenceExpired SilenceState = "expired"
+)
+
+// SilenceModel : no reminders between Start and End for Host, or for hosts with all labels of Selector
+type SilenceModel struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+	// Host, Selector : at least one is set, both must match when both are set
+	Host     string            `bson:"host,omitempty" json:"host,omitempty"`
+	Selector map[string]string `bson:"selector,omitempty" json:"selector,omitempty"`
+	Start    time.Time         `bson:"start" json:"start"`
+	End      time.Time         `bson:"end" json:"end"`
+	Reason   string            `bson:"reason" json:"reason"`
+	Creator  string            `bson:"creator" json:"creator"`
+	// ExpiredBy : who ended the silence early
+	ExpiredBy  string    `bson:"expired_by,omitempty" json:"expired_by,omitempty"`
+	AddTime    time.Time `bson:"add_time" json:"add_time"`
+	UpdateTime time.Time `bson:"update_time" json:"update_time"`
+}
+
+// Validate : check a new silence created at now
+func (s SilenceModel) Validate(now time.Time) error {
+	if s.Host == "" && len(s.Selector) == 0 {
+		return errors.New("host or selector is required")
+	}
+	for k, v := range s.Selector {
+		if err := ValidateLabel(k, v); err != nil {
+			return err
+		}
+	}
+	if s.Reason == "" {
+		return errors.New("reason is required")
+	}
+	if !s.End.After(s.Start) || !s.End.After(now) {
+		return errors.New("end must be after start and in the future")
+	}
+	return nil
+}
+
+// State : state of s at now
+func (s SilenceModel) State(now time.Time) SilenceState {
+	switch {
+	case !now.Before(s.End):
+		return SilenceExpired
+	case now.Before(s.Start):
+		return SilencePending
+	}
+	return SilenceActive
+}
+
+// Matches : whether s selects host c, regardless of time
+func (s SilenceModel) Matches(c CertModel) bool {
+	if s.Host != "" && s.Host != c.Host {
+		return false
+	}
+	return c.HasLabels(s.Selector)
+}
+
+// SilencedBy : first of silences matching host c
+func SilencedBy(silences []SilenceModel, c CertModel) (SilenceModel, bool) {
+	for _, s := range silences {
+		if s.Matches(c) {
+			return s, true
+		}
+	}
+	return SilenceModel{}, false
+}
+
+// ParseSilenceStates : comma separated states, pending and active if empty, nil for all
+func ParseSilenceStates(v string) ([]SilenceState, error) {
+	if v == "" {
+		return []SilenceState{SilencePending, SilenceActive}, nil
+	}
+	if v == "all" {
+		return nil, nil
+	}
+	states := []SilenceState{}
+	for _, state := range strings.Split(v, ",") {
+		switch SilenceState(state) {
+		case SilencePending, SilenceActive, SilenceExpired:
+			states = append(states, SilenceState(state))
+		default:
+			return nil, fmt.Errorf("invalid state %q, use pending, active, expired or all", state)
+		}
+	}
+	return states, nil
+}
+
+// SilenceSelector : mongo selector of silences of host in any of states at now, all silences if
+// host or states are empty
+func SilenceSelector(host string, states []SilenceState, now time.Time) bson.M {
+	selector := bson.M{}
+	if host != "" {
+		selector["host"] = host
+	}
+	if len(states) > 0 {
+		or := []bson.M{}
+		for _, state := range states {
+			switch state {
+			case SilencePending:
+				or = append(or, bson.M{"start": bson.M{"$gt": now}})
+			case SilenceActive:
+				or = append(or, bson.M{"start": bson.M{"$lte": now}, "end": bson.M{"$gt": now}})
+			case SilenceExpired:
+				or = append(or, bson.M{"end": bson.M{"$lte": now}})
+			}
+		}
+		selector["$or"] = or
+	}
+	return selector
+}
@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSilenceValidate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	valid := SilenceModel{Host: "www.example.com", Start: now, End: now.Add(time.Hour), Reason: "maintenance"}
+	for _, tt := range []struct {
+		name   string
+		change func(s *SilenceModel)
+		err    string
+	}{
+		{name: "host", change: func(s *SilenceModel) {}},
+		{name: "selector", change: func(s *SilenceModel) { s.Host, s.Selector = "", map[string]string{"env": "test"} }},
+		{name: "pending", change: func(s *SilenceModel) { s.Start, s.End = now.Add(time.Hour), now.Add(2*time.Hour) }},
+		{name: "no host or selector", change: func(s *SilenceModel) { s.Host = "" }, err: "host or selector is required"},
+		{name: "invalid label", change: func(s *SilenceModel) { s.Selector = map[string]string{"a.b": "c"} }, err: `invalid label key "a.b"`},
+		{name: "no reason", change: func(s *SilenceModel) { s.Reason = "" }, err: "reason is required"},
+		{name: "end before start", change: func(s *SilenceModel) { s.Start = now.Add(2 * time.Hour) }, err: "end must be after start and in the future"},
+		{name: "end in the past", change: func(s *SilenceModel) { s.Start, s.End = now.Add(-2*time.Hour), now.Add(-time.Hour) }, err: "end must be after start and in the future"},
+	} {
+		s := valid
+		tt.change(&s)
+		err := s.Validate(now)
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("%s: Validate() = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestSilenceState(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := SilenceModel{Start: start, End: start.Add(time.Hour)}
+	for _, tt := range []struct {
+		now  time.Time
+		want SilenceState
+	}{
+		{now: start.Add(-time.Second), want: SilencePending},
+		{now: start, want: SilenceActive},
+		{now: start.Add(time.Hour - time.Second), want: SilenceActive},
+		{now: start.Add(time.Hour), want: SilenceExpired},
+	} {
+		if got := s.State(tt.now); got != tt.want {
+			t.Errorf("State(%s) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestSilenceMatches(t *testing.T) {
+	c := CertModel{Host: "www.example.com", Labels: map[string]string{"env": "prod", "service": "cms"}}
+	for _, tt := range []struct {
+		name string
+		s    SilenceModel
+		want bool
+	}{
+		{name: "host", s: SilenceModel{Host: "www.example.com"}, want: true},
+		{name: "other host", s: SilenceModel{Host: "a.example.com"}},
+		{name: "selector", s: SilenceModel{Selector: map[string]string{"env": "prod"}}, want: true},
+		{name: "other selector", s: SilenceModel{Selector: map[string]string{"env": "test"}}},
+		{name: "host and selector", s: SilenceModel{Host: "www.example.com", Selector: map[string]string{"service": "cms"}}, want: true},
+		{name: "host and other selector", s: SilenceModel{Host: "www.example.com", Selector: map[string]string{"service": "api"}}},
+	} {
+		if got := tt.s.Matches(c); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	silences := []SilenceModel{
+		{Reason: "other host", Host: "a.example.com"},
+		{Reason: "prod", Selector: map[string]string{"env": "prod"}},
+		{Reason: "host", Host: "www.example.com"},
+	}
+	if s, ok := SilencedBy(silences, c); !ok || s.Reason != "prod" {
+		t.Errorf("SilencedBy() = %+v, %v, want the first match", s, ok)
+	}
+	if _, ok := SilencedBy(silences[:1], c); ok {
+		t.Error("SilencedBy() of non matching silences = true")
+	}
+}
+
+func TestParseSilenceStates(t *testing.T) {
+	for _, tt := range []struct {
+		v    string
+		want []SilenceState
+		err  string
+	}{
+		{v: "", want: []SilenceState{SilencePending, SilenceActive}},
+		{v: "all"},
+		{v: "expired", want: []SilenceState{SilenceExpired}},
+		{v: "active,expired", want: []SilenceState{SilenceActive, SilenceExpired}},
+		{v: "active,muted", err: `invalid state "muted", use pending, active, expired or all`},
+	} {
+		got, err := ParseSilenceStates(tt.v)
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSilenceStates(%q) = %v, %v, want %v, %q", tt.v, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSilenceSelector(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name   string
+		host   string
+		states []SilenceState
+		want   bson.M
+	}{
+		{name: "all", want: bson.M{}},
+		{name: "host", host: "www.example.com", want: bson.M{"host": "www.example.com"}},
+		{
+			name:   "pending and active",
+			states: []SilenceState{SilencePending, SilenceActive},
+			want: bson.M{"$or": []bson.M{
+				{"start": bson.M{"$gt": now}},
+				{"start": bson.M{"$lte": now}, "end": bson.M{"$gt": now}},
+			}},
+		},
+		{
+			name:   "expired of host",
+			host:   "www.example.com",
+			states: []SilenceState{SilenceExpired},
+			want:   bson.M{"host": "www.example.com", "$or": []bson.M{{"end": bson.M{"$lte": now}}}},
+		},
+	} {
+		if got := SilenceSelector(tt.host, tt.states, now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SilenceSelector() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
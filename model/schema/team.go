@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TeamModel : owners of hosts, reminders of team hosts go to the members on call
+type TeamModel struct {
+	ID      bson.ObjectId `bson:"_id" json:"id"`
+	Name    string        `bson:"name" json:"name"`
+	Members []string      `bson:"members" json:"members"`
+	// Rotation : empty means all members are on call
+	Rotation Rotation `bson:"rotation" json:"rotation"`
+	// Personal : created for a single user by model.MigratePersonalTeams
+	Personal   bool      `bson:"personal,omitempty" json:"personal,omitempty"`
+	AddTime    time.Time `bson:"add_time" json:"add_time"`
+	UpdateTime time.Time `bson:"update_time" json:"update_time"`
+}
+
+// Rotation : Members take turns being on call for PeriodHours each, in order, starting at Start
+type Rotation struct {
+	Members     []string  `bson:"members,omitempty" json:"members,omitempty"`
+	Start       time.Time `bson:"start,omitempty" json:"start,omitempty"`
+	PeriodHours int       `bson:"period_hours,omitempty" json:"period_hours,omitempty"`
+}
+
+// OnCall : members on call at now
+func (t TeamModel) OnCall(now time.Time) []string {
+	r := t.Rotation
+	if len(r.Members) == 0 || r.PeriodHours <= 0 {
+		return t.Members
+	}
+	n := int64(len(r.Members))
+	shift := int64(now.Sub(r.Start)/time.Hour) / int64(r.PeriodHours)
+	// 轮值开始前按第一个人值班
+	if shift < 0 {
+		shift = 0
+	}
+	return []string{r.Members[shift%n]}
+}
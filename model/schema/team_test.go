@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOnCall(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	members := []string{"alice", "bob", "carol", "dave"}
+	rotation := Rotation{Members: []string{"bob", "carol", "dave"}, Start: start, PeriodHours: 24 * 7}
+
+	for _, tt := range []struct {
+		name     string
+		rotation Rotation
+		now      time.Time
+		want     []string
+	}{
+		{name: "no rotation", now: start, want: members},
+		{name: "no period", rotation: Rotation{Members: []string{"bob"}, Start: start}, now: start, want: members},
+		{name: "before start", rotation: rotation, now: start.Add(-time.Hour), want: []string{"bob"}},
+		{name: "at start", rotation: rotation, now: start, want: []string{"bob"}},
+		{name: "end of first shift", rotation: rotation, now: start.Add(7*24*time.Hour - time.Second), want: []string{"bob"}},
+		{name: "second shift", rotation: rotation, now: start.Add(7 * 24 * time.Hour), want: []string{"carol"}},
+		{name: "third shift", rotation: rotation, now: start.Add(15 * 24 * time.Hour), want: []string{"dave"}},
+		{name: "wraps around", rotation: rotation, now: start.Add(21 * 24 * time.Hour), want: []string{"bob"}},
+		{
+			name:     "hourly",
+			rotation: Rotation{Members: []string{"bob", "carol"}, Start: start, PeriodHours: 1},
+			now:      start.Add(101 * time.Hour),
+			want:     []string{"carol"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			team := TeamModel{Name: "sre", Members: members, Rotation: tt.rotation}
+			if got := team.OnCall(tt.now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OnCall(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
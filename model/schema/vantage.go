@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CentralVantage : vantage point of the service itself
+const CentralVantage = "central"
+
+// VantageResultMaxAge : older results are not compared, the vantage point may have stopped.
+// Longer than the longest scheduled interval of a healthy host plus jitter.
+const VantageResultMaxAge = 27 * time.Hour
+
+// VantageResultModel : last probe result of host from a vantage point
+type VantageResultModel struct {
+	ID      bson.ObjectId      `bson:"_id" json:"-"`
+	Host    string             `bson:"host" json:"host"`
+	Vantage string             `bson:"vantage" json:"vantage"`
+	Port    string             `bson:"port" json:"port"`
+	Time    time.Time          `bson:"time" json:"time"`
+	Certs   []probe.CertInfo   `bson:"certs" json:"certs"`
+	Staple  probe.StapleInfo   `bson:"staple" json:"staple"`
+	Chain   []probe.ChainIssue `bson:"chain" json:"chain"`
+	// Error : empty if the probe succeeded
+	Error    string  `bson:"error,omitempty" json:"error,omitempty"`
+	Duration float64 `bson:"duration_seconds" json:"duration_seconds"`
+}
+
+// ProbeVantages : vantage points probing c, the first is primary and its results are stored on c
+func (c CertModel) ProbeVantages() []string {
+	if len(c.Vantages) == 0 {
+		return []string{CentralVantage}
+	}
+	return c.Vantages
+}
+
+// ProbedFrom : whether vantage probes c
+func (c CertModel) ProbedFrom(vantage string) bool {
+	for _, v := range c.ProbeVantages() {
+		if v == vantage {
+			return true
+		}
+	}
+	return false
+}
+
+// VantageDiscrepancy : how recent results from vantages differ, probe failures from some of them
+// or different leaf certs. Empty if they agree or fewer than two can be compared.
+func VantageDiscrepancy(vantages []string, results []VantageResultModel, now time.Time) string {
+	failed := []string{}
+	// 叶子证书序列号 -> 探测点
+	serials := map[string][]string{}
+	compared := 0
+	for _, v := range results {
+		if !containsString(vantages, v.Vantage) || now.Sub(v.Time) > VantageResultMaxAge {
+			continue
+		}
+		compared++
+		if v.Error != "" {
+			failed = append(failed, v.Vantage)
+			continue
+		}
+		serial := ""
+		if len(v.Certs) > 0 {
+			serial = v.Certs[0].SerialNumber
+		}
+		serials[serial] = append(serials[serial], v.Vantage)
+	}
+	if compared < 2 {
+		return ""
+	}
+
+	parts := []string{}
+	if len(failed) > 0 && len(serials) > 0 {
+		parts = append(parts, "probe failed from "+strings.Join(failed, ", "))
+	}
+	if len(serials) > 1 {
+		certs := []string{}
+		for serial, from := range serials {
+			certs = append(certs, fmt.Sprintf("serial %s from %s", serial, strings.Join(from, ", ")))
+		}
+		sort.Strings(certs)
+		parts = append(parts, "leaf cert differs: "+strings.Join(certs, " vs "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+)
+
+func TestVantageDiscrepancy(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	result := func(vantage, serial, err string, age time.Duration) VantageResultModel {
+		v := VantageResultModel{Vantage: vantage, Time: now.Add(-age), Error: err}
+		if serial != "" {
+			v.Certs = []probe.CertInfo{{SerialNumber: serial}}
+		}
+		return v
+	}
+	vantages := []string{CentralVantage, "idc-bj", "idc-sh"}
+
+	for _, tt := range []struct {
+		name    string
+		results []VantageResultModel
+		want    string
+	}{
+		{
+			name:    "agree",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour), result("idc-bj", "01", "", time.Hour)},
+		},
+		{
+			name:    "single result",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour)},
+		},
+		{
+			name:    "different leaf",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour), result("idc-bj", "02", "", time.Hour), result("idc-sh", "01", "", time.Hour)},
+			want:    "leaf cert differs: serial 01 from central, idc-sh vs serial 02 from idc-bj",
+		},
+		{
+			name:    "failed from some",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour), result("idc-bj", "", "i/o timeout", time.Hour)},
+			want:    "probe failed from idc-bj",
+		},
+		{
+			name: "failed and different",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour), result("idc-bj", "02", "", time.Hour),
+				result("idc-sh", "", "connection refused", time.Hour)},
+			want: "probe failed from idc-sh; leaf cert differs: serial 01 from central vs serial 02 from idc-bj",
+		},
+		{
+			// 所有探测点都失败时没有可比较的证书
+			name:    "failed everywhere",
+			results: []VantageResultModel{result(CentralVantage, "", "refused", time.Hour), result("idc-bj", "", "refused", time.Hour)},
+		},
+		{
+			name:    "stale result",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour), result("idc-bj", "02", "", VantageResultMaxAge+time.Hour)},
+		},
+		{
+			name:    "removed vantage",
+			results: []VantageResultModel{result(CentralVantage, "01", "", time.Hour), result("idc-gz", "02", "", time.Hour)},
+		},
+	} {
+		if got := VantageDiscrepancy(vantages, tt.results, now); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// silence documents, see schema.SilenceModel
+type (
+	SilenceState = schema.SilenceState
+	SilenceModel = schema.SilenceModel
+)
+
+const (
+	SilencePending = schema.SilencePending
+	SilenceActive  = schema.SilenceActive
+	SilenceExpired = schema.SilenceExpired
+)
+
+var (
+	silenceC = config.MongoSession.DB(config.MongoDatabase).C("silence")
+)
+
+var (
+	// SilencedBy : see schema.SilencedBy
+	SilencedBy = schema.SilencedBy
+	// ParseSilenceStates : see schema.ParseSilenceStates
+	ParseSilenceStates = schema.ParseSilenceStates
+)
+
+func init() {
+	silenceCIndex := []mgo.Index{
+		{
+			Key:        []string{"end", "start"},
+			Background: true,
+		},
+		{
+			Key:        []string{"host"},
+			Background: true,
+			Sparse:     true,
+		},
+	}
+
+	for _, v := range silenceCIndex {
+		err := silenceC.EnsureIndex(v)
+		if err != nil {
+			config.Logger.Error("EnsureIndex error", zap.Error(err))
+		}
+	}
+}
+
+func CreateSilence(s SilenceModel) (SilenceModel, error) {
+	s.ID = bson.NewObjectId()
+	s.AddTime = time.Now()
+	s.UpdateTime = time.Now()
+	err := silenceC.Insert(s)
+	return s, err
+}
+
+func GetSilenceByID(id bson.ObjectId) (SilenceModel, bool, error) {
+	s := SilenceModel{}
+	err := silenceC.FindId(id).One(&s)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return s, false, nil
+		}
+		return s, false, err
+	}
+	return s, true, nil
+}
+
+// GetSilenceList : silences of host in any of states at now, all silences if host or states are empty.
+// Newest first, at most MaxQueryLimit.
+func GetSilenceList(host string, states []SilenceState, now time.Time) ([]SilenceModel, error) {
+	silenceList := []SilenceModel{}
+	selector := schema.SilenceSelector(host, states, now)
+	err := silenceC.Find(selector).Sort("-start", "-_id").Limit(MaxQueryLimit).All(&silenceList)
+	return silenceList, err
+}
+
+// ExpireSilence : end silence id at now, returns false if it is not found or has already ended
+func ExpireSilence(id bson.ObjectId, by string, now time.Time) (bool, error) {
+	err := silenceC.Update(bson.M{"_id": id, "end": bson.M{"$gt": now}}, bson.M{
+		"$set": bson.M{
+			"end":         now,
+			"expired_by":  by,
+			"update_time": now,
+		},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package model
+
+import (
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+var (
+	teamC = config.MongoSession.DB(config.MongoDatabase).C("team")
+)
+
+// TeamModel, Rotation : see schema.TeamModel
+type (
+	TeamModel = schema.TeamModel
+	Rotation  = schema.Rotation
+)
+
+func init() {
+	teamCIndex := []mgo.Index{
+		{
+			Key:        []string{"name"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"members"},
+			Background: true,
+		},
+	}
+
+	for _, v := range teamCIndex {
+		err := teamC.EnsureIndex(v)
+		if err != nil {
+			config.Logger.Error("EnsureIndex error", zap.Error(err))
+		}
+	}
+}
+
+// CreateTeam : returns false if a team with the same name exists
+func CreateTeam(t TeamModel) (bool, error) {
+	t.ID = bson.NewObjectId()
+	t.AddTime = time.Now()
+	t.UpdateTime = time.Now()
+	if t.Members == nil {
+		t.Members = []string{}
+	}
+
+	err := teamC.Insert(t)
+	if err != nil {
+		if strings.Contains(err.Error(), "E11000 duplicate key error collection") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateTeam : replace members and rotation of the team named t.Name
+func UpdateTeam(t TeamModel) (bool, error) {
+	err := teamC.Update(bson.M{"name": t.Name}, bson.M{
+		"$set": bson.M{
+			"members":     RemoveDuplicateElement(t.Members),
+			"rotation":    t.Rotation,
+			"personal":    t.Personal,
+			"update_time": time.Now(),
+		},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func DeleteTeam(name string) (bool, error) {
+	err := teamC.Remove(bson.M{"name": name})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func GetTeamByName(name string) (TeamModel, bool, error) {
+	t := TeamModel{}
+	err := teamC.Find(bson.M{"name": name}).One(&t)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return t, false, nil
+		}
+		return t, false, err
+	}
+	return t, true, nil
+}
+
+// GetTeamList : all teams, or the teams user is a member of
+func GetTeamList(member string) ([]TeamModel, bool, error) {
+	teamList := []TeamModel{}
+	query := bson.M{}
+	if member != "" {
+		query["members"] = member
+	}
+	err := teamC.Find(query).Sort("name").All(&teamList)
+	if err != nil {
+		return teamList, false, err
+	}
+	return teamList, len(teamList) > 0, nil
+}
+
+// SetCertInfoTeam : assign host to team, empty team unassigns it
+func SetCertInfoTeam(host, team string) (bool, error) {
+	update := bson.M{"$set": bson.M{"team": team, "update_time": time.Now()}}
+	if team == "" {
+		update = bson.M{"$unset": bson.M{"team": ""}, "$set": bson.M{"update_time": time.Now()}}
+	}
+	err := certC.Update(bson.M{"host": host, "status": Online}, update)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CountCertInfoByTeam : number of online hosts assigned to team
+func CountCertInfoByTeam(team string) (int, error) {
+	return certC.Find(bson.M{"team": team, "status": Online}).Count()
+}
+
+// TeamMigration : result of MigratePersonalTeams
+type TeamMigration struct {
+	TeamsCreated  []string `json:"teams_created"`
+	HostsAssigned int      `json:"hosts_assigned"`
+}
+
+// MigratePersonalTeams : assign every host without a team to the personal team of its first user,
+// creating personal teams as needed. Other users stay subscribed. Hosts without users are left alone.
+// Assignments are recorded in the audit log as done by actor.
+func MigratePersonalTeams(dryRun bool, actor string) (TeamMigration, error) {
+	result := TeamMigration{TeamsCreated: []string{}}
+	certModelList := []CertModel{}
+	err := certC.Find(bson.M{"status": Online, "team": bson.M{"$in": []interface{}{"", nil}}}).Sort("add_time").All(&certModelList)
+	if err != nil {
+		return result, err
+	}
+
+	known := map[string]bool{}
+	for _, c := range certModelList {
+		if len(c.User) == 0 {
+			continue
+		}
+		owner := c.User[0]
+		if !known[owner] {
+			_, exists, err := GetTeamByName(owner)
+			if err != nil {
+				return result, err
+			}
+			if !exists {
+				if !dryRun {
+					if _, err := CreateTeam(TeamModel{Name: owner, Members: []string{owner}, Personal: true}); err != nil {
+						return result, err
+					}
+				}
+				result.TeamsCreated = append(result.TeamsCreated, owner)
+			}
+			known[owner] = true
+		}
+		if !dryRun {
+			if _, err := SetCertInfoTeam(c.Host, owner); err != nil {
+				return result, err
+			}
+			after := c
+			after.Team = owner
+			if _, err := InsertAudit(NewAudit(actor, AuditUpdate, c.Host, &c, &after)); err != nil {
+				config.Logger.Error("func InsertAudit err", zap.String("uid", actor), zap.String("host", c.Host), zap.Error(err))
+			}
+		}
+		result.HostsAssigned++
+	}
+	return result, nil
+}
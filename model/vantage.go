@@ -0,0 +1,103 @@
+package model
+
+import (
+	"git.ifengidc.com/likuo/go-check-certs/config"
+	"git.ifengidc.com/likuo/go-check-certs/model/schema"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// CentralVantage : vantage point of the service itself
+const CentralVantage = schema.CentralVantage
+
+var (
+	vantageC = config.MongoSession.DB(config.MongoDatabase).C("vantage_result")
+)
+
+// VantageResultModel : see schema.VantageResultModel
+type VantageResultModel = schema.VantageResultModel
+
+// VantageDiscrepancy : see schema.VantageDiscrepancy
+var VantageDiscrepancy = schema.VantageDiscrepancy
+
+func init() {
+	vantageCIndex := []mgo.Index{
+		{
+			Key:        []string{"host", "vantage"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"vantage"},
+			Background: true,
+		},
+	}
+
+	for _, v := range vantageCIndex {
+		err := vantageC.EnsureIndex(v)
+		if err != nil {
+			config.Logger.Error("EnsureIndex error", zap.Error(err))
+		}
+	}
+}
+
+// UpsertVantageResult : replace the last result of v.Host from v.Vantage
+func UpsertVantageResult(v VantageResultModel) error {
+	_, err := vantageC.Upsert(bson.M{"host": v.Host, "vantage": v.Vantage}, bson.M{
+		"$set": bson.M{
+			"port":             v.Port,
+			"time":             v.Time,
+			"certs":            v.Certs,
+			"staple":           v.Staple,
+			"chain":            v.Chain,
+			"error":            v.Error,
+			"duration_seconds": v.Duration,
+		},
+	})
+	return err
+}
+
+// GetVantageResults : last results of host from every vantage point, by vantage
+func GetVantageResults(host string) ([]VantageResultModel, error) {
+	resultList := []VantageResultModel{}
+	err := vantageC.Find(bson.M{"host": host}).Sort("vantage").All(&resultList)
+	return resultList, err
+}
+
+// SetCertInfoVantages : set vantage points of host, empty means CentralVantage only
+func SetCertInfoVantages(host string, vantages []string) (bool, error) {
+	update := bson.M{"$set": bson.M{"vantages": vantages, "update_time": time.Now()}}
+	if len(vantages) == 0 {
+		update = bson.M{"$unset": bson.M{"vantages": ""}, "$set": bson.M{"update_time": time.Now()}}
+	}
+	err := certC.Update(bson.M{"host": host, "status": Online}, update)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// SetCertInfoDiscrepancy : set how results of host differ between vantage points, empty clears it
+func SetCertInfoDiscrepancy(host, discrepancy string) error {
+	update := bson.M{"$set": bson.M{"discrepancy": discrepancy}}
+	if discrepancy == "" {
+		update = bson.M{"$unset": bson.M{"discrepancy": ""}}
+	}
+	err := certC.Update(bson.M{"host": host, "status": Online}, update)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// GetCertInfoListByVantage : online hosts probed from vantage other than CentralVantage
+func GetCertInfoListByVantage(vantage string) ([]CertModel, error) {
+	certModelList := []CertModel{}
+	err := certC.Find(bson.M{"status": Online, "vantages": vantage}).Sort("host").All(&certModelList)
+	return certModelList, err
+}
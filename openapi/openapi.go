@@ -0,0 +1,196 @@
+// Package openapi describes HTTP routes and generates the OpenAPI spec of them, see httpd.apiV1Routes.
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Route : a route and the description used for the OpenAPI spec
+type Route struct {
+	Method    string
+	Path      string
+	Handle    httprouter.Handle
+	Summary   string
+	Params    []Param
+	Body      interface{}
+	Responses []Response
+}
+
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+}
+
+type Response struct {
+	Status      int
+	Description string
+	Body        interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Spec : OpenAPI 3 document of routes, schemas are derived from the Go types by reflection
+func Spec(prefix string, routes []Route) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		path := prefix + specPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": strings.ToLower(route.Method) + operationName(route.Path),
+		}
+		params := []interface{}{}
+		for _, p := range route.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				"required":    p.Required || p.In == "path",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.Body), schemas)},
+				},
+			}
+		}
+		responses := map[string]interface{}{}
+		for _, resp := range route.Responses {
+			r := map[string]interface{}{"description": resp.Description}
+			if resp.Body != nil {
+				r["content"] = map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(resp.Body), schemas)},
+				}
+			}
+			responses[strconv.Itoa(resp.Status)] = r
+		}
+		op["responses"] = responses
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "go-check-certs",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// specPath : /hosts/:id to /hosts/{id}
+func specPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// operationName : /users/:uid/hosts to UsersByUidHosts
+func operationName(path string) string {
+	name := ""
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, ":") {
+			part = "by_" + part[1:]
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '_' || r == '.' }) {
+			name += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return name
+}
+
+// schemaOf : JSON schema of t, named structs are put in schemas and referenced
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[name]; !ok {
+			// 先占位，避免递归类型无限展开
+			schemas[name] = map[string]interface{}{}
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// 匿名嵌入的结构体展开字段，未导出的嵌入类型也会被 encoding/json 展开
+		if f.Anonymous && f.Tag.Get("json") == "" && f.Type.Kind() == reflect.Struct {
+			embedded := structSchema(f.Type, schemas)
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		properties[name] = schemaOf(f.Type, schemas)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// Register : register routes under prefix
+func Register(router *httprouter.Router, prefix string, routes []Route) {
+	for _, route := range routes {
+		router.Handle(route.Method, prefix+route.Path, route.Handle)
+	}
+}
@@ -0,0 +1,201 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type testHost struct {
+	base
+	Name     string            `json:"name"`
+	AddTime  time.Time         `json:"add_time"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Certs    []testCert        `json:"certs"`
+	Port     int
+	Parent   *testHost `json:"parent,omitempty"`
+	Secret   string    `json:"-"`
+	internal string
+}
+
+type testCert struct {
+	CommonName string  `json:"common_name"`
+	IsCA       bool    `json:"is_ca"`
+	Score      float64 `json:"score"`
+}
+
+type testError struct {
+	Error string `json:"error"`
+}
+
+func handle(body string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Write([]byte(body + ps.ByName("id")))
+	}
+}
+
+func testRoutes() []Route {
+	idParam := Param{Name: "id", In: "path", Description: "host id"}
+	notFound := Response{Status: http.StatusNotFound, Description: "host not found", Body: testError{}}
+	return []Route{
+		{
+			Method: "GET", Path: "/hosts", Handle: handle("list"), Summary: "List hosts",
+			Params:    []Param{{Name: "limit", In: "query", Description: "page size"}},
+			Responses: []Response{{Status: http.StatusOK, Description: "hosts", Body: []testHost{}}},
+		},
+		{
+			Method: "POST", Path: "/hosts", Handle: handle("create"), Summary: "Create a host", Body: testHost{},
+			Responses: []Response{{Status: http.StatusCreated, Description: "created", Body: &testHost{}}},
+		},
+		{
+			Method: "GET", Path: "/hosts/:id", Handle: handle("get "), Summary: "Get a host", Params: []Param{idParam},
+			Responses: []Response{{Status: http.StatusOK, Description: "the host", Body: testHost{}}, notFound},
+		},
+		{
+			Method: "DELETE", Path: "/users/:uid/hosts/:id", Handle: handle("unsubscribe "), Summary: "Unsubscribe",
+			Params:    []Param{{Name: "uid", In: "path"}, idParam},
+			Responses: []Response{{Status: http.StatusNoContent, Description: "unsubscribed"}, notFound},
+		},
+		{
+			Method: "GET", Path: "/openapi.json", Handle: handle("spec"), Summary: "This document",
+			Responses: []Response{{Status: http.StatusOK, Description: "OpenAPI 3 document"}},
+		},
+	}
+}
+
+// lookup : value at path of the spec as decoded from JSON
+func lookup(t *testing.T, doc interface{}, path ...string) interface{} {
+	t.Helper()
+	for i, key := range path {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%v is not an object", path[:i])
+		}
+		if doc, ok = m[key]; !ok {
+			t.Fatalf("%v not found", path[:i+1])
+		}
+	}
+	return doc
+}
+
+func TestSpec(t *testing.T) {
+	data, err := json.Marshal(Spec("/api/v1", testRoutes()))
+	if err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := lookup(t, doc, "openapi"); v != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", v)
+	}
+	paths := lookup(t, doc, "paths").(map[string]interface{})
+	for _, path := range []string{"/api/v1/hosts", "/api/v1/hosts/{id}", "/api/v1/users/{uid}/hosts/{id}", "/api/v1/openapi.json"} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("path %s missing from %v", path, reflect.ValueOf(paths).MapKeys())
+		}
+	}
+	if len(paths) != 4 {
+		t.Errorf("got %d paths, want 4", len(paths))
+	}
+
+	for _, tt := range []struct {
+		path, method, operationID string
+	}{
+		{path: "/api/v1/hosts", method: "get", operationID: "getHosts"},
+		{path: "/api/v1/hosts", method: "post", operationID: "postHosts"},
+		{path: "/api/v1/hosts/{id}", method: "get", operationID: "getHostsById"},
+		{path: "/api/v1/users/{uid}/hosts/{id}", method: "delete", operationID: "deleteUsersByUidHostsById"},
+		{path: "/api/v1/openapi.json", method: "get", operationID: "getOpenapiJson"},
+	} {
+		if v := lookup(t, doc, "paths", tt.path, tt.method, "operationId"); v != tt.operationID {
+			t.Errorf("%s %s operationId = %v, want %s", tt.method, tt.path, v, tt.operationID)
+		}
+	}
+
+	params := lookup(t, doc, "paths", "/api/v1/users/{uid}/hosts/{id}", "delete", "parameters").([]interface{})
+	for _, p := range params {
+		if p.(map[string]interface{})["required"] != true {
+			t.Errorf("path parameter %v is not required", p)
+		}
+	}
+	if v := lookup(t, doc, "paths", "/api/v1/hosts", "get", "parameters").([]interface{})[0].(map[string]interface{})["required"]; v != false {
+		t.Errorf("query parameter limit required = %v, want false", v)
+	}
+
+	responses := lookup(t, doc, "paths", "/api/v1/hosts/{id}", "get", "responses").(map[string]interface{})
+	if len(responses) != 2 {
+		t.Errorf("responses = %v, want 200 and 404", responses)
+	}
+	if v := lookup(t, doc, "paths", "/api/v1/hosts/{id}", "get", "responses", "404", "content", "application/json", "schema", "$ref"); v != "#/components/schemas/testError" {
+		t.Errorf("404 schema = %v, want a testError reference", v)
+	}
+	if _, ok := lookup(t, doc, "paths", "/api/v1/users/{uid}/hosts/{id}", "delete", "responses", "204").(map[string]interface{})["content"]; ok {
+		t.Error("204 response has content")
+	}
+	if v := lookup(t, doc, "paths", "/api/v1/hosts", "get", "responses", "200", "content", "application/json", "schema", "items", "$ref"); v != "#/components/schemas/testHost" {
+		t.Errorf("list schema items = %v, want a testHost reference", v)
+	}
+	if v := lookup(t, doc, "paths", "/api/v1/hosts", "post", "requestBody", "content", "application/json", "schema", "$ref"); v != "#/components/schemas/testHost" {
+		t.Errorf("request body schema = %v, want a testHost reference", v)
+	}
+}
+
+func TestSpecSchemas(t *testing.T) {
+	spec := Spec("", testRoutes())
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	if len(schemas) != 3 {
+		t.Errorf("schemas = %v, want testHost, testCert and testError", reflect.ValueOf(schemas).MapKeys())
+	}
+	host := schemas["testHost"].(map[string]interface{})["properties"].(map[string]interface{})
+	want := map[string]interface{}{
+		"id":       map[string]interface{}{"type": "string"},
+		"name":     map[string]interface{}{"type": "string"},
+		"add_time": map[string]interface{}{"type": "string", "format": "date-time"},
+		"labels":   map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+		"certs":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/testCert"}},
+		"Port":     map[string]interface{}{"type": "integer"},
+		"parent":   map[string]interface{}{"$ref": "#/components/schemas/testHost"},
+	}
+	if !reflect.DeepEqual(host, want) {
+		t.Errorf("testHost properties =\n%v\nwant\n%v", host, want)
+	}
+	cert := schemas["testCert"].(map[string]interface{})["properties"].(map[string]interface{})
+	if cert["is_ca"].(map[string]interface{})["type"] != "boolean" || cert["score"].(map[string]interface{})["type"] != "number" {
+		t.Errorf("testCert properties = %v", cert)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	router := httprouter.New()
+	Register(router, "/api/v1", testRoutes())
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{method: "GET", path: "/api/v1/hosts", status: http.StatusOK, body: "list"},
+		{method: "POST", path: "/api/v1/hosts", status: http.StatusOK, body: "create"},
+		{method: "GET", path: "/api/v1/hosts/h1", status: http.StatusOK, body: "get h1"},
+		{method: "DELETE", path: "/api/v1/users/likuo/hosts/h1", status: http.StatusOK, body: "unsubscribe h1"},
+		{method: "GET", path: "/hosts", status: http.StatusNotFound},
+		{method: "PUT", path: "/api/v1/hosts", status: http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
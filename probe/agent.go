@@ -0,0 +1,39 @@
+package probe
+
+import "time"
+
+// Target : host assigned to a probe agent
+type Target struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+}
+
+// Report : result of a Target pushed by a probe agent
+type Report struct {
+	Host   string       `json:"host"`
+	Port   string       `json:"port"`
+	Time   time.Time    `json:"time"`
+	Certs  []CertInfo   `json:"certs"`
+	Staple StapleInfo   `json:"staple"`
+	Chain  []ChainIssue `json:"chain"`
+	// Error : empty if the probe succeeded
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// NewReport : report of r finished at t
+func NewReport(r Result, t time.Time) Report {
+	report := Report{
+		Host:     r.Host,
+		Port:     r.Port,
+		Time:     t,
+		Certs:    r.Certs,
+		Staple:   r.Staple,
+		Chain:    r.Chain,
+		Duration: r.Duration.Seconds(),
+	}
+	if r.Err != nil {
+		report.Error = r.Err.Error()
+	}
+	return report
+}
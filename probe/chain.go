@@ -0,0 +1,173 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// 缺少中间证书时，是否通过 AIA (caIssuers) 下载中间证书补全证书链
+	chainAIAEnabled       = true
+	maxAIADepth           = 4
+	maxAIACertSize  int64 = 1 << 20
+
+	errNoAIAIssuer = errors.New("no usable aia ca issuers url")
+)
+
+// analyzeChain : analyze peer certificates in the order served by host, return chain issues and verified chains.
+// Missing intermediates are reported if AIA completion rebuilds the chain, otherwise the verify error is returned.
+func analyzeChain(ctx context.Context, host string, peers []*x509.Certificate, roots *x509.CertPool) ([]ChainIssue, [][]*x509.Certificate, error) {
+	issues := []ChainIssue{}
+	if len(peers) == 0 {
+		return issues, nil, errors.New("no peer certificates")
+	}
+
+	// 从叶子证书开始，在下发的证书中依次查找签发者，得到实际可用的路径
+	path := []int{0}
+	used := map[int]bool{0: true}
+	for {
+		cur := peers[path[len(path)-1]]
+		if IsSelfSigned(cur) {
+			break
+		}
+		next := -1
+		for i, cert := range peers {
+			if !used[i] && isIssuedBy(cur, cert) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		path = append(path, next)
+		used[next] = true
+	}
+
+	for i, idx := range path {
+		if idx != i {
+			served := make([]string, 0, len(peers))
+			for _, cert := range peers {
+				served = append(served, "'"+cert.Subject.CommonName+"'")
+			}
+			issues = append(issues, ChainIssue{
+				Type:       ChainWrongOrder,
+				CommonName: peers[idx].Subject.CommonName,
+				Message:    fmt.Sprintf("certs are not served in issuing order, served: %s", strings.Join(served, ", ")),
+			})
+			break
+		}
+	}
+
+	for i, cert := range peers {
+		if !used[i] {
+			issues = append(issues, ChainIssue{
+				Type:       ChainExtraCert,
+				CommonName: cert.Subject.CommonName,
+				Message:    fmt.Sprintf("cert at position %d is not part of the chain and can be removed", i),
+			})
+		}
+	}
+
+	for _, idx := range path[1:] {
+		if IsSelfSigned(peers[idx]) {
+			issues = append(issues, ChainIssue{
+				Type:       ChainServedRoot,
+				CommonName: peers[idx].Subject.CommonName,
+				Message:    "root cert is served by host, clients already have it in their trust store",
+			})
+		}
+	}
+
+	// 只使用路径上的证书做校验，缺少中间证书时通过 AIA 补全
+	intermediates := x509.NewCertPool()
+	for _, idx := range path[1:] {
+		intermediates.AddCert(peers[idx])
+	}
+	opts := x509.VerifyOptions{DNSName: host, Intermediates: intermediates, Roots: roots}
+	chains, err := peers[0].Verify(opts)
+	if err != nil {
+		if _, ok := err.(x509.UnknownAuthorityError); !ok {
+			return issues, nil, err
+		}
+		last := peers[path[len(path)-1]]
+		for depth := 0; chainAIAEnabled && depth < maxAIADepth; depth++ {
+			issuer, aiaErr := fetchAIAIssuer(ctx, last)
+			if aiaErr != nil {
+				break
+			}
+			intermediates.AddCert(issuer)
+			if chains, err = peers[0].Verify(opts); err == nil {
+				break
+			}
+			last = issuer
+		}
+		if err != nil {
+			// AIA 无法补全时无法区分缺少中间证书和不受信任的根证书，按校验失败处理
+			return issues, nil, err
+		}
+	}
+
+	// 证书链中未由服务端下发的中间证书 (通过 AIA 或系统缓存补全)
+	if len(chains) > 0 && len(chains[0]) > 2 {
+		for _, cert := range chains[0][1 : len(chains[0])-1] {
+			if !containsCert(peers, cert) {
+				issues = append(issues, ChainIssue{
+					Type:       ChainMissingIntermediate,
+					CommonName: cert.Subject.CommonName,
+					Message:    "intermediate cert is not served by host, clients without it cached will fail",
+				})
+			}
+		}
+	}
+	return issues, chains, nil
+}
+
+// fetchAIAIssuer : download issuer cert from aia ca issuers url
+func fetchAIAIssuer(ctx context.Context, cert *x509.Certificate) (*x509.Certificate, error) {
+	var lastErr error = errNoAIAIssuer
+	for _, url := range cert.IssuingCertificateURL {
+		body, err := fetchURL(ctx, "GET", url, "", nil, maxAIACertSize)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if block, _ := pem.Decode(body); block != nil {
+			body = block.Bytes
+		}
+		issuer, err := x509.ParseCertificate(body)
+		if err != nil {
+			lastErr = fmt.Errorf("aia %s: %v", url, err)
+			continue
+		}
+		if !isIssuedBy(cert, issuer) {
+			lastErr = fmt.Errorf("aia %s: cert '%s' is not the issuer", url, issuer.Subject.CommonName)
+			continue
+		}
+		return issuer, nil
+	}
+	return nil, lastErr
+}
+
+func isIssuedBy(cert, issuer *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+// IsSelfSigned : cert is issued and signed by itself
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnalyzeChainMissingIntermediate(t *testing.T) {
+	root := newTestCert(t, "Test Root", true, nil, nil)
+	inter := newTestCert(t, "Test Intermediate", true, root, nil)
+	aia := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inter.cert.Raw)
+	}))
+	defer aia.Close()
+	leaf := newTestCert(t, "www.example.com", false, inter, func(c *x509.Certificate) {
+		c.IssuingCertificateURL = []string{aia.URL + "/inter.cer"}
+	})
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	// 只下发叶子证书，通过 AIA 补全
+	issues, chains, err := analyzeChain(context.Background(), "www.example.com", []*x509.Certificate{leaf.cert}, roots)
+	if err != nil {
+		t.Fatalf("intermediate rebuilt by aia must be a finding, got err %v", err)
+	}
+	if len(issues) != 1 || issues[0].Type != ChainMissingIntermediate || issues[0].CommonName != "Test Intermediate" {
+		t.Fatalf("issues = %+v, want one %s", issues, ChainMissingIntermediate)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 {
+		t.Fatalf("chains = %v, want leaf, intermediate and root", chains)
+	}
+
+	// 下发完整证书链时没有问题
+	issues, chains, err = analyzeChain(context.Background(), "www.example.com", []*x509.Certificate{leaf.cert, inter.cert}, roots)
+	if err != nil || len(issues) != 0 || len(chains) == 0 {
+		t.Fatalf("full chain: issues = %+v, chains = %d, err = %v", issues, len(chains), err)
+	}
+}
+
+func TestAnalyzeChainUnverified(t *testing.T) {
+	root := newTestCert(t, "Test Root", true, nil, nil)
+	inter := newTestCert(t, "Test Intermediate", true, root, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	untrusted := newTestCert(t, "Untrusted Root", true, nil, nil)
+
+	for _, tt := range []struct {
+		name  string
+		peers []*x509.Certificate
+	}{
+		// 没有 AIA，无法补全
+		{name: "missing intermediate", peers: []*x509.Certificate{newTestCert(t, "www.example.com", false, inter, nil).cert}},
+		{name: "self-signed", peers: []*x509.Certificate{newTestCert(t, "www.example.com", false, nil, nil).cert}},
+		{name: "untrusted root", peers: []*x509.Certificate{newTestCert(t, "www.example.com", false, untrusted, nil).cert, untrusted.cert}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, chains, err := analyzeChain(context.Background(), "www.example.com", tt.peers, roots)
+			if err == nil {
+				t.Fatalf("issues = %+v, chains = %d, want the verify error", issues, len(chains))
+			}
+			for _, issue := range issues {
+				if issue.Type == ChainMissingIntermediate {
+					t.Errorf("issues = %+v, want no %s", issues, ChainMissingIntermediate)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeChainWrongHost(t *testing.T) {
+	root := newTestCert(t, "Test Root", true, nil, nil)
+	leaf := newTestCert(t, "www.example.com", false, root, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	if _, _, err := analyzeChain(context.Background(), "other.example.com", []*x509.Certificate{leaf.cert}, roots); err == nil {
+		t.Fatal("hostname mismatch must fail the probe")
+	}
+}
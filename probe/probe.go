@@ -0,0 +1,193 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/starttls"
+)
+
+const (
+	DefaultModule = "tls"
+	DefaultPort   = "443"
+)
+
+// Module : how to connect to a probe target
+type Module struct {
+	// Protocol : tls, or STARTTLS variant smtp|imap|pop3|ftp|postgres
+	Protocol string
+	Timeout  time.Duration
+	// RootCAs : PEM file of trust roots, empty means system roots
+	RootCAs string
+	// ServerName : SNI, empty means target host
+	ServerName string
+}
+
+// Modules : probe modules by name
+var Modules = map[string]Module{
+	"tls":               {Protocol: "tls", Timeout: 10 * time.Second},
+	"smtp_starttls":     {Protocol: "smtp", Timeout: 15 * time.Second},
+	"imap_starttls":     {Protocol: "imap", Timeout: 15 * time.Second},
+	"pop3_starttls":     {Protocol: "pop3", Timeout: 15 * time.Second},
+	"ftp_starttls":      {Protocol: "ftp", Timeout: 15 * time.Second},
+	"postgres_starttls": {Protocol: "postgres", Timeout: 15 * time.Second},
+}
+
+// Result : certs, staple and chain issues of host:port, Err is set if the probe failed
+type Result struct {
+	Host     string
+	Port     string
+	Certs    []CertInfo
+	Staple   StapleInfo
+	Chain    []ChainIssue
+	Err      error
+	Duration time.Duration
+}
+
+// Run : get cert info of host:port with probe module, canceling ctx aborts the probe
+func Run(ctx context.Context, host, port string, module Module) (result Result) {
+	result = Result{
+		Host:  host,
+		Port:  port,
+		Certs: []CertInfo{},
+	}
+	stime := time.Now()
+	defer func() {
+		result.Duration = time.Since(stime)
+	}()
+	serverName := module.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	roots, err := loadRootCAs(module.RootCAs)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	addr := net.JoinHostPort(host, port)
+	conn, err := dialTLS(ctx, addr, serverName, module, roots, false)
+	verified := err == nil
+	if err != nil {
+		var authErr x509.UnknownAuthorityError
+		if !errors.As(err, &authErr) {
+			result.Err = err
+			return
+		}
+		// 校验失败可能是服务端缺少中间证书，跳过校验重新握手后分析证书链
+		conn, err = dialTLS(ctx, addr, serverName, module, roots, true)
+		if err != nil {
+			result.Err = err
+			return
+		}
+	}
+	defer conn.Close()
+
+	timeNow := time.Now()
+	state := conn.ConnectionState()
+	chainIssues, chains, err := analyzeChain(ctx, serverName, state.PeerCertificates, roots)
+	result.Chain = chainIssues
+	if verified {
+		chains = state.VerifiedChains
+	} else if err != nil {
+		result.Err = err
+		return
+	}
+	result.Staple = getStapleInfo(state, chains)
+	checkedCerts := make(map[string]struct{})
+	for _, chain := range chains {
+		for certNum, cert := range chain {
+			if _, checked := checkedCerts[string(cert.Signature)]; checked {
+				continue
+			}
+			checkedCerts[string(cert.Signature)] = struct{}{}
+
+			// 过期时间
+			expiresHours := int64(cert.NotAfter.Sub(timeNow).Hours())
+
+			// 吊销状态，不检查根证书；stapled OCSP 响应只对应叶子证书
+			revocation := RevocationInfo{}
+			if certNum != len(chain)-1 {
+				var staple []byte
+				if certNum == 0 {
+					staple = state.OCSPResponse
+				}
+				revocation = checkRevocation(ctx, cert, chain[certNum+1], staple)
+			}
+
+			result.Certs = append(result.Certs, CertInfo{
+				CommonName:   cert.Subject.CommonName,
+				Issuer:       cert.Issuer.CommonName,
+				SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+				ExpireHours:  expiresHours,
+				IsCA:         cert.IsCA,
+				NotBefore:    cert.NotBefore,
+				NotAfter:     cert.NotAfter,
+				Revocation:   revocation,
+			})
+		}
+	}
+	return
+}
+
+// loadRootCAs : load trust roots from PEM file, nil means system roots
+func loadRootCAs(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// dialTLS : connect to addr, negotiate STARTTLS if needed and do tls handshake
+func dialTLS(ctx context.Context, addr, serverName string, module Module, roots *x509.CertPool, insecure bool) (*tls.Conn, error) {
+	dialer := net.Dialer{Timeout: module.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(module.Timeout))
+
+	// ctx 取消时立即让握手超时
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if err := starttls.Negotiate(conn, module.Protocol); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            roots,
+		InsecureSkipVerify: insecure,
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return tlsConn, nil
+}
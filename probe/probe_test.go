@@ -0,0 +1,55 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunCustomRootModule(t *testing.T) {
+	root := newTestCert(t, "Internal Root", true, nil, nil)
+	leaf := newTestCert(t, "gateway.internal", false, root, nil)
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}}}
+	server.StartTLS()
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCAs := filepath.Join(t.TempDir(), "internal-ca.pem")
+	if err := ioutil.WriteFile(rootCAs, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	module := Module{Protocol: "tls", Timeout: 5 * time.Second, RootCAs: rootCAs, ServerName: "gateway.internal"}
+
+	r := Run(context.Background(), host, port, module)
+	if r.Err != nil {
+		t.Fatalf("custom root module: %v", r.Err)
+	}
+	if len(r.Chain) != 0 {
+		t.Errorf("custom root module: chain issues %+v, want none", r.Chain)
+	}
+	if len(r.Certs) != 2 || r.Certs[0].CommonName != "gateway.internal" || r.Certs[1].CommonName != "Internal Root" {
+		t.Errorf("custom root module: certs %+v, want leaf and root", r.Certs)
+	}
+
+	// 系统根证书不信任内部 CA
+	module.RootCAs = ""
+	if r := Run(context.Background(), host, port, module); r.Err == nil {
+		t.Errorf("system roots: internal ca must fail the probe, got certs %+v and chain issues %+v", r.Certs, r.Chain)
+	}
+	// SNI 与证书不匹配
+	module.RootCAs, module.ServerName = rootCAs, "other.internal"
+	if r := Run(context.Background(), host, port, module); r.Err == nil {
+		t.Error("wrong server name: probe must fail")
+	}
+}
@@ -0,0 +1,244 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ocsp"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// RevocationOCSP, RevocationCRL : besides the stapled OCSP response, query the OCSP responder
+	// and the CRL distribution points of certs. Set before probing.
+	RevocationOCSP = true
+	RevocationCRL  = true
+
+	// 无 nextUpdate 时的缓存时长
+	revocationCacheTTL = 6 * time.Hour
+	fetchClient        = &http.Client{Timeout: 10 * time.Second}
+
+	// ocsp 响应与 crl 的最大读取长度
+	maxOCSPResponseSize int64 = 1 << 20
+	maxCRLSize          int64 = 32 << 20
+
+	revocationResults = &revocationCache{items: map[string]revocationCacheItem{}}
+
+	errNoRevocationSource = errors.New("no ocsp server or crl distribution point")
+)
+
+const (
+	revocationSourceStaple = "staple"
+	revocationSourceOCSP   = "ocsp"
+	revocationSourceCRL    = "crl"
+)
+
+type revocationCacheItem struct {
+	info     RevocationInfo
+	expireAt time.Time
+}
+
+// revocationCache : cache revocation result by issuer and serial number until next update
+type revocationCache struct {
+	sync.Mutex
+	items map[string]revocationCacheItem
+}
+
+func (c *revocationCache) get(key string) (RevocationInfo, bool) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		return RevocationInfo{}, false
+	}
+	if time.Now().After(item.expireAt) {
+		delete(c.items, key)
+		return RevocationInfo{}, false
+	}
+	return item.info, true
+}
+
+func (c *revocationCache) set(key string, info RevocationInfo, nextUpdate time.Time) {
+	expireAt := time.Now().Add(revocationCacheTTL)
+	if !nextUpdate.IsZero() && nextUpdate.Before(expireAt) {
+		expireAt = nextUpdate
+	}
+	c.Lock()
+	c.items[key] = revocationCacheItem{info: info, expireAt: expireAt}
+	c.Unlock()
+}
+
+func revocationCacheKey(cert, issuer *x509.Certificate) string {
+	issuerHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return fmt.Sprintf("%x:%X", issuerHash, cert.SerialNumber)
+}
+
+// checkRevocation : check cert revocation status, stapled ocsp response first, then ocsp responder and crl
+func checkRevocation(ctx context.Context, cert, issuer *x509.Certificate, staple []byte) RevocationInfo {
+	if len(staple) > 0 {
+		resp, err := ocsp.ParseResponseForCert(staple, cert, issuer)
+		if err == nil && staleErr(resp.Status == ocsp.Good, resp.NextUpdate, time.Now()) == nil {
+			return ocspToRevocationInfo(resp, revocationSourceStaple)
+		}
+		// stapled 响应无效或已过期时继续主动查询
+	}
+
+	key := revocationCacheKey(cert, issuer)
+	if info, ok := revocationResults.get(key); ok {
+		return info
+	}
+
+	errs := []string{}
+	if RevocationOCSP && len(cert.OCSPServer) > 0 {
+		info, nextUpdate, err := queryOCSP(ctx, cert, issuer)
+		if err == nil {
+			revocationResults.set(key, info, nextUpdate)
+			return info
+		}
+		errs = append(errs, err.Error())
+	}
+
+	if RevocationCRL && len(cert.CRLDistributionPoints) > 0 {
+		info, nextUpdate, err := queryCRL(ctx, cert, issuer)
+		if err == nil {
+			revocationResults.set(key, info, nextUpdate)
+			return info
+		}
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, errNoRevocationSource.Error())
+	}
+	return RevocationInfo{
+		Status:    RevocationUnknown,
+		CheckedAt: time.Now(),
+		Error:     strings.Join(errs, "; "),
+	}
+}
+
+// queryOCSP : request cert status from the ocsp responders in cert
+func queryOCSP(ctx context.Context, cert, issuer *x509.Certificate) (RevocationInfo, time.Time, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return RevocationInfo{}, time.Time{}, err
+	}
+
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		body, err := fetchURL(ctx, "POST", server, "application/ocsp-request", req, maxOCSPResponseSize)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+		if err == nil {
+			err = staleErr(resp.Status == ocsp.Good, resp.NextUpdate, time.Now())
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("ocsp %s: %v", server, err)
+			continue
+		}
+		return ocspToRevocationInfo(resp, revocationSourceOCSP), resp.NextUpdate, nil
+	}
+	return RevocationInfo{}, time.Time{}, lastErr
+}
+
+// queryCRL : download crl from cert distribution points and look up cert serial number
+func queryCRL(ctx context.Context, cert, issuer *x509.Certificate) (RevocationInfo, time.Time, error) {
+	var lastErr error = errNoRevocationSource
+	for _, url := range cert.CRLDistributionPoints {
+		// ldap 等分发点不支持
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		body, err := fetchURL(ctx, "GET", url, "", nil, maxCRLSize)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		crl, err := x509.ParseCRL(body)
+		if err != nil {
+			lastErr = fmt.Errorf("crl %s: %v", url, err)
+			continue
+		}
+		if err := issuer.CheckCRLSignature(crl); err != nil {
+			lastErr = fmt.Errorf("crl %s: %v", url, err)
+			continue
+		}
+
+		info := RevocationInfo{
+			Status:    RevocationGood,
+			Source:    revocationSourceCRL,
+			CheckedAt: time.Now(),
+		}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				info.Status = RevocationRevoked
+				info.RevokedAt = revoked.RevocationTime
+				break
+			}
+		}
+		if err := staleErr(info.Status == RevocationGood, crl.TBSCertList.NextUpdate, time.Now()); err != nil {
+			lastErr = fmt.Errorf("crl %s: %v", url, err)
+			continue
+		}
+		return info, crl.TBSCertList.NextUpdate, nil
+	}
+	return RevocationInfo{}, time.Time{}, lastErr
+}
+
+// fetchURL : fetch ocsp, crl or aia url with size limit, canceled with ctx
+func fetchURL(ctx context.Context, method, url, contentType string, data []byte, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s code: %d", method, url, res.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(res.Body, limit))
+}
+
+// staleErr : error if a good status is past its next update, a revoked cert stays revoked
+func staleErr(good bool, nextUpdate, now time.Time) error {
+	if good && !nextUpdate.IsZero() && now.After(nextUpdate) {
+		return fmt.Errorf("response is stale, next update was %s", nextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func ocspToRevocationInfo(resp *ocsp.Response, source string) RevocationInfo {
+	info := RevocationInfo{
+		Source:    source,
+		CheckedAt: time.Now(),
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		info.Status = RevocationGood
+	case ocsp.Revoked:
+		info.Status = RevocationRevoked
+		info.RevokedAt = resp.RevokedAt
+		info.Reason = resp.RevocationReason
+	default:
+		info.Status = RevocationUnknown
+	}
+	return info
+}
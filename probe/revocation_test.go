@@ -0,0 +1,205 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// fakeResponder : OCSP responder and CRL distribution point of issuer
+type fakeResponder struct {
+	issuer *testCert
+	sync.Mutex
+	// status, nextUpdate : OCSP response by serial number
+	status     map[int64]int
+	nextUpdate map[int64]time.Time
+	// revoked, crlNextUpdate : content of the CRL
+	revoked       []pkix.RevokedCertificate
+	crlNextUpdate time.Time
+	hits          int
+}
+
+func (f *fakeResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.hits++
+	now := time.Now()
+	if r.URL.Path == "/crl" {
+		der, err := f.issuer.cert.CreateCRL(rand.Reader, f.issuer.key, f.revoked, now.Add(-time.Hour), f.crlNextUpdate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(der)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serial := req.SerialNumber.Int64()
+	tmpl := ocsp.Response{
+		Status:       f.status[serial],
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now.Add(-2 * time.Hour),
+		NextUpdate:   f.nextUpdate[serial],
+	}
+	if tmpl.Status == ocsp.Revoked {
+		tmpl.RevokedAt = now.Add(-time.Hour)
+		tmpl.RevocationReason = ocsp.KeyCompromise
+	}
+	resp, err := ocsp.CreateResponse(f.issuer.cert, f.issuer.cert, tmpl, f.issuer.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+func (f *fakeResponder) hitCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.hits
+}
+
+// newFakeResponder : issuer CA and a running responder for its certs
+func newFakeResponder(t *testing.T) (*fakeResponder, *httptest.Server) {
+	f := &fakeResponder{
+		issuer:        newTestCert(t, "Test CA", true, nil, nil),
+		status:        map[int64]int{},
+		nextUpdate:    map[int64]time.Time{},
+		crlNextUpdate: time.Now().Add(24 * time.Hour),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// leafWith : leaf of f.issuer with ocsp status and next update, checked against the responder
+func (f *fakeResponder) leafWith(t *testing.T, server *httptest.Server, status int, nextUpdate time.Time) *testCert {
+	leaf := newTestCert(t, "www.example.com", false, f.issuer, func(c *x509.Certificate) {
+		c.OCSPServer = []string{server.URL + "/ocsp"}
+		c.CRLDistributionPoints = []string{server.URL + "/crl"}
+	})
+	f.Lock()
+	f.status[leaf.cert.SerialNumber.Int64()] = status
+	f.nextUpdate[leaf.cert.SerialNumber.Int64()] = nextUpdate
+	f.Unlock()
+	return leaf
+}
+
+func TestCheckRevocationOCSP(t *testing.T) {
+	f, server := newFakeResponder(t)
+	later, earlier := time.Now().Add(24*time.Hour), time.Now().Add(-time.Hour)
+	for _, tt := range []struct {
+		name       string
+		status     int
+		nextUpdate time.Time
+		want       RevocationStatus
+		wantSource string
+	}{
+		{name: "good", status: ocsp.Good, nextUpdate: later, want: RevocationGood, wantSource: revocationSourceOCSP},
+		{name: "revoked", status: ocsp.Revoked, nextUpdate: later, want: RevocationRevoked, wantSource: revocationSourceOCSP},
+		// 过期的 good 响应不采用，继续查询 CRL
+		{name: "stale good", status: ocsp.Good, nextUpdate: earlier, want: RevocationGood, wantSource: revocationSourceCRL},
+		{name: "stale revoked", status: ocsp.Revoked, nextUpdate: earlier, want: RevocationRevoked, wantSource: revocationSourceOCSP},
+	} {
+		leaf := f.leafWith(t, server, tt.status, tt.nextUpdate)
+		info := checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil)
+		if info.Status != tt.want || info.Source != tt.wantSource {
+			t.Errorf("%s: got %s from %s (%s), want %s from %s", tt.name, info.Status, info.Source, info.Error, tt.want, tt.wantSource)
+		}
+	}
+}
+
+func TestCheckRevocationStale(t *testing.T) {
+	f, server := newFakeResponder(t)
+	f.crlNextUpdate = time.Now().Add(-time.Hour)
+	leaf := f.leafWith(t, server, ocsp.Good, time.Now().Add(-time.Hour))
+
+	info := checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil)
+	if info.Status != RevocationUnknown || !strings.Contains(info.Error, "stale") {
+		t.Errorf("stale ocsp and crl: got %s (%s), want unknown and stale", info.Status, info.Error)
+	}
+
+	// 过期的 stapled 响应不采用，转而查询 responder
+	staple, err := ocsp.CreateResponse(f.issuer.cert, f.issuer.cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-2 * time.Hour),
+		NextUpdate:   time.Now().Add(-time.Hour),
+	}, f.issuer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = checkRevocation(context.Background(), leaf.cert, f.issuer.cert, staple)
+	if info.Status != RevocationUnknown || info.Source == revocationSourceStaple {
+		t.Errorf("stale staple: got %s from %s, want unknown", info.Status, info.Source)
+	}
+}
+
+func TestCheckRevocationCRL(t *testing.T) {
+	defer func(enabled bool) { RevocationOCSP = enabled }(RevocationOCSP)
+	RevocationOCSP = false
+
+	f, server := newFakeResponder(t)
+	leaf := f.leafWith(t, server, ocsp.Good, time.Now().Add(time.Hour))
+	revoked := f.leafWith(t, server, ocsp.Good, time.Now().Add(time.Hour))
+	f.revoked = []pkix.RevokedCertificate{{SerialNumber: revoked.cert.SerialNumber, RevocationTime: time.Now().Add(-time.Hour)}}
+
+	if info := checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil); info.Status != RevocationGood || info.Source != revocationSourceCRL {
+		t.Errorf("crl good: got %s from %s (%s)", info.Status, info.Source, info.Error)
+	}
+	if info := checkRevocation(context.Background(), revoked.cert, f.issuer.cert, nil); info.Status != RevocationRevoked || info.Source != revocationSourceCRL {
+		t.Errorf("crl revoked: got %s from %s (%s)", info.Status, info.Source, info.Error)
+	}
+}
+
+func TestCheckRevocationCache(t *testing.T) {
+	f, server := newFakeResponder(t)
+	leaf := f.leafWith(t, server, ocsp.Good, time.Now().Add(time.Hour))
+
+	first := checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil)
+	hits := f.hitCount()
+	second := checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil)
+	if first.Status != RevocationGood || second != first {
+		t.Errorf("cached result: got %+v, want %+v", second, first)
+	}
+	if f.hitCount() != hits {
+		t.Errorf("cached result: responder queried again")
+	}
+
+	// 缓存到 nextUpdate 为止
+	revocationResults.set(revocationCacheKey(leaf.cert, f.issuer.cert), first, time.Now().Add(-time.Second))
+	checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil)
+	if f.hitCount() == hits {
+		t.Errorf("expired cache: responder not queried")
+	}
+}
+
+func TestCheckRevocationDisabled(t *testing.T) {
+	defer func(ocspEnabled, crlEnabled bool) { RevocationOCSP, RevocationCRL = ocspEnabled, crlEnabled }(RevocationOCSP, RevocationCRL)
+	RevocationOCSP, RevocationCRL = false, false
+
+	f, server := newFakeResponder(t)
+	leaf := f.leafWith(t, server, ocsp.Revoked, time.Now().Add(time.Hour))
+	if info := checkRevocation(context.Background(), leaf.cert, f.issuer.cert, nil); info.Status != RevocationUnknown {
+		t.Errorf("disabled: got %s, want unknown", info.Status)
+	}
+	if f.hitCount() != 0 {
+		t.Errorf("disabled: responder queried %d times", f.hitCount())
+	}
+}
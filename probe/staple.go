@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	// oidTLSFeature : tls feature extension (RFC 7633), must-staple 时包含 status_request(5)
+	oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+)
+
+const tlsFeatureStatusRequest = 5
+
+// getStapleInfo : get stapled ocsp response info of leaf cert from tls connection state
+func getStapleInfo(state tls.ConnectionState, chains [][]*x509.Certificate) StapleInfo {
+	info := StapleInfo{}
+	if len(state.PeerCertificates) == 0 {
+		return info
+	}
+	leaf := state.PeerCertificates[0]
+	info.MustStaple = isMustStaple(leaf)
+	info.Provided = len(state.OCSPResponse) > 0
+	if !info.Provided {
+		return info
+	}
+
+	var issuer *x509.Certificate
+	if len(chains) > 0 && len(chains[0]) > 1 {
+		issuer = chains[0][1]
+	}
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+	if err != nil {
+		info.Status = RevocationUnknown
+		info.Error = err.Error()
+		return info
+	}
+	info.Status = ocspToRevocationInfo(resp, revocationSourceStaple).Status
+	info.ThisUpdate = resp.ThisUpdate
+	info.NextUpdate = resp.NextUpdate
+	return info
+}
+
+// isMustStaple : check if cert carries tls feature extension with status_request
+func isMustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
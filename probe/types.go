@@ -0,0 +1,59 @@
+package probe
+
+import "time"
+
+type CertInfo struct {
+	CommonName   string         `bson:"common_name" json:"common_name"`
+	Issuer       string         `bson:"issuer" json:"issuer"`
+	SerialNumber string         `bson:"serial_number" json:"serial_number"`
+	ExpireHours  int64          `bson:"expire_hours" json:"expire_hours"`
+	IsCA         bool           `bson:"is_ca" json:"is_ca"`
+	NotBefore    time.Time      `bson:"not_before" json:"not_before"`
+	NotAfter     time.Time      `bson:"not_after" json:"not_after"`
+	Revocation   RevocationInfo `bson:"revocation" json:"revocation"`
+}
+
+type ChainIssueType string
+
+const (
+	ChainMissingIntermediate ChainIssueType = "missing_intermediate"
+	ChainExtraCert           ChainIssueType = "extra_cert"
+	ChainWrongOrder          ChainIssueType = "wrong_order"
+	ChainServedRoot          ChainIssueType = "served_root"
+)
+
+// ChainIssue : finding of the cert chain as served by host
+type ChainIssue struct {
+	Type       ChainIssueType `bson:"type" json:"type"`
+	CommonName string         `bson:"common_name" json:"common_name"`
+	Message    string         `bson:"message" json:"message"`
+}
+
+// StapleInfo : stapled ocsp response served in tls handshake for leaf cert
+type StapleInfo struct {
+	Provided   bool             `bson:"provided" json:"provided"`
+	MustStaple bool             `bson:"must_staple" json:"must_staple"`
+	Status     RevocationStatus `bson:"status" json:"status"`
+	ThisUpdate time.Time        `bson:"this_update,omitempty" json:"this_update,omitempty"`
+	NextUpdate time.Time        `bson:"next_update,omitempty" json:"next_update,omitempty"`
+	Error      string           `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+type RevocationStatus string
+
+const (
+	RevocationUnchecked RevocationStatus = ""
+	RevocationGood      RevocationStatus = "good"
+	RevocationRevoked   RevocationStatus = "revoked"
+	RevocationUnknown   RevocationStatus = "unknown"
+)
+
+// RevocationInfo : cert revocation status from stapled ocsp, ocsp responder or crl
+type RevocationInfo struct {
+	Status    RevocationStatus `bson:"status" json:"status"`
+	Source    string           `bson:"source" json:"source"`
+	RevokedAt time.Time        `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	Reason    int              `bson:"reason,omitempty" json:"reason,omitempty"`
+	CheckedAt time.Time        `bson:"checked_at" json:"checked_at"`
+	Error     string           `bson:"error,omitempty" json:"error,omitempty"`
+}
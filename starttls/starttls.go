@@ -0,0 +1,94 @@
+package starttls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+var (
+	// ErrRefused : server did not accept the STARTTLS command
+	ErrRefused = errors.New("starttls refused by server")
+)
+
+// Negotiate : upgrade plain text protocol connection so that a tls handshake can follow.
+// protocol is one of tls (nothing to do), smtp, imap, pop3, ftp or postgres.
+func Negotiate(conn net.Conn, protocol string) error {
+	tp := textproto.NewConn(conn)
+	switch protocol {
+	case "", "tls":
+		return nil
+	case "smtp":
+		if _, _, err := tp.ReadResponse(220); err != nil {
+			return err
+		}
+		if err := tp.PrintfLine("EHLO go-check-certs"); err != nil {
+			return err
+		}
+		if _, _, err := tp.ReadResponse(250); err != nil {
+			return err
+		}
+		if err := tp.PrintfLine("STARTTLS"); err != nil {
+			return err
+		}
+		_, _, err := tp.ReadResponse(220)
+		return err
+	case "ftp":
+		if _, _, err := tp.ReadResponse(220); err != nil {
+			return err
+		}
+		if err := tp.PrintfLine("AUTH TLS"); err != nil {
+			return err
+		}
+		_, _, err := tp.ReadResponse(234)
+		return err
+	case "imap":
+		if err := expectLinePrefix(tp, "* OK"); err != nil {
+			return err
+		}
+		if err := tp.PrintfLine("a001 STARTTLS"); err != nil {
+			return err
+		}
+		return expectLinePrefix(tp, "a001 OK")
+	case "pop3":
+		if err := expectLinePrefix(tp, "+OK"); err != nil {
+			return err
+		}
+		if err := tp.PrintfLine("STLS"); err != nil {
+			return err
+		}
+		return expectLinePrefix(tp, "+OK")
+	case "postgres":
+		// SSLRequest: length 8, code 80877103
+		req := make([]byte, 8)
+		binary.BigEndian.PutUint32(req[0:4], 8)
+		binary.BigEndian.PutUint32(req[4:8], 80877103)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		resp := make([]byte, 1)
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return err
+		}
+		if resp[0] != 'S' {
+			return ErrRefused
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported protocol %q", protocol)
+}
+
+func expectLinePrefix(tp *textproto.Conn, prefix string) error {
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("%w: %s", ErrRefused, line)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package message
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,27 +24,29 @@ var (
 // Init : init
 func Init() {
 	client = NewMessageClient("v1", config.MessageAppID, config.MessageAppKey)
+	setting.SetAddress(config.MessageAddress)
 	err := client.InitConnection()
 	if err != nil {
 		panic(err)
 	}
 }
 
-// Wechat : message wechat
-func Wechat(uid, title, content, url string) {
+// Wechat : message wechat, canceled with ctx
+func Wechat(ctx context.Context, uid, title, content, url string) error {
 	uuid := time.Now().UnixNano()
 	config.Logger.Info("prepare to send wechat work", zap.String("uid", uid), zap.String("title", title), zap.String("content", content), zap.String("url", url), zap.Int64("uuid", uuid))
-	res, err := client.PostWechat(uid, title, content, url)
+	res, err := client.PostWechat(ctx, uid, title, content, url)
 	if err != nil {
 		config.Logger.Error("PostWechat err", zap.Int64("uuid", uuid), zap.Error(err))
-		return
+		return err
 	}
 	if res.Code != 200 {
 		config.Logger.Error("PostWechat failed", zap.Int64("uuid", uuid), zap.Any("response", res))
 		fmt.Println(uid, title, content, url)
-		return
+		return fmt.Errorf("post wechat failed: code: %d msg: %s", res.Code, res.Msg)
 	}
 	config.Logger.Info("PostWechat succ", zap.Int64("uuid", uuid))
+	return nil
 }
 
 // Service : for message client
@@ -174,11 +177,11 @@ func (s *Service) GetLimit() (LimitResponse, error) {
 type PostWechatResponse response
 
 // PostWechat : post wechat message
-func (s *Service) PostWechat(account, title, content, url string) (PostWechatResponse, error) {
+func (s *Service) PostWechat(ctx context.Context, account, title, content, url string) (PostWechatResponse, error) {
 	postWechatResponse := PostWechatResponse{}
 	b := netURL.Values{"account": {account}, "title": {title}, "content": {content}, "url": {url}}
 
-	res, err := s.post(setting.MessagePostWechatURL, b.Encode())
+	res, err := s.postContext(ctx, setting.MessagePostWechatURL, b.Encode())
 	if err != nil {
 		return postWechatResponse, err
 	}
@@ -310,9 +313,13 @@ func (s *Service) GetIVRQuery(callID string) (GetIVRQueryResponse, error) {
 
 // post : for post request
 func (s *Service) post(url, data string) ([]byte, error) {
+	return s.postContext(context.Background(), url, data)
+}
+
+func (s *Service) postContext(ctx context.Context, url, data string) ([]byte, error) {
 	body := strings.NewReader(data)
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
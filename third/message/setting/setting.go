@@ -1,5 +1,7 @@
 package setting
 
+import "strings"
+
 var (
 	// MessageAddress : message address
 	MessageAddress = "https://message.ifengidc.com"
@@ -22,16 +24,21 @@ var (
 // ModelDebug : if true, change setting value
 func ModelDebug(debug bool, debugAddress string) {
 	if debug {
-		MessageAddress = "http://localhost:9990"
-		if debugAddress != "" {
-			MessageAddress = debugAddress
+		if debugAddress == "" {
+			debugAddress = "http://localhost:9990"
 		}
-		MessageJWTURL = MessageAddress + "/api/v1/jwt"
-		MessageLimitURL = MessageAddress + "/api/v1/limit"
-		MessagePostWechatURL = MessageAddress + "/api/v1/wechat"
-		MessagePostMailURL = MessageAddress + "/api/v1/mail"
-		MessagePostSMSURL = MessageAddress + "/api/v1/sms"
-		MessagePostIVRURL = MessageAddress + "/api/v1/ivr?mobile=%s&ttscode=%s"
-		MessageGetIVRQueryURL = MessageAddress + "/api/v1/ivr?callid=%s"
+		SetAddress(debugAddress)
 	}
 }
+
+// SetAddress : change the message address and the urls under it
+func SetAddress(address string) {
+	MessageAddress = strings.TrimRight(address, "/")
+	MessageJWTURL = MessageAddress + "/api/v1/jwt"
+	MessageLimitURL = MessageAddress + "/api/v1/limit"
+	MessagePostWechatURL = MessageAddress + "/api/v1/wechat"
+	MessagePostMailURL = MessageAddress + "/api/v1/mail"
+	MessagePostSMSURL = MessageAddress + "/api/v1/sms"
+	MessagePostIVRURL = MessageAddress + "/api/v1/ivr?mobile=%s&ttscode=%s"
+	MessageGetIVRQueryURL = MessageAddress + "/api/v1/ivr?callid=%s"
+}
@@ -7,13 +7,18 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+	"git.ifengidc.com/likuo/go-check-certs/starttls"
 )
 
 const defaultConcurrency = 8
@@ -24,66 +29,118 @@ const (
 	errSunsetAlg       = "%s: '%s' (S/N %X) expires after the sunset date for its signature algorithm '%s'."
 )
 
-type sigAlgSunset struct {
-	name      string    // Human readable name of signature algorithm
-	sunsetsAt time.Time // Time the algorithm will be sunset
-}
+var (
+	hostsFile    = flag.String("hosts", "", "The path to the file containing a list of hosts to check, or - to read it from stdin.")
+	warnYears    = flag.Int("years", 0, "Warn if the certificate will expire within this many years.")
+	warnMonths   = flag.Int("months", 0, "Warn if the certificate will expire within this many months.")
+	warnDays     = flag.Int("days", 0, "Warn if the certificate will expire within this many days.")
+	warnThresh   = flag.Int("warn", 0, "Exit WARNING if a certificate will expire within this many days. Overrides -years, -months and -days.")
+	critThresh   = flag.Int("crit", 7, "Exit CRITICAL if a certificate will expire within this many days.")
+	checkSigAlg  = flag.Bool("check-sig-alg", true, "Verify that non-root certificates are using a good signature algorithm.")
+	concurrency  = flag.Int("concurrency", defaultConcurrency, "Maximum number of hosts to check at once.")
+	timeout      = flag.Duration("timeout", 10*time.Second, "Timeout for connecting to and handshaking with each host.")
+	certFiles    = flag.String("files", "", "Comma separated list of certificate files or directories (PEM, DER, PKCS#12, JKS) to check.")
+	filePassword = flag.String("password", "", "The password for PKCS#12 files and Java keystores.")
+	outputFormat = flag.String("output", "text", "Output format: text, json, ndjson, csv, junit-xml (or junit) or nagios.")
+)
 
-// sunsetSigAlgs is an algorithm to string mapping for signature algorithms
-// which have been or are being deprecated.  See the following links to learn
-// more about SHA1's inclusion on this list.
-//
-// - https://technet.microsoft.com/en-us/library/security/2880823.aspx
-// - http://googleonlinesecurity.blogspot.com/2014/09/gradually-sunsetting-sha-1.html
-var sunsetSigAlgs = map[x509.SignatureAlgorithm]sigAlgSunset{
-	x509.MD2WithRSA: sigAlgSunset{
-		name:      "MD2 with RSA",
-		sunsetsAt: time.Now(),
-	},
-	x509.MD5WithRSA: sigAlgSunset{
-		name:      "MD5 with RSA",
-		sunsetsAt: time.Now(),
-	},
-	x509.SHA1WithRSA: sigAlgSunset{
-		name:      "SHA1 with RSA",
-		sunsetsAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
-	},
-	x509.DSAWithSHA1: sigAlgSunset{
-		name:      "DSA with SHA1",
-		sunsetsAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
-	},
-	x509.ECDSAWithSHA1: sigAlgSunset{
-		name:      "ECDSA with SHA1",
-		sunsetsAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
-	},
-}
+// Nagios/Icinga plugin exit codes.
+const (
+	statusOK = iota
+	statusWarning
+	statusCritical
+	statusUnknown
+)
 
-var (
-	hostsFile   = flag.String("hosts", "", "The path to the file containing a list of hosts to check.")
-	warnYears   = flag.Int("years", 0, "Warn if the certificate will expire within this many years.")
-	warnMonths  = flag.Int("months", 0, "Warn if the certificate will expire within this many months.")
-	warnDays    = flag.Int("days", 0, "Warn if the certificate will expire within this many days.")
-	checkSigAlg = flag.Bool("check-sig-alg", true, "Verify that non-root certificates are using a good signature algorithm.")
-	concurrency = flag.Int("concurrency", defaultConcurrency, "Maximum number of hosts to check at once.")
+var statusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+const (
+	findingExpiringShortly = "expiring_shortly"
+	findingExpiringSoon    = "expiring_soon"
+	findingSunsetAlg       = "sunset_sig_alg"
 )
 
-type certErrors struct {
-	commonName string
-	errs       []error
+type finding struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	status   int
+}
+
+func newFinding(kind string, status int, message string) finding {
+	return finding{Kind: kind, Severity: statusNames[status], Message: message, status: status}
+}
+
+type certResult struct {
+	CommonName  string    `json:"common_name"`
+	Serial      string    `json:"serial"`
+	IsCA        bool      `json:"is_ca"`
+	NotAfter    time.Time `json:"not_after"`
+	ExpireHours int64     `json:"expire_hours"`
+	KeyFile     string    `json:"key_file,omitempty"`
+	Findings    []finding `json:"findings"`
 }
 
+// hostResult is the result for a host, or for a file when checking files.
 type hostResult struct {
-	host  string
-	err   error
-	certs []certErrors
+	Host     string       `json:"host"`
+	Status   string       `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Certs    []certResult `json:"certs"`
+	Findings []finding    `json:"findings,omitempty"`
+	err      error
+	status   int
+}
+
+// setStatus sets the host status to its worst finding. Hosts that cannot
+// be checked are CRITICAL.
+func (r *hostResult) setStatus() {
+	r.status = statusOK
+	if r.err != nil {
+		r.status = statusCritical
+	}
+	for _, f := range r.Findings {
+		if f.status > r.status {
+			r.status = f.status
+		}
+	}
+	for _, cert := range r.Certs {
+		for _, f := range cert.Findings {
+			if f.status > r.status {
+				r.status = f.status
+			}
+		}
+	}
+	r.Status = statusNames[r.status]
+}
+
+// minExpireHours returns the hours until the first cert of the host expires.
+func (r hostResult) minExpireHours() (int64, bool) {
+	if len(r.Certs) == 0 {
+		return 0, false
+	}
+	min := r.Certs[0].ExpireHours
+	for _, cert := range r.Certs[1:] {
+		if cert.ExpireHours < min {
+			min = cert.ExpireHours
+		}
+	}
+	return min, true
 }
 
 func main() {
 	flag.Parse()
 
-	if len(*hostsFile) == 0 {
+	if len(*hostsFile) == 0 && flag.NArg() == 0 && len(*certFiles) == 0 {
 		flag.Usage()
-		return
+		os.Exit(statusUnknown)
+	}
+	targets, err := loadTargets(*hostsFile, flag.Args())
+	if err != nil {
+		exitUnknown(err)
+	}
+	if len(targets) == 0 && len(*certFiles) == 0 {
+		exitUnknown(errors.New("no hosts to check"))
 	}
 	if *warnYears < 0 {
 		*warnYears = 0
@@ -94,21 +151,49 @@ func main() {
 	if *warnDays < 0 {
 		*warnDays = 0
 	}
+	if *warnThresh > 0 {
+		*warnYears, *warnMonths, *warnDays = 0, 0, *warnThresh
+	}
 	if *warnYears == 0 && *warnMonths == 0 && *warnDays == 0 {
 		*warnDays = 30
 	}
+	if *critThresh < 0 {
+		*critThresh = 0
+	}
 	if *concurrency < 0 {
 		*concurrency = defaultConcurrency
 	}
+	writer, err := newResultWriter(*outputFormat, os.Stdout)
+	if err != nil {
+		exitUnknown(err)
+	}
 
-	processHosts()
+	status := statusOK
+	if len(*certFiles) > 0 {
+		status = processFiles(strings.Split(*certFiles, ","), writer)
+	}
+	if len(targets) > 0 {
+		if hostStatus := processHosts(targets, writer); hostStatus > status {
+			status = hostStatus
+		}
+	}
+	if err := writer.close(); err != nil {
+		exitUnknown(err)
+	}
+	os.Exit(status)
 }
 
-func processHosts() {
+func exitUnknown(err error) {
+	log.Println(err)
+	os.Exit(statusUnknown)
+}
+
+// processHosts checks all hosts and returns the worst host status.
+func processHosts(targets []target, writer resultWriter) int {
 	done := make(chan struct{})
 	defer close(done)
 
-	hosts := queueHosts(done)
+	hosts := queueHosts(done, targets)
 	results := make(chan hostResult)
 
 	var wg sync.WaitGroup
@@ -125,39 +210,27 @@ func processHosts() {
 		close(results)
 	}()
 
+	status := statusOK
 	for r := range results {
-		if r.err != nil {
-			log.Printf("%s: %v\n", r.host, r.err)
-			continue
+		if r.status > status {
+			status = r.status
 		}
-		for _, cert := range r.certs {
-			for _, err := range cert.errs {
-				fmt.Printf("Stdout：")
-				log.Println(err)
-			}
+		if err := writer.write(r); err != nil {
+			exitUnknown(err)
 		}
 	}
+	return status
 }
 
-func queueHosts(done <-chan struct{}) <-chan string {
-	hosts := make(chan string)
+func queueHosts(done <-chan struct{}, targets []target) <-chan target {
+	hosts := make(chan target)
 	go func() {
 		defer close(hosts)
 
-		fileContents, err := ioutil.ReadFile(*hostsFile)
-		if err != nil {
-			return
-		}
-		lines := strings.Split(string(fileContents), "\n")
-		for _, line := range lines {
-			host := strings.TrimSpace(line)
-			if len(host) == 0 || host[0] == '#' {
-				continue
-			}
+		for _, t := range targets {
 			select {
-			case hosts <- host:
+			case hosts <- t:
 			case <-done:
-				fmt.Println("done final")
 				return
 			}
 		}
@@ -171,25 +244,27 @@ func queueHosts(done <-chan struct{}) <-chan string {
 
 */
 
-func processQueue(done <-chan struct{}, hosts <-chan string, results chan<- hostResult) {
+func processQueue(done <-chan struct{}, hosts <-chan target, results chan<- hostResult) {
 	for host := range hosts {
 		select {
 		case results <- checkHost(host):
 		case <-done:
-			fmt.Println("done final2")
 			return
 		}
 	}
 }
 
-func checkHost(host string) (result hostResult) {
+func checkHost(t target) (result hostResult) {
+	host := t.addr()
 	result = hostResult{
-		host:  host,
-		certs: []certErrors{},
+		Host:  host,
+		Certs: []certResult{},
 	}
-	conn, err := tls.Dial("tcp", host, nil)
+	defer result.setStatus()
+	conn, err := dialTarget(t)
 	if err != nil {
 		result.err = err
+		result.Error = err.Error()
 		return
 	}
 	defer conn.Close()
@@ -198,36 +273,82 @@ func checkHost(host string) (result hostResult) {
 	checkedCerts := make(map[string]struct{})
 	for _, chain := range conn.ConnectionState().VerifiedChains {
 		for certNum, cert := range chain {
-			fmt.Printf("Cert: %s %v %s\n", cert.NotAfter, cert.IsCA, cert.Subject.CommonName)
 			if _, checked := checkedCerts[string(cert.Signature)]; checked {
 				continue
 			}
 			checkedCerts[string(cert.Signature)] = struct{}{}
-			cErrs := []error{}
-
-			// Check the expiration.
-			if timeNow.AddDate(*warnYears, *warnMonths, *warnDays).After(cert.NotAfter) {
-				expiresIn := int64(cert.NotAfter.Sub(timeNow).Hours())
-				if expiresIn <= 48 {
-					cErrs = append(cErrs, fmt.Errorf(errExpiringShortly, host, cert.Subject.CommonName, cert.SerialNumber, expiresIn))
-				} else {
-					cErrs = append(cErrs, fmt.Errorf(errExpiringSoon, host, cert.Subject.CommonName, cert.SerialNumber, expiresIn/24))
-				}
-			}
-
-			// Check the signature algorithm, ignoring the root certificate.
-			if alg, exists := sunsetSigAlgs[cert.SignatureAlgorithm]; *checkSigAlg && exists && certNum != len(chain)-1 {
-				if cert.NotAfter.Equal(alg.sunsetsAt) || cert.NotAfter.After(alg.sunsetsAt) {
-					cErrs = append(cErrs, fmt.Errorf(errSunsetAlg, host, cert.Subject.CommonName, cert.SerialNumber, alg.name))
-				}
-			}
 
-			result.certs = append(result.certs, certErrors{
-				commonName: cert.Subject.CommonName,
-				errs:       cErrs,
-			})
+			// Ignore the root certificate for the signature algorithm check.
+			result.Certs = append(result.Certs, checkCert(host, cert, t, certNum == len(chain)-1, timeNow))
 		}
 	}
 
 	return
 }
+
+// checkCert checks the expiration and, unless isRoot, the signature
+// algorithm of a single cert. name is the host or file the cert came from.
+func checkCert(name string, cert *x509.Certificate, t target, isRoot bool, timeNow time.Time) certResult {
+	findings := []finding{}
+	expiresIn := int64(cert.NotAfter.Sub(timeNow).Hours())
+
+	// Check the expiration.
+	warnAt := timeNow.AddDate(*warnYears, *warnMonths, *warnDays)
+	if t.Warn > 0 {
+		warnAt = timeNow.AddDate(0, 0, t.Warn)
+	}
+	critAt := timeNow.AddDate(0, 0, *critThresh)
+	if t.Crit > 0 {
+		critAt = timeNow.AddDate(0, 0, t.Crit)
+	}
+	if warnAt.After(cert.NotAfter) || critAt.After(cert.NotAfter) {
+		status := statusWarning
+		if critAt.After(cert.NotAfter) {
+			status = statusCritical
+		}
+		if expiresIn <= 48 {
+			findings = append(findings, newFinding(findingExpiringShortly, status, fmt.Sprintf(errExpiringShortly, name, cert.Subject.CommonName, cert.SerialNumber, expiresIn)))
+		} else {
+			findings = append(findings, newFinding(findingExpiringSoon, status, fmt.Sprintf(errExpiringSoon, name, cert.Subject.CommonName, cert.SerialNumber, expiresIn/24)))
+		}
+	}
+
+	// Check the signature algorithm.
+	if alg, sunset := certcheck.SunsetSigAlg(cert); *checkSigAlg && sunset && !isRoot {
+		findings = append(findings, newFinding(findingSunsetAlg, statusWarning, fmt.Sprintf(errSunsetAlg, name, cert.Subject.CommonName, cert.SerialNumber, alg.Name)))
+	}
+
+	return certResult{
+		CommonName:  cert.Subject.CommonName,
+		Serial:      fmt.Sprintf("%X", cert.SerialNumber),
+		IsCA:        cert.IsCA,
+		NotAfter:    cert.NotAfter,
+		ExpireHours: expiresIn,
+		Findings:    findings,
+	}
+}
+
+// dialTarget connects to the target, negotiates STARTTLS if needed and
+// completes a verified TLS handshake.
+func dialTarget(t target) (*tls.Conn, error) {
+	conn, err := net.DialTimeout("tcp", t.addr(), *timeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(*timeout))
+	if err := starttls.Negotiate(conn, t.Protocol); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	serverName := t.SNI
+	if serverName == "" {
+		serverName = t.Host
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// selfSigned : PEM of a self-signed cert for name expiring at notAfter
+func selfSigned(t *testing.T, name string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCheckCertThresholds(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.AddDate(0, 0, n).Add(time.Minute) }
+	for _, tt := range []struct {
+		name     string
+		notAfter time.Time
+		// warnDays, crit : the -days (or -warn) and -crit flags
+		warnDays, crit int
+		target         target
+		kind           string
+		status         int
+	}{
+		{name: "far away", notAfter: days(100), warnDays: 30, crit: 7, status: statusOK},
+		{name: "within warn", notAfter: days(20), warnDays: 30, crit: 7, kind: findingExpiringSoon, status: statusWarning},
+		{name: "within crit", notAfter: days(5), warnDays: 30, crit: 7, kind: findingExpiringSoon, status: statusCritical},
+		{name: "within 48 hours", notAfter: days(1), warnDays: 30, crit: 7, kind: findingExpiringShortly, status: statusCritical},
+		{name: "expired", notAfter: days(-3), warnDays: 30, crit: 7, kind: findingExpiringShortly, status: statusCritical},
+		{name: "wider warn", notAfter: days(45), warnDays: 60, crit: 7, kind: findingExpiringSoon, status: statusWarning},
+		{name: "crit only", notAfter: days(10), warnDays: 5, crit: 14, kind: findingExpiringSoon, status: statusCritical},
+		{name: "crit disabled", notAfter: days(5), warnDays: 30, crit: 0, kind: findingExpiringSoon, status: statusWarning},
+		{name: "target warn", notAfter: days(20), warnDays: 30, crit: 7, target: target{Warn: 10}, status: statusOK},
+		{name: "target crit", notAfter: days(20), warnDays: 30, crit: 7, target: target{Crit: 30}, kind: findingExpiringSoon, status: statusCritical},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setFlags(0, 0, tt.warnDays, tt.crit)()
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: "www.example.com"}, SerialNumber: big.NewInt(10), NotAfter: tt.notAfter}
+			r := hostResult{Host: "www.example.com:443", Certs: []certResult{checkCert("www.example.com:443", cert, tt.target, false, now)}}
+			r.setStatus()
+			if r.status != tt.status {
+				t.Errorf("status = %s, want %s", r.Status, statusNames[tt.status])
+			}
+			findings := r.Certs[0].Findings
+			if tt.kind == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings = %+v, want none", findings)
+				}
+				return
+			}
+			if len(findings) != 1 || findings[0].Kind != tt.kind {
+				t.Errorf("findings = %+v, want one %s", findings, tt.kind)
+			}
+		})
+	}
+}
+
+func TestCheckCertSunsetSigAlg(t *testing.T) {
+	defer setFlags(0, 0, 30, 7)()
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "legacy.example.com"},
+		SerialNumber:       big.NewInt(11),
+		NotAfter:           now.AddDate(1, 0, 0),
+		SignatureAlgorithm: x509.SHA1WithRSA,
+	}
+	c := checkCert("legacy.example.com:443", cert, target{}, false, now)
+	if len(c.Findings) != 1 || c.Findings[0].Kind != findingSunsetAlg || c.Findings[0].status != statusWarning {
+		t.Errorf("findings = %+v, want a %s warning", c.Findings, findingSunsetAlg)
+	}
+	if c := checkCert("legacy.example.com:443", cert, target{}, true, now); len(c.Findings) != 0 {
+		t.Errorf("root findings = %+v, want none", c.Findings)
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	warn := newFinding(findingExpiringSoon, statusWarning, "")
+	crit := newFinding(findingKeyMismatch, statusCritical, "")
+	for _, tt := range []struct {
+		name   string
+		r      hostResult
+		status int
+	}{
+		{name: "no certs", r: hostResult{}, status: statusOK},
+		{name: "unreachable", r: hostResult{err: errors.New("timeout")}, status: statusCritical},
+		{name: "worst cert", r: hostResult{Certs: []certResult{{Findings: []finding{warn}}, {Findings: []finding{crit, warn}}}}, status: statusCritical},
+		{name: "host finding", r: hostResult{Findings: []finding{newFinding(findingFileError, statusUnknown, "")}}, status: statusUnknown},
+	} {
+		tt.r.setStatus()
+		if tt.r.status != tt.status || tt.r.Status != statusNames[tt.status] {
+			t.Errorf("%s: status = %d %s, want %s", tt.name, tt.r.status, tt.r.Status, statusNames[tt.status])
+		}
+	}
+}
+
+func TestProcessHostsStatus(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	var buf bytes.Buffer
+	if status := processHosts([]target{{Host: host, Port: port}}, &ndjsonWriter{enc: json.NewEncoder(&buf)}); status != statusCritical {
+		t.Errorf("processHosts(closed port) = %s, want CRITICAL", statusNames[status])
+	}
+	if !strings.Contains(buf.String(), `"status":"CRITICAL"`) {
+		t.Errorf("output = %s, want the host reported CRITICAL", buf.String())
+	}
+	if status := processHosts(nil, &ndjsonWriter{enc: json.NewEncoder(&buf)}); status != statusOK {
+		t.Errorf("processHosts(no hosts) = %s, want OK", statusNames[status])
+	}
+}
+
+func TestProcessFilesStatus(t *testing.T) {
+	defer setFlags(0, 0, 30, 7)()
+	dir, err := ioutil.TempDir("", "check-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	now := time.Now()
+	fine := write("fine.pem", selfSigned(t, "fine.example.com", now.AddDate(0, 0, 200)))
+	soon := write("soon.pem", selfSigned(t, "soon.example.com", now.AddDate(0, 0, 20)))
+	expiring := write("expiring.pem", selfSigned(t, "expiring.example.com", now.AddDate(0, 0, 3)))
+
+	for _, tt := range []struct {
+		name   string
+		paths  []string
+		status int
+	}{
+		{name: "ok", paths: []string{fine}, status: statusOK},
+		{name: "warning", paths: []string{fine, soon}, status: statusWarning},
+		{name: "critical", paths: []string{soon, expiring, fine}, status: statusCritical},
+		{name: "missing file", paths: []string{fine, filepath.Join(dir, "missing.pem")}, status: statusUnknown},
+	} {
+		var buf bytes.Buffer
+		if status := processFiles(tt.paths, &ndjsonWriter{enc: json.NewEncoder(&buf)}); status != tt.status {
+			t.Errorf("%s: processFiles() = %s, want %s\n%s", tt.name, statusNames[status], statusNames[tt.status], buf.String())
+		}
+	}
+}
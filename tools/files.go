@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+	"git.ifengidc.com/likuo/go-check-certs/probe"
+)
+
+const (
+	findingKeyMismatch  = "key_mismatch"
+	findingUnmatchedKey = "unmatched_key"
+	findingFileError    = "file_error"
+)
+
+const (
+	errKeyMismatch  = "%s: '%s' (S/N %X) does not match any private key in the file."
+	errUnmatchedKey = "%s: private key does not match any certificate."
+)
+
+// processFiles checks certificate files and directories and returns the
+// worst file status. Certs without a key in their own file are matched
+// against keys in other files of the same directory, e.g. site.crt and
+// site.key.
+func processFiles(paths []string, writer resultWriter) int {
+	status := statusOK
+	write := func(r hostResult) {
+		r.setStatus()
+		if r.status > status {
+			status = r.status
+		}
+		if err := writer.write(r); err != nil {
+			exitUnknown(err)
+		}
+	}
+
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		bundles, errs := certcheck.Scan(path, *filePassword)
+		for _, err := range errs {
+			write(hostResult{
+				Host:     path,
+				Certs:    []certResult{},
+				Findings: []finding{newFinding(findingFileError, statusUnknown, err.Error())},
+			})
+		}
+
+		// Bundles by directory, to match certs and keys kept in separate files.
+		dirBundles := map[string][]*certcheck.Bundle{}
+		for _, b := range bundles {
+			dir := filepath.Dir(b.Path)
+			dirBundles[dir] = append(dirBundles[dir], b)
+		}
+
+		timeNow := time.Now()
+		for _, b := range bundles {
+			write(checkBundle(b, dirBundles[filepath.Dir(b.Path)], timeNow))
+		}
+	}
+	return status
+}
+
+// checkBundle runs the expiration and signature algorithm checks on every
+// cert in the file and matches private keys to certs. siblings are the
+// files in the same directory, including b.
+func checkBundle(b *certcheck.Bundle, siblings []*certcheck.Bundle, timeNow time.Time) hostResult {
+	result := hostResult{
+		Host:  b.Path,
+		Certs: []certResult{},
+	}
+	for i, cert := range b.Certs {
+		c := checkCert(b.Path, cert, target{}, probe.IsSelfSigned(cert), timeNow)
+		if _, ok := b.KeyFor(cert); ok {
+			c.KeyFile = b.Path
+		} else if len(b.Keys) > 0 && i == 0 {
+			// The first cert of a file with keys is the one the keys are for.
+			c.Findings = append(c.Findings, newFinding(findingKeyMismatch, statusCritical, fmt.Sprintf(errKeyMismatch, b.Path, cert.Subject.CommonName, cert.SerialNumber)))
+		} else {
+			for _, other := range siblings {
+				if _, ok := other.KeyFor(cert); ok {
+					c.KeyFile = other.Path
+					break
+				}
+			}
+		}
+		result.Certs = append(result.Certs, c)
+	}
+
+	// A key file on its own is fine as long as a cert next to it uses it.
+	for _, key := range b.UnmatchedKeys() {
+		if len(b.Certs) == 0 && keyUsed(key, siblings) {
+			continue
+		}
+		result.Findings = append(result.Findings, newFinding(findingUnmatchedKey, statusWarning, fmt.Sprintf(errUnmatchedKey, b.Path)))
+	}
+	return result
+}
+
+func keyUsed(key crypto.PrivateKey, bundles []*certcheck.Bundle) bool {
+	for _, b := range bundles {
+		for _, cert := range b.Certs {
+			if certcheck.MatchKey(cert, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultWriter formats host results. write is called once per host as the
+// results come in, close is called after the last host.
+type resultWriter interface {
+	write(r hostResult) error
+	close() error
+}
+
+func newResultWriter(format string, w io.Writer) (resultWriter, error) {
+	switch format {
+	case "text":
+		return &textWriter{}, nil
+	case "json":
+		return &jsonWriter{w: w, results: []hostResult{}}, nil
+	case "ndjson":
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		err := cw.Write([]string{"host", "status", "error", "common_name", "serial", "is_ca", "not_after", "expire_hours", "finding_kind", "finding_severity", "finding_message"})
+		return &csvWriter{w: cw}, err
+	case "junit-xml", "junit":
+		return &junitWriter{w: w}, nil
+	case "nagios":
+		return &nagiosWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// textWriter keeps the original log lines.
+type textWriter struct{}
+
+func (t *textWriter) write(r hostResult) error {
+	if r.err != nil {
+		log.Printf("%s: %v\n", r.Host, r.err)
+		return nil
+	}
+	for _, f := range r.Findings {
+		log.Println(f.Message)
+	}
+	for _, cert := range r.Certs {
+		for _, f := range cert.Findings {
+			log.Println(f.Message)
+		}
+	}
+	return nil
+}
+
+func (t *textWriter) close() error { return nil }
+
+type jsonWriter struct {
+	w       io.Writer
+	results []hostResult
+}
+
+func (j *jsonWriter) write(r hostResult) error {
+	j.results = append(j.results, r)
+	return nil
+}
+
+func (j *jsonWriter) close() error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(j.results)
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) write(r hostResult) error { return n.enc.Encode(r) }
+
+func (n *ndjsonWriter) close() error { return nil }
+
+// csvWriter writes one row per finding, per cert without findings, or per
+// host that could not be checked.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) write(r hostResult) error {
+	if r.err != nil {
+		return c.w.Write([]string{r.Host, r.Status, r.Error, "", "", "", "", "", "", "", ""})
+	}
+	for _, f := range r.Findings {
+		if err := c.w.Write([]string{r.Host, r.Status, "", "", "", "", "", "", f.Kind, f.Severity, f.Message}); err != nil {
+			return err
+		}
+	}
+	for _, cert := range r.Certs {
+		row := []string{
+			r.Host,
+			r.Status,
+			"",
+			cert.CommonName,
+			cert.Serial,
+			strconv.FormatBool(cert.IsCA),
+			cert.NotAfter.Format(time.RFC3339),
+			strconv.FormatInt(cert.ExpireHours, 10),
+		}
+		if len(cert.Findings) == 0 {
+			if err := c.w.Write(append(row, "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, f := range cert.Findings {
+			if err := c.w.Write(append(row, f.Kind, f.Severity, f.Message)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// junitWriter writes a test suite per host and a test case per cert.
+type junitWriter struct {
+	w      io.Writer
+	suites []junitTestSuite
+}
+
+func (j *junitWriter) write(r hostResult) error {
+	suite := junitTestSuite{Name: r.Host}
+	if r.err != nil {
+		suite.Tests, suite.Errors = 1, 1
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      "connect",
+			ClassName: r.Host,
+			Error:     &junitMessage{Type: "connect", Message: r.Error},
+		})
+		j.suites = append(j.suites, suite)
+		return nil
+	}
+	for _, f := range r.Findings {
+		suite.Tests++
+		suite.Failures++
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      f.Kind,
+			ClassName: r.Host,
+			Failure:   &junitMessage{Type: f.Kind, Message: f.Message},
+		})
+	}
+	for _, cert := range r.Certs {
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("%s (S/N %s)", cert.CommonName, cert.Serial),
+			ClassName: r.Host,
+		}
+		if len(cert.Findings) > 0 {
+			kinds := make([]string, 0, len(cert.Findings))
+			messages := make([]string, 0, len(cert.Findings))
+			for _, f := range cert.Findings {
+				kinds = append(kinds, f.Kind)
+				messages = append(messages, f.Message)
+			}
+			tc.Failure = &junitMessage{
+				Type:    strings.Join(kinds, ","),
+				Message: messages[0],
+				Body:    strings.Join(messages, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	j.suites = append(j.suites, suite)
+	return nil
+}
+
+func (j *junitWriter) close() error {
+	if _, err := io.WriteString(j.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(j.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: j.suites}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n")
+	return err
+}
+
+// nagiosWriter writes a plugin status line with perfdata followed by one
+// line per problem as long output.
+type nagiosWriter struct {
+	w       io.Writer
+	results []hostResult
+}
+
+func (n *nagiosWriter) write(r hostResult) error {
+	n.results = append(n.results, r)
+	return nil
+}
+
+func (n *nagiosWriter) close() error {
+	status := statusOK
+	counts := make([]int, len(statusNames))
+	perfdata := []string{}
+	details := []string{}
+	now := time.Now()
+	warnDaysTotal := int(now.AddDate(*warnYears, *warnMonths, *warnDays).Sub(now).Hours() / 24)
+	for _, r := range n.results {
+		counts[r.status]++
+		if r.status > status {
+			status = r.status
+		}
+		if r.err != nil {
+			details = append(details, fmt.Sprintf("[%s] %s: %s", r.Status, r.Host, r.Error))
+			continue
+		}
+		for _, f := range r.Findings {
+			details = append(details, fmt.Sprintf("[%s] %s", f.Severity, f.Message))
+		}
+		if hours, ok := r.minExpireHours(); ok {
+			perfdata = append(perfdata, fmt.Sprintf("'%s'=%d;%d;%d;;", r.Host, hours/24, warnDaysTotal, *critThresh))
+		}
+		for _, cert := range r.Certs {
+			for _, f := range cert.Findings {
+				details = append(details, fmt.Sprintf("[%s] %s", f.Severity, f.Message))
+			}
+		}
+	}
+
+	line := fmt.Sprintf("CERTS %s - %d critical, %d warning, %d ok", statusNames[status], counts[statusCritical], counts[statusWarning], counts[statusOK])
+	if len(perfdata) > 0 {
+		line += " | " + strings.Join(perfdata, " ")
+	}
+	_, err := fmt.Fprintln(n.w, line)
+	if err != nil {
+		return err
+	}
+	for _, d := range details {
+		if _, err := fmt.Fprintln(n.w, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
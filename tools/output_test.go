@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleResults : one host per status, as checkHost returns them
+func sampleResults() []hostResult {
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	results := []hostResult{
+		{
+			Host: "ok.example.com:443",
+			Certs: []certResult{
+				{CommonName: "ok.example.com", Serial: "0A", NotAfter: notAfter, ExpireHours: 100 * 24, Findings: []finding{}},
+				{CommonName: "Example CA", Serial: "01", IsCA: true, NotAfter: notAfter, ExpireHours: 900 * 24, Findings: []finding{}},
+			},
+		},
+		{
+			Host: "warn.example.com:443",
+			Certs: []certResult{
+				{
+					CommonName:  "warn.example.com",
+					Serial:      "0B",
+					NotAfter:    notAfter,
+					ExpireHours: 20 * 24,
+					Findings:    []finding{newFinding(findingExpiringSoon, statusWarning, "warn.example.com:443: 'warn.example.com' (S/N B) expires in roughly 20 days.")},
+				},
+			},
+		},
+		{
+			Host:  "down.example.com:443",
+			Error: "connection refused",
+			Certs: []certResult{},
+			err:   errors.New("connection refused"),
+		},
+	}
+	for i := range results {
+		results[i].setStatus()
+	}
+	return results
+}
+
+// writeResults : format results the way main does, with -days 30 and -crit 7
+func writeResults(t *testing.T, format string, results []hostResult) string {
+	t.Helper()
+	defer setFlags(0, 0, 30, 7)()
+	var buf bytes.Buffer
+	w, err := newResultWriter(format, &buf)
+	if err != nil {
+		t.Fatalf("newResultWriter(%q) err = %v", format, err)
+	}
+	for _, r := range results {
+		if err := w.write(r); err != nil {
+			t.Fatalf("write(%s) err = %v", r.Host, err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("close() err = %v", err)
+	}
+	return buf.String()
+}
+
+// setFlags : set the threshold flags, the returned func restores them
+func setFlags(years, months, days, crit int) func() {
+	saved := []int{*warnYears, *warnMonths, *warnDays, *critThresh}
+	*warnYears, *warnMonths, *warnDays, *critThresh = years, months, days, crit
+	return func() {
+		*warnYears, *warnMonths, *warnDays, *critThresh = saved[0], saved[1], saved[2], saved[3]
+	}
+}
+
+func TestNewResultWriter(t *testing.T) {
+	for _, format := range []string{"text", "json", "ndjson", "csv", "junit-xml", "junit", "nagios"} {
+		if _, err := newResultWriter(format, &bytes.Buffer{}); err != nil {
+			t.Errorf("newResultWriter(%q) err = %v", format, err)
+		}
+	}
+	if _, err := newResultWriter("yaml", &bytes.Buffer{}); err == nil || err.Error() != `unknown output format "yaml"` {
+		t.Errorf("newResultWriter(yaml) err = %v", err)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var got []hostResult
+	if err := json.Unmarshal([]byte(writeResults(t, "json", sampleResults())), &got); err != nil {
+		t.Fatalf("output is not a JSON array: %v", err)
+	}
+	statuses := []string{}
+	for _, r := range got {
+		statuses = append(statuses, r.Host+"="+r.Status)
+	}
+	if want := "ok.example.com:443=OK warn.example.com:443=WARNING down.example.com:443=CRITICAL"; strings.Join(statuses, " ") != want {
+		t.Errorf("statuses = %v, want %s", statuses, want)
+	}
+	if got[2].Error != "connection refused" {
+		t.Errorf("error = %q, want connection refused", got[2].Error)
+	}
+	f := got[1].Certs[0].Findings
+	if len(f) != 1 || f[0].Kind != findingExpiringSoon || f[0].Severity != "WARNING" {
+		t.Errorf("findings = %+v, want one WARNING %s", f, findingExpiringSoon)
+	}
+
+	if out := writeResults(t, "json", nil); strings.TrimSpace(out) != "[]" {
+		t.Errorf("json output without hosts = %q, want []", out)
+	}
+}
+
+func TestNDJSONOutput(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeResults(t, "ndjson", sampleResults())), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want one per host:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	for i, line := range lines {
+		var r hostResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i+1, err)
+		}
+		if want := sampleResults()[i].Host; r.Host != want {
+			t.Errorf("line %d host = %s, want %s", i+1, r.Host, want)
+		}
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(writeResults(t, "csv", sampleResults()))).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+	want := [][]string{
+		{"host", "status", "error", "common_name", "serial", "is_ca", "not_after", "expire_hours", "finding_kind", "finding_severity", "finding_message"},
+		{"ok.example.com:443", "OK", "", "ok.example.com", "0A", "false", "2030-01-02T03:04:05Z", "2400", "", "", ""},
+		{"ok.example.com:443", "OK", "", "Example CA", "01", "true", "2030-01-02T03:04:05Z", "21600", "", "", ""},
+		{"warn.example.com:443", "WARNING", "", "warn.example.com", "0B", "false", "2030-01-02T03:04:05Z", "480", findingExpiringSoon, "WARNING", "warn.example.com:443: 'warn.example.com' (S/N B) expires in roughly 20 days."},
+		{"down.example.com:443", "CRITICAL", "connection refused", "", "", "", "", "", "", "", ""},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %q", len(rows), len(want), rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestJUnitOutput(t *testing.T) {
+	out := writeResults(t, "junit", sampleResults())
+	if !strings.HasPrefix(out, xml.Header) {
+		t.Errorf("output does not start with the XML header:\n%s", out)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not XML: %v", err)
+	}
+	if len(got.Suites) != 3 {
+		t.Fatalf("got %d suites, want one per host", len(got.Suites))
+	}
+	for i, tt := range []struct {
+		name                    string
+		tests, failures, errors int
+	}{
+		{name: "ok.example.com:443", tests: 2},
+		{name: "warn.example.com:443", tests: 1, failures: 1},
+		{name: "down.example.com:443", tests: 1, errors: 1},
+	} {
+		s := got.Suites[i]
+		if s.Name != tt.name || s.Tests != tt.tests || s.Failures != tt.failures || s.Errors != tt.errors || len(s.Cases) != tt.tests {
+			t.Errorf("suite %d = %s tests=%d failures=%d errors=%d cases=%d, want %+v", i, s.Name, s.Tests, s.Failures, s.Errors, len(s.Cases), tt)
+		}
+	}
+	if c := got.Suites[1].Cases[0]; c.Name != "warn.example.com (S/N 0B)" || c.Failure == nil || c.Failure.Type != findingExpiringSoon {
+		t.Errorf("warning case = %+v, want a %s failure", c, findingExpiringSoon)
+	}
+	if c := got.Suites[2].Cases[0]; c.Error == nil || c.Error.Message != "connection refused" {
+		t.Errorf("error case = %+v, want the connect error", c)
+	}
+}
+
+func TestNagiosOutput(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeResults(t, "nagios", sampleResults())), "\n")
+	want := []string{
+		"CERTS CRITICAL - 1 critical, 1 warning, 1 ok | 'ok.example.com:443'=100;30;7;; 'warn.example.com:443'=20;30;7;;",
+		"[WARNING] warn.example.com:443: 'warn.example.com' (S/N B) expires in roughly 20 days.",
+		"[CRITICAL] down.example.com:443: connection refused",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("nagios output =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	if out := writeResults(t, "nagios", sampleResults()[:1]); out != "CERTS OK - 0 critical, 0 warning, 1 ok | 'ok.example.com:443'=100;30;7;;\n" {
+		t.Errorf("nagios output for a healthy host = %q", out)
+	}
+}
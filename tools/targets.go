@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.ifengidc.com/likuo/go-check-certs/certcheck"
+
+	"gopkg.in/yaml.v2"
+)
+
+// target is a single endpoint to check. Everything but Host is optional;
+// zero values fall back to the command line flags.
+type target struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     string `json:"port,omitempty" yaml:"port"`
+	SNI      string `json:"sni,omitempty" yaml:"sni"`
+	Protocol string `json:"protocol,omitempty" yaml:"protocol"`
+	Warn     int    `json:"warn,omitempty" yaml:"warn"`
+	Crit     int    `json:"crit,omitempty" yaml:"crit"`
+}
+
+// UnmarshalJSON accepts the port of a JSON inventory as a number too, like
+// YAML does.
+func (t *target) UnmarshalJSON(data []byte) error {
+	type plain target
+	entry := struct {
+		*plain
+		Port json.RawMessage `json:"port"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	if port := string(entry.Port); port != "" && port != "null" {
+		t.Port = strings.Trim(port, `"`)
+	}
+	return nil
+}
+
+func (t target) addr() string {
+	return net.JoinHostPort(t.Host, t.Port)
+}
+
+// inventory is the structured hosts file, either a bare list of targets or
+// an object with a hosts key.
+type inventory struct {
+	Hosts []target `json:"hosts" yaml:"hosts"`
+}
+
+// loadTargets collects targets from the -hosts file (or stdin when it is
+// "-") and from the positional arguments.
+func loadTargets(hostsPath string, args []string) ([]target, error) {
+	targets := []target{}
+	if hostsPath != "" {
+		var (
+			data []byte
+			err  error
+		)
+		if hostsPath == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(hostsPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read hosts from %s: %v", hostsPath, err)
+		}
+		fileTargets, err := parseHosts(hostsPath, data)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, fileTargets...)
+	}
+	for _, arg := range args {
+		t, err := parseTarget(arg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// parseHosts parses a YAML or JSON inventory, or a plain list with one host
+// or URL per line.
+func parseHosts(name string, data []byte) ([]target, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case ext == ".json" || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")):
+		return parseInventory(name, trimmed, json.Unmarshal)
+	case ext == ".yaml" || ext == ".yml" || bytes.HasPrefix(trimmed, []byte("hosts:")) || bytes.HasPrefix(trimmed, []byte("- ")):
+		return parseInventory(name, trimmed, yaml.Unmarshal)
+	}
+
+	targets := []target{}
+	for i, line := range strings.Split(string(data), "\n") {
+		host := strings.TrimSpace(line)
+		if len(host) == 0 || host[0] == '#' {
+			continue
+		}
+		t, err := parseTarget(host)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, i+1, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func parseInventory(name string, data []byte, unmarshal func([]byte, interface{}) error) ([]target, error) {
+	var entries []target
+	if err := unmarshal(data, &entries); err != nil {
+		inv := inventory{}
+		if err := unmarshal(data, &inv); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		entries = inv.Hosts
+	}
+
+	targets := make([]target, 0, len(entries))
+	for i, entry := range entries {
+		t, err := parseTarget(entry.Host)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %v", name, i+1, err)
+		}
+		if entry.Port != "" {
+			t.Port = entry.Port
+		}
+		if entry.Protocol != "" {
+			t.Protocol = entry.Protocol
+		}
+		t.SNI, t.Warn, t.Crit = entry.SNI, entry.Warn, entry.Crit
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// parseTarget accepts host, host:port, [v6]:port and URLs such as
+// https://host:8443/path or smtp://host.
+func parseTarget(s string) (target, error) {
+	t, err := certcheck.ParseTarget(s)
+	return target{Host: t.Host, Port: t.Port, Protocol: t.Protocol}, err
+}
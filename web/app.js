@@ -0,0 +1,329 @@
+// go-check-certs dashboard, backed by /api/v1
+(function () {
+  'use strict';
+
+  var API = '/api/v1';
+  var PAGE_LIMIT = 1000;
+  var DAY = 24 * 60 * 60 * 1000;
+  // status filter of the list view as /api/v1/hosts query parameters
+  var STATUS_QUERY = {
+    expired: { max_days: '6', error: 'false' },
+    warning: { min_days: '7', max_days: '29', error: 'false' },
+    ok: { min_days: '30', error: 'false' },
+    error: { error: 'true' }
+  };
+
+  var app = document.getElementById('app');
+
+  function api(method, path, body) {
+    var opts = { method: method, headers: {} };
+    if (body !== undefined) {
+      opts.headers['Content-Type'] = 'application/json';
+      opts.body = JSON.stringify(body);
+    }
+    return fetch(API + path, opts).then(function (resp) {
+      if (resp.status === 204) {
+        return null;
+      }
+      return resp.json().then(function (data) {
+        if (!resp.ok) {
+          throw new Error(data && data.error ? data.error : resp.statusText);
+        }
+        return data;
+      });
+    });
+  }
+
+  // listHosts : all pages of /hosts matching params
+  function listHosts(params, page, acc) {
+    page = page || 1;
+    acc = acc || [];
+    var query = new URLSearchParams(params);
+    query.set('status', 'all');
+    query.set('page', page);
+    query.set('limit', PAGE_LIMIT);
+    return api('GET', '/hosts?' + query.toString()).then(function (data) {
+      acc = acc.concat(data.items || []);
+      if (acc.length < data.total && (data.items || []).length > 0) {
+        return listHosts(params, page + 1, acc);
+      }
+      return acc;
+    });
+  }
+
+  function parseTime(s) {
+    if (!s) {
+      return null;
+    }
+    var t = new Date(s);
+    // Go zero time means not set
+    if (isNaN(t.getTime()) || t.getUTCFullYear() <= 1) {
+      return null;
+    }
+    return t;
+  }
+
+  function daysLeft(s) {
+    var t = parseTime(s);
+    return t ? Math.floor((t.getTime() - Date.now()) / DAY) : null;
+  }
+
+  function statusOf(host) {
+    if (host.probe_error) {
+      return 'error';
+    }
+    var days = daysLeft(host.expire_at);
+    if (days === null) {
+      return 'error';
+    }
+    if (days < 7) {
+      return 'expired';
+    }
+    if (days < 30) {
+      return 'warning';
+    }
+    return 'ok';
+  }
+
+  function fmtTime(s) {
+    var t = parseTime(s);
+    return t ? t.toISOString().replace('T', ' ').slice(0, 16) : '-';
+  }
+
+  function fmtDate(s) {
+    var t = parseTime(s);
+    return t ? t.toISOString().slice(0, 10) : '-';
+  }
+
+  function el(tag, text, className) {
+    var e = document.createElement(tag);
+    if (text !== undefined && text !== null) {
+      e.textContent = text;
+    }
+    if (className) {
+      e.className = className;
+    }
+    return e;
+  }
+
+  function row(cells, className) {
+    var tr = el('tr', null, className);
+    cells.forEach(function (c) {
+      if (c instanceof Node) {
+        var td = el('td');
+        td.appendChild(c);
+        tr.appendChild(td);
+      } else {
+        tr.appendChild(el('td', c === undefined || c === null || c === '' ? '-' : String(c)));
+      }
+    });
+    return tr;
+  }
+
+  function link(href, text) {
+    var a = el('a', text);
+    a.href = href;
+    return a;
+  }
+
+  function fail(err) {
+    var p = el('p', 'Error: ' + err.message, 'error-text');
+    app.insertBefore(p, app.firstChild);
+  }
+
+  function render(templateID) {
+    app.innerHTML = '';
+    app.appendChild(document.getElementById(templateID).content.cloneNode(true));
+  }
+
+  function hostID(host) {
+    return encodeURIComponent(host.id || host.host);
+  }
+
+  // showList : #/?user=X&status=Y&q=Z
+  function showList(params) {
+    render('list-view');
+    var filter = document.getElementById('filter');
+    ['user', 'team', 'status', 'q'].forEach(function (name) {
+      filter.elements[name].value = params.get(name) || '';
+    });
+    filter.addEventListener('submit', function (e) {
+      e.preventDefault();
+      var next = new URLSearchParams();
+      ['user', 'team', 'status', 'q'].forEach(function (name) {
+        var v = filter.elements[name].value.trim();
+        if (v) {
+          next.set(name, v);
+        }
+      });
+      location.hash = '#/?' + next.toString();
+    });
+
+    var subscribe = document.getElementById('subscribe');
+    subscribe.elements.uid.value = params.get('user') || '';
+    subscribe.addEventListener('submit', function (e) {
+      e.preventDefault();
+      var f = subscribe.elements;
+      api('POST', '/users/' + encodeURIComponent(f.uid.value.trim()) + '/hosts', {
+        host: f.host.value.trim(),
+        port: f.port.value.trim()
+      }).then(function (host) {
+        location.hash = '#/host/' + hostID(host);
+      }).catch(fail);
+    });
+
+    var query = {};
+    if (params.get('user')) {
+      query.user = params.get('user');
+    }
+    if (params.get('team')) {
+      query.team = params.get('team');
+    }
+    var status = STATUS_QUERY[params.get('status')] || {};
+    Object.keys(status).forEach(function (k) {
+      query[k] = status[k];
+    });
+    query.sort = 'expiry';
+
+    listHosts(query).then(function (hosts) {
+      var q = (params.get('q') || '').toLowerCase();
+      if (q) {
+        hosts = hosts.filter(function (h) {
+          return h.host.toLowerCase().indexOf(q) >= 0;
+        });
+      }
+      app.querySelector('.summary').textContent = hosts.length + ' hosts';
+      var tbody = app.querySelector('table.hosts tbody');
+      hosts.forEach(function (h) {
+        var days = h.probe_error ? null : daysLeft(h.expire_at);
+        var leaf = (h.cert || [])[0] || {};
+        var tr = row([
+          link('#/host/' + hostID(h), h.host),
+          h.port || '443',
+          days,
+          fmtDate(h.expire_at),
+          leaf.issuer,
+          h.team,
+          (h.user || []).join(', '),
+          h.probe_error ? h.probe_error : fmtTime(h.probe_time)
+        ], statusOf(h));
+        tr.children[2].className = 'days';
+        tbody.appendChild(tr);
+      });
+    }).catch(fail);
+  }
+
+  // showHost : #/host/{id}
+  function showHost(id) {
+    render('detail-view');
+    var path = '/hosts/' + encodeURIComponent(id);
+
+    api('GET', path).then(function (host) {
+      app.querySelector('h1.host').textContent = host.host + ':' + (host.port || '443');
+      var status = app.querySelector('p.status');
+      var badge = el('span', statusOf(host), 'badge ' + statusOf(host));
+      status.appendChild(badge);
+      status.appendChild(document.createTextNode(' last probe ' + fmtTime(host.probe_time)));
+      if (host.team) {
+        status.appendChild(document.createTextNode(' team '));
+        status.appendChild(link('#/?team=' + encodeURIComponent(host.team), host.team));
+      }
+      if (host.probe_error) {
+        status.appendChild(el('span', ' ' + host.probe_error, 'error-text'));
+      }
+
+      var users = app.querySelector('ul.users');
+      (host.user || []).forEach(function (uid) {
+        var li = el('li', uid);
+        var btn = el('button', 'Unsubscribe');
+        btn.addEventListener('click', function () {
+          if (!confirm('Unsubscribe ' + uid + ' from ' + host.host + '?')) {
+            return;
+          }
+          api('DELETE', '/users/' + encodeURIComponent(uid) + path).then(function () {
+            // 没有所属团队时，最后一个用户退订后主机会被删除
+            if (host.user.length > 1 || host.team) {
+              showHost(id);
+            } else {
+              location.hash = '#/';
+            }
+          }).catch(fail);
+        });
+        li.appendChild(btn);
+        users.appendChild(li);
+      });
+
+      var addUser = document.getElementById('add-user');
+      addUser.addEventListener('submit', function (e) {
+        e.preventDefault();
+        api('POST', '/users/' + encodeURIComponent(addUser.elements.uid.value.trim()) + '/hosts', {
+          host: host.host,
+          port: host.port
+        }).then(function () {
+          showHost(id);
+        }).catch(fail);
+      });
+
+      document.getElementById('delete-host').addEventListener('click', function () {
+        if (!confirm('Stop monitoring ' + host.host + ' for all users?')) {
+          return;
+        }
+        api('DELETE', path).then(function () {
+          location.hash = '#/';
+        }).catch(fail);
+      });
+    }).catch(fail);
+
+    api('GET', path + '/certs').then(function (certs) {
+      var tbody = app.querySelector('table.chain tbody');
+      (certs.certs || []).forEach(function (c, i) {
+        var days = daysLeft(c.not_after);
+        var cls = days === null ? 'error' : days < 7 ? 'expired' : days < 30 ? 'warning' : 'ok';
+        var tr = row([
+          i,
+          c.common_name + (c.is_ca ? ' (CA)' : ''),
+          c.issuer,
+          c.serial_number,
+          fmtDate(c.not_before),
+          fmtDate(c.not_after),
+          days,
+          c.revocation && c.revocation.status
+        ], cls);
+        tr.children[6].className = 'days';
+        tbody.appendChild(tr);
+      });
+      var issues = app.querySelector('ul.issues');
+      (certs.chain || []).forEach(function (issue) {
+        issues.appendChild(el('li', issue.type + (issue.message ? ': ' + issue.message : ''), 'error-text'));
+      });
+    }).catch(fail);
+
+    api('GET', path + '/history').then(function (history) {
+      var tbody = app.querySelector('table.history tbody');
+      if (!history || history.length === 0) {
+        var tr = row(['no history yet'], 'muted');
+        tr.children[0].colSpan = 5;
+        tbody.appendChild(tr);
+        return;
+      }
+      history.forEach(function (h) {
+        var cert = h.cert || {};
+        tbody.appendChild(row([fmtTime(h.time), h.event, cert.serial_number, fmtDate(cert.not_after), h.error]));
+      });
+    }).catch(fail);
+  }
+
+  function route() {
+    var hash = location.hash.replace(/^#/, '') || '/';
+    var parts = hash.split('?');
+    var m = parts[0].match(/^\/host\/([^/]+)$/);
+    if (m) {
+      showHost(decodeURIComponent(m[1]));
+      return;
+    }
+    showList(new URLSearchParams(parts[1] || ''));
+  }
+
+  window.addEventListener('hashchange', route);
+  route();
+})();
@@ -0,0 +1,29 @@
+// Package web embeds the assets of the single page dashboard, served by httpd at / and under Prefix.
+package web
+
+import (
+	"embed"
+	"net/http"
+)
+
+// Prefix : path the dashboard assets are served under, as referenced by index.html
+const Prefix = "/ui/"
+
+//go:embed index.html app.js style.css
+var files embed.FS
+
+// Index : the dashboard page, it only talks to /api/v1
+func Index(w http.ResponseWriter, r *http.Request) {
+	index, err := files.ReadFile("index.html")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(index)
+}
+
+// Assets : serve the embedded assets under Prefix
+func Assets() http.Handler {
+	return http.StripPrefix(Prefix, http.FileServer(http.FS(files)))
+}
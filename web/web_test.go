@@ -0,0 +1,90 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestIndex(t *testing.T) {
+	w := get(http.HandlerFunc(Index), "/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET / = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %s, want text/html", ct)
+	}
+
+	// every asset the page loads is embedded and served under Prefix
+	refs := regexp.MustCompile(`(?:src|href)="(/[^"]*)"`).FindAllStringSubmatch(w.Body.String(), -1)
+	if len(refs) == 0 {
+		t.Fatal("index.html references no assets")
+	}
+	for _, ref := range refs {
+		path := ref[1]
+		if !strings.HasPrefix(path, Prefix) {
+			t.Errorf("index.html references %s outside of %s", path, Prefix)
+			continue
+		}
+		if w := get(Assets(), path); w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, w.Code)
+		}
+	}
+}
+
+func TestAssets(t *testing.T) {
+	for _, tt := range []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{path: Prefix + "app.js", status: http.StatusOK, contentType: "javascript"},
+		{path: Prefix + "style.css", status: http.StatusOK, contentType: "text/css"},
+		{path: Prefix + "missing.js", status: http.StatusNotFound},
+		{path: Prefix + "web.go", status: http.StatusNotFound},
+	} {
+		w := get(Assets(), tt.path)
+		if w.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.status)
+		}
+		if ct := w.Header().Get("Content-Type"); tt.contentType != "" && !strings.Contains(ct, tt.contentType) {
+			t.Errorf("GET %s Content-Type = %s, want %s", tt.path, ct, tt.contentType)
+		}
+	}
+}
+
+// TestElementIDs : the elements and templates app.js looks up are in index.html
+func TestElementIDs(t *testing.T) {
+	index, err := files.ReadFile("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := files.ReadFile("app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, m := range regexp.MustCompile(`id="([^"]+)"`).FindAllStringSubmatch(string(index), -1) {
+		ids[m[1]] = true
+	}
+	used := regexp.MustCompile(`(?:getElementById|render)\('([^']+)'\)`).FindAllStringSubmatch(string(script), -1)
+	if len(used) == 0 {
+		t.Fatal("app.js looks up no elements")
+	}
+	for _, m := range used {
+		if !ids[m[1]] {
+			t.Errorf("app.js uses #%s, which is not in index.html", m[1])
+		}
+	}
+	if !strings.Contains(string(script), "var API = '/api/v1';") {
+		t.Error("app.js does not use /api/v1")
+	}
+}